@@ -0,0 +1,179 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDev(t *testing.T) {
+	dir := t.TempDir()
+
+	certFile, keyFile, err := Dev(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caPEM, err := os.ReadFile(filepath.Join(dir, CAFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("The certificate is trusted by clients trusting the CA", func(t *testing.T) {
+		r, err := NewReloader(certFile, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l, err := tls.Listen("tcp", "127.0.0.1:0", r.Config())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})}
+		go srv.Serve(l)
+		defer srv.Close()
+
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(caPEM)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+		res, err := client.Get("https://" + l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	})
+
+	t.Run("The CA and a valid certificate are reused", func(t *testing.T) {
+		before, _ := os.ReadFile(certFile)
+
+		if _, _, err := Dev(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		after, _ := os.ReadFile(certFile)
+		ca, _ := os.ReadFile(filepath.Join(dir, CAFile))
+		if string(before) != string(after) || string(ca) != string(caPEM) {
+			t.Error("Expected the existing CA and certificate to be kept")
+		}
+	})
+
+	t.Run("A missing certificate is issued by the existing CA", func(t *testing.T) {
+		os.Remove(certFile)
+
+		if _, _, err := Dev(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		ca, _ := os.ReadFile(filepath.Join(dir, CAFile))
+		if string(ca) != string(caPEM) {
+			t.Error("Expected the CA to be kept")
+		}
+		if _, err := os.Stat(certFile); err != nil {
+			t.Errorf("Expected a new certificate, got %v", err)
+		}
+	})
+}
+
+func TestReloader(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	certA, keyA, err := Dev(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certB, keyB, err := Dev(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	install := func(cert, key string, modTime time.Time) {
+		for src, dst := range map[string]string{cert: certFile, key: keyFile} {
+			b, _ := os.ReadFile(src)
+			os.WriteFile(dst, b, 0600)
+			os.Chtimes(dst, modTime, modTime)
+		}
+	}
+
+	served := func(r *Reloader) []byte {
+		c, _ := r.GetCertificate(nil)
+		return c.Certificate[0]
+	}
+
+	start := time.Now().Add(-time.Minute)
+	install(certA, keyA, start)
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := served(r)
+
+	t.Run("Unchanged files are not reloaded", func(t *testing.T) {
+		if changed, err := r.ReloadIfChanged(); changed || err != nil {
+			t.Errorf("Expected no reload, got %t, %v", changed, err)
+		}
+	})
+
+	t.Run("Replaced files are reloaded", func(t *testing.T) {
+		install(certB, keyB, start.Add(time.Second))
+
+		if changed, err := r.ReloadIfChanged(); !changed || err != nil {
+			t.Fatalf("Expected a reload, got %t, %v", changed, err)
+		}
+
+		if string(served(r)) == string(original) {
+			t.Error("Expected the new certificate to be served")
+		}
+	})
+
+	t.Run("Invalid files keep the previous certificate", func(t *testing.T) {
+		current := served(r)
+		os.WriteFile(keyFile, []byte("not a key"), 0600)
+
+		if err := r.Reload(); err == nil {
+			t.Error("Expected an error for an invalid key")
+		}
+
+		if string(served(r)) != string(current) {
+			t.Error("Expected the previous certificate to still be served")
+		}
+	})
+}
+
+func TestRedirectHandler(t *testing.T) {
+	cases := []struct {
+		method, target, host string
+		port                 int
+		status               int
+		location             string
+	}{
+		{"GET", "/posts?page=2", "simcha.dev", 443, http.StatusMovedPermanently, "https://simcha.dev/posts?page=2"},
+		{"GET", "/", "simcha.dev:80", 443, http.StatusMovedPermanently, "https://simcha.dev/"},
+		{"GET", "/", "localhost:8080", 8443, http.StatusMovedPermanently, "https://localhost:8443/"},
+		{"GET", "/", "[::1]:8080", 8443, http.StatusMovedPermanently, "https://[::1]:8443/"},
+		{"POST", "/login", "simcha.dev", 443, http.StatusPermanentRedirect, "https://simcha.dev/login"},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, nil)
+		req.Host = c.host
+
+		rr := httptest.NewRecorder()
+		RedirectHandler(c.port).ServeHTTP(rr, req)
+
+		if rr.Code != c.status || rr.Header().Get("Location") != c.location {
+			t.Errorf("Expected %s %s%s to redirect to %s with %d, got %s with %d",
+				c.method, c.host, c.target, c.location, c.status, rr.Header().Get("Location"), rr.Code)
+		}
+	}
+}
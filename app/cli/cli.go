@@ -0,0 +1,203 @@
+/*
+Package cli implements the subcommands of the simcha binary, such as migrate
+and users, so operators can run routine tasks without opening psql
+*/
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes returned by Execute
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// UsageError is returned by a command given the wrong arguments, and causes its usage to be printed
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &UsageError{Message: fmt.Sprintf(format, args...)}
+}
+
+// Command is a subcommand of the binary. A command either runs, or groups Subcommands
+type Command struct {
+	Name string
+	// Args describes the arguments after the flags, such as <email>
+	Args string
+	// Summary is shown in the list of commands
+	Summary string
+	// Help is shown in the command's own help
+	Help        string
+	Run         func(c *Command, args []string) error
+	Subcommands []*Command
+
+	path string
+	out  io.Writer
+}
+
+// Flags creates the flag set of the command. Its usage prints the command's help
+func (c *Command) Flags() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.path, flag.ContinueOnError)
+	fs.SetOutput(c.out)
+	fs.Usage = func() {
+		c.printHelp(fs)
+	}
+
+	return fs
+}
+
+// Out is where the command writes its output
+func (c *Command) Out() io.Writer {
+	return c.out
+}
+
+func (c *Command) find(name string) *Command {
+	for _, sub := range c.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+
+	return nil
+}
+
+func (c *Command) printHelp(fs *flag.FlagSet) {
+	usage := c.path
+	if len(c.Subcommands) > 0 {
+		usage += " <command>"
+	} else {
+		if hasFlags(fs) {
+			usage += " [flags]"
+		}
+		if c.Args != "" {
+			usage += " " + c.Args
+		}
+	}
+
+	fmt.Fprintf(c.out, "Usage: %s\n", usage)
+	if c.Help != "" {
+		fmt.Fprintf(c.out, "\n%s\n", strings.TrimSpace(c.Help))
+	} else if c.Summary != "" {
+		fmt.Fprintf(c.out, "\n%s\n", c.Summary)
+	}
+
+	if len(c.Subcommands) > 0 {
+		fmt.Fprintln(c.out, "\nCommands:")
+		tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+		for _, sub := range c.Subcommands {
+			fmt.Fprintf(tw, "  %s\t%s\n", sub.Name, sub.Summary)
+		}
+		tw.Flush()
+		fmt.Fprintf(c.out, "\nRun '%s <command> -h' for help on a command.\n", c.path)
+	}
+
+	if hasFlags(fs) {
+		fmt.Fprintln(c.out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	if fs != nil {
+		fs.VisitAll(func(*flag.Flag) { found = true })
+	}
+
+	return found
+}
+
+// Execute runs the command named by args, printing help for "help", -h or an incomplete command. Errors are
+// written to errOut, and the exit code is returned: ExitUsage for bad arguments, and ExitError when the command fails
+func Execute(root *Command, args []string, out, errOut io.Writer) int {
+	c := root
+	c.path, c.out = root.Name, out
+
+	for len(c.Subcommands) > 0 {
+		if len(args) == 0 {
+			c.printHelp(nil)
+			return ExitUsage
+		}
+
+		name := args[0]
+		if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+			c.printHelp(nil)
+			return ExitOK
+		}
+
+		sub := c.find(name)
+		if sub == nil {
+			fmt.Fprintf(errOut, "%s: unknown command %q\n\n", c.path, name)
+			c.out = errOut
+			c.printHelp(nil)
+			return ExitUsage
+		}
+
+		sub.path, sub.out = c.path+" "+sub.Name, out
+		c, args = sub, args[1:]
+	}
+
+	err := c.Run(c, args)
+
+	var usage *UsageError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, flag.ErrHelp):
+		return ExitOK
+	case errors.As(err, &usage):
+		fmt.Fprintf(errOut, "%s: %s\n", c.path, usage.Message)
+		fmt.Fprintf(errOut, "Run '%s -h' for usage.\n", c.path)
+		return ExitUsage
+	case isFlagError(err):
+		// the flag package has already printed the error and the usage
+		return ExitUsage
+	}
+
+	fmt.Fprintf(errOut, "%s: %v\n", c.path, err)
+	return ExitError
+}
+
+// flagError marks errors returned by flag.FlagSet.Parse
+type flagError struct {
+	err error
+}
+
+func (e *flagError) Error() string { return e.err.Error() }
+
+func isFlagError(err error) bool {
+	var fe *flagError
+	return errors.As(err, &fe)
+}
+
+// parse parses the flags of the command, and checks the number of remaining arguments
+func parse(c *Command, fs *flag.FlagSet, args []string, nargs int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, &flagError{err}
+	}
+
+	if fs.NArg() != nargs {
+		if c.Args == "" {
+			return nil, usageErrorf("expected no arguments, got %d", fs.NArg())
+		}
+		return nil, usageErrorf("expected %s", c.Args)
+	}
+
+	return fs.Args(), nil
+}
@@ -0,0 +1,251 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/mocks/database"
+	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/golang/mock/gomock"
+)
+
+// fakeStore adds the migration methods, which are not part of the Datastore, to the mock
+type fakeStore struct {
+	*mockdatabase.MockDatastore
+	status []database.MigrationStatus
+	down   int
+	closed bool
+}
+
+func (s *fakeStore) Migrate() error          { return nil }
+func (s *fakeStore) MigrateDown(n int) error { s.down = n; return nil }
+func (s *fakeStore) Close() error            { s.closed = true; return nil }
+func (s *fakeStore) MigrationStatus() ([]database.MigrationStatus, error) {
+	return s.status, nil
+}
+
+func setup(t *testing.T) (*fakeStore, func(args ...string) (int, string, string)) {
+	mockCtrl := gomock.NewController(t)
+	t.Cleanup(mockCtrl.Finish)
+
+	store := &fakeStore{MockDatastore: mockdatabase.NewMockDatastore(mockCtrl)}
+	tool := &Tool{Open: func() (Store, error) { return store, nil }}
+
+	run := func(args ...string) (int, string, string) {
+		var out, errOut bytes.Buffer
+		root := &Command{Name: "simcha", Subcommands: tool.Commands()}
+		code := Execute(root, args, &out, &errOut)
+		return code, out.String(), errOut.String()
+	}
+
+	return store, run
+}
+
+func TestExecute(t *testing.T) {
+	_, run := setup(t)
+
+	t.Run("Help lists the commands", func(t *testing.T) {
+		code, out, _ := run("help")
+		if code != ExitOK || !strings.Contains(out, "migrate") || !strings.Contains(out, "sessions") {
+			t.Errorf("Unexpected help %d %s", code, out)
+		}
+	})
+
+	t.Run("Command help shows its flags", func(t *testing.T) {
+		code, out, _ := run("users", "create", "-h")
+		if code != ExitOK || !strings.Contains(out, "Usage: simcha users create [flags] <email>") || !strings.Contains(out, "-role") {
+			t.Errorf("Unexpected help %d %s", code, out)
+		}
+	})
+
+	t.Run("A group without a command is a usage error", func(t *testing.T) {
+		if code, _, _ := run("users"); code != ExitUsage {
+			t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
+		}
+	})
+
+	t.Run("Unknown commands are usage errors", func(t *testing.T) {
+		code, _, errOut := run("users", "rename")
+		if code != ExitUsage || !strings.Contains(errOut, `unknown command "rename"`) {
+			t.Errorf("Unexpected result %d %s", code, errOut)
+		}
+	})
+
+	t.Run("Missing arguments are usage errors", func(t *testing.T) {
+		code, _, errOut := run("users", "set-role", "a@fake.com")
+		if code != ExitUsage || !strings.Contains(errOut, "expected <email> <role>") {
+			t.Errorf("Unexpected result %d %s", code, errOut)
+		}
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	store, run := setup(t)
+
+	t.Run("Status lists applied and pending migrations", func(t *testing.T) {
+		store.status = []database.MigrationStatus{
+			{Migration: database.Migration{Version: 1, Name: "baseline"}, Applied: true, AppliedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+			{Migration: database.Migration{Version: 2, Name: "roles"}},
+		}
+
+		code, out, _ := run("migrate", "status")
+		if code != ExitOK || !strings.Contains(out, "2020-01-02 03:04:05") || !strings.Contains(out, "pending") {
+			t.Errorf("Unexpected status %d %s", code, out)
+		}
+
+		if !store.closed {
+			t.Error("Expected the store to be closed")
+		}
+	})
+
+	t.Run("Down reverts the given number of steps", func(t *testing.T) {
+		if code, _, _ := run("migrate", "down", "-steps", "2"); code != ExitOK || store.down != 2 {
+			t.Errorf("Expected 2 steps to be reverted, got %d with exit code %d", store.down, code)
+		}
+	})
+}
+
+func TestUsers(t *testing.T) {
+	store, run := setup(t)
+	user := models.User{Id: 4, Email: "a@fake.com", Role: models.RoleUser}
+
+	t.Run("Create generates a password and sets the role", func(t *testing.T) {
+		store.EXPECT().CreateUser(gomock.Any()).DoAndReturn(func(ua models.UserAction) error {
+			u := ua.User()
+			if len(u.Password) < 16 || u.Password != u.ConfirmationPassword {
+				t.Errorf("Expected a generated password, got %q", u.Password)
+			}
+			u.SetID(4)
+			return nil
+		})
+		store.EXPECT().SetUserRole(4, models.RoleAdmin).Return(nil)
+
+		code, out, _ := run("users", "create", "-role", "admin", "a@fake.com")
+		if code != ExitOK || !strings.Contains(out, "generated password: ") || !strings.Contains(out, "created user 4") {
+			t.Errorf("Unexpected result %d %s", code, out)
+		}
+	})
+
+	t.Run("Create rejects unknown roles before opening the database", func(t *testing.T) {
+		if code, _, _ := run("users", "create", "-role", "owner", "a@fake.com"); code != ExitUsage {
+			t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
+		}
+	})
+
+	t.Run("List prints every user", func(t *testing.T) {
+		store.EXPECT().ListUsers().Return([]models.User{user, {Id: 5, Email: "b@fake.com", Role: models.RoleAdmin}}, nil)
+
+		code, out, _ := run("users", "list")
+		if code != ExitOK || !strings.Contains(out, "a@fake.com") || !strings.Contains(out, "b@fake.com") {
+			t.Errorf("Unexpected list %d %s", code, out)
+		}
+	})
+
+	t.Run("Set-role looks the user up by email", func(t *testing.T) {
+		store.EXPECT().GetUserByEmail("a@fake.com").Return(user, nil)
+		store.EXPECT().SetUserRole(4, models.RoleAdmin).Return(nil)
+
+		if code, _, _ := run("users", "set-role", "a@fake.com", "admin"); code != ExitOK {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	})
+
+	t.Run("Reset-password uses the given password", func(t *testing.T) {
+		store.EXPECT().GetUserByEmail("a@fake.com").Return(user, nil)
+		store.EXPECT().ResetPassword(4, "new-password").Return(nil)
+
+		code, out, _ := run("users", "reset-password", "-password", "new-password", "a@fake.com")
+		if code != ExitOK || strings.Contains(out, "generated password") {
+			t.Errorf("Unexpected result %d %s", code, out)
+		}
+	})
+
+	t.Run("Delete requires confirmation", func(t *testing.T) {
+		if code, _, _ := run("users", "delete", "a@fake.com"); code != ExitUsage {
+			t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
+		}
+
+		store.EXPECT().GetUserByEmail("a@fake.com").Return(user, nil)
+		store.EXPECT().DeleteUser(4).Return(nil)
+
+		if code, _, _ := run("users", "delete", "-yes", "a@fake.com"); code != ExitOK {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	})
+
+	t.Run("Restore finds the user in the trash", func(t *testing.T) {
+		store.EXPECT().DeletedUsers().Return([]models.User{user}, nil)
+		store.EXPECT().RestoreUser(4).Return(nil)
+
+		if code, out, _ := run("users", "restore", "a@fake.com"); code != ExitOK || !strings.Contains(out, "restored a@fake.com") {
+			t.Errorf("Unexpected result %d %s", code, out)
+		}
+
+		store.EXPECT().DeletedUsers().Return(nil, nil)
+
+		if code, _, errOut := run("users", "restore", "a@fake.com"); code != ExitError || !strings.Contains(errOut, "not in the trash") {
+			t.Errorf("Unexpected result %d %s", code, errOut)
+		}
+	})
+
+	t.Run("Database errors exit with an error", func(t *testing.T) {
+		store.EXPECT().GetUserByEmail("missing@fake.com").Return(models.User{}, &models.ModelError{FieldName: "User", ErrorText: "was not found"})
+
+		code, _, errOut := run("users", "set-role", "missing@fake.com", "user")
+		if code != ExitError || !strings.Contains(errOut, "User was not found") {
+			t.Errorf("Unexpected result %d %s", code, errOut)
+		}
+	})
+}
+
+func TestSessionsPurge(t *testing.T) {
+	store, run := setup(t)
+
+	t.Run("Every session", func(t *testing.T) {
+		store.EXPECT().PurgeSessions().Return(int64(3), nil)
+
+		if code, out, _ := run("sessions", "purge"); code != ExitOK || !strings.Contains(out, "ended 3 session(s)") {
+			t.Errorf("Unexpected result %d %s", code, out)
+		}
+	})
+
+	t.Run("A single user", func(t *testing.T) {
+		store.EXPECT().GetUserByEmail("a@fake.com").Return(models.User{Id: 4, Email: "a@fake.com"}, nil)
+		store.EXPECT().RemoveAllUserSessions(4).Return(nil)
+
+		if code, _, _ := run("sessions", "purge", "-user", "a@fake.com"); code != ExitOK {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	})
+}
+
+func TestSeed(t *testing.T) {
+	store, run := setup(t)
+
+	store.EXPECT().UserExists("admin@example.com").Return(true, nil)
+	store.EXPECT().UserExists("alice@example.com").Return(false, nil)
+	store.EXPECT().UserExists("bob@example.com").Return(false, errors.New("connection refused"))
+	store.EXPECT().CreateUser(gomock.Any()).DoAndReturn(func(ua models.UserAction) error {
+		ua.SetID(7)
+		return nil
+	})
+	store.EXPECT().CreatePost(gomock.Any()).DoAndReturn(func(pa models.PostAction) error {
+		if pa.Post().Author.Id != 7 {
+			t.Errorf("Expected the post to belong to the new user, got %d", pa.Post().Author.Id)
+		}
+		return nil
+	}).Times(2)
+
+	code, out, errOut := run("seed")
+	if code != ExitError || !strings.Contains(errOut, "connection refused") {
+		t.Errorf("Expected the database error to fail the command, got %d %s", code, errOut)
+	}
+
+	if !strings.Contains(out, "skipped admin@example.com") || !strings.Contains(out, "created alice@example.com") {
+		t.Errorf("Unexpected output %s", out)
+	}
+}
@@ -0,0 +1,436 @@
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+// Store is the database the commands work on, which *database.DB implements
+type Store interface {
+	database.Datastore
+	Migrate() error
+	MigrateDown(steps int) error
+	MigrationStatus() ([]database.MigrationStatus, error)
+	Close() error
+}
+
+// Tool builds the database commands. Open is only called by commands which need the database
+type Tool struct {
+	Open func() (Store, error)
+}
+
+func (t *Tool) withStore(f func(s Store) error) error {
+	s, err := t.Open()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return f(s)
+}
+
+// Commands returns the migrate, seed, users and sessions commands
+func (t *Tool) Commands() []*Command {
+	return []*Command{
+		{
+			Name:    "migrate",
+			Summary: "Apply, revert or list schema migrations",
+			Subcommands: []*Command{
+				{Name: "up", Summary: "Apply every pending migration", Run: t.migrateUp},
+				{Name: "down", Summary: "Revert the latest migrations", Run: t.migrateDown},
+				{Name: "status", Summary: "List migrations and whether they are applied", Run: t.migrateStatus},
+			},
+		},
+		{
+			Name:    "seed",
+			Summary: "Create demo users and posts",
+			Help: "Creates demo users, including an admin, and a few posts for each of them.\n" +
+				"Users which already exist are left alone, so seeding twice is safe.",
+			Run: t.seed,
+		},
+		{
+			Name:    "users",
+			Summary: "Manage users",
+			Subcommands: []*Command{
+				{Name: "create", Args: "<email>", Summary: "Create a user",
+					Help: "Creates a user. A random password is generated and printed unless -password is given.",
+					Run:  t.usersCreate},
+				{Name: "list", Summary: "List every user", Run: t.usersList},
+				{Name: "set-role", Args: "<email> <role>", Summary: "Change the role of a user",
+					Help: "Changes the role of a user to " + models.RoleUser + " or " + models.RoleAdmin + ".",
+					Run:  t.usersSetRole},
+				{Name: "reset-password", Args: "<email>", Summary: "Set a new password and log the user out",
+					Help: "Sets a new password without the previous one, and ends every session of the user.\n" +
+						"A random password is generated and printed unless -password is given.",
+					Run: t.usersResetPassword},
+				{Name: "delete", Args: "<email>", Summary: "Move a user with their posts to the trash",
+					Help: "Moves a user along with their posts to the trash and ends their sessions. Requires -yes.\n" +
+						"They can be restored until the trash is purged.",
+					Run: t.usersDelete},
+				{Name: "restore", Args: "<email>", Summary: "Restore a user from the trash",
+					Help: "Restores a user from the trash along with the posts deleted with them.",
+					Run:  t.usersRestore},
+			},
+		},
+		{
+			Name:    "sessions",
+			Summary: "Manage sessions",
+			Subcommands: []*Command{
+				{Name: "purge", Summary: "Log users out",
+					Help: "Ends every session, or only the sessions of -user.",
+					Run:  t.sessionsPurge},
+			},
+		},
+	}
+}
+
+func (t *Tool) migrateUp(c *Command, args []string) error {
+	if _, err := parse(c, c.Flags(), args, 0); err != nil {
+		return err
+	}
+
+	return t.withStore(func(s Store) error {
+		if err := s.Migrate(); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.Out(), "schema is at version %d\n", database.LatestVersion())
+		return nil
+	})
+}
+
+func (t *Tool) migrateDown(c *Command, args []string) error {
+	fs := c.Flags()
+	steps := fs.Int("steps", 1, "number of migrations to revert")
+	if _, err := parse(c, fs, args, 0); err != nil {
+		return err
+	}
+
+	if *steps < 1 {
+		return usageErrorf("-steps must be at least 1")
+	}
+
+	return t.withStore(func(s Store) error {
+		if err := s.MigrateDown(*steps); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.Out(), "reverted %d migration(s)\n", *steps)
+		return nil
+	})
+}
+
+func (t *Tool) migrateStatus(c *Command, args []string) error {
+	if _, err := parse(c, c.Flags(), args, 0); err != nil {
+		return err
+	}
+
+	return t.withStore(func(s Store) error {
+		status, err := s.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(c.Out(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, m := range status {
+			applied := "pending"
+			if m.Applied {
+				applied = m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", m.Version, m.Name, applied)
+		}
+
+		return tw.Flush()
+	})
+}
+
+// demoUsers are created by seed, each with the posts listed
+var demoUsers = []struct {
+	email string
+	role  string
+	posts []models.Post
+}{
+	{"admin@example.com", models.RoleAdmin, []models.Post{
+		{Title: "Welcome to simcha", Body: "This instance was seeded with demo data."},
+	}},
+	{"alice@example.com", models.RoleUser, []models.Post{
+		{Title: "Hello", Body: "My first post."},
+		{Title: "Testing", Body: "Go makes web applications easy to unit test."},
+	}},
+	{"bob@example.com", models.RoleUser, []models.Post{
+		{Title: "Hi all", Body: "Bob here."},
+	}},
+}
+
+func (t *Tool) seed(c *Command, args []string) error {
+	fs := c.Flags()
+	password := fs.String("password", "password", "password of every demo user")
+	if _, err := parse(c, fs, args, 0); err != nil {
+		return err
+	}
+
+	return t.withStore(func(s Store) error {
+		for _, d := range demoUsers {
+			if exists, err := s.UserExists(d.email); err != nil {
+				return err
+			} else if exists {
+				fmt.Fprintf(c.Out(), "skipped %s, which already exists\n", d.email)
+				continue
+			}
+
+			u := &models.User{Email: d.email}
+			u.SetPassword(*password, *password)
+			if err := s.CreateUser(u); err != nil {
+				return err
+			}
+
+			if d.role != models.RoleUser {
+				if err := s.SetUserRole(u.Id, d.role); err != nil {
+					return err
+				}
+			}
+
+			for _, p := range d.posts {
+				post := p
+				post.Author = *u
+				if err := s.CreatePost(&post); err != nil {
+					return err
+				}
+			}
+
+			fmt.Fprintf(c.Out(), "created %s (%s) with %d post(s)\n", d.email, d.role, len(d.posts))
+		}
+
+		return nil
+	})
+}
+
+// generatePassword returns a random password for users created or reset without one
+func generatePassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// passwordOrGenerated returns the password, or generates one and prints it
+func passwordOrGenerated(c *Command, password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(c.Out(), "generated password: %s\n", password)
+	return password, nil
+}
+
+func (t *Tool) usersCreate(c *Command, args []string) error {
+	fs := c.Flags()
+	role := fs.String("role", models.RoleUser, "role of the user, "+models.RoleUser+" or "+models.RoleAdmin)
+	password := fs.String("password", "", "password of the user, generated when empty")
+	args, err := parse(c, fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	if !models.ValidRole(*role) {
+		return usageErrorf("unknown role %q", *role)
+	}
+
+	return t.withStore(func(s Store) error {
+		pw, err := passwordOrGenerated(c, *password)
+		if err != nil {
+			return err
+		}
+
+		u := &models.User{Email: args[0]}
+		u.SetPassword(pw, pw)
+		if err := s.CreateUser(u); err != nil {
+			return err
+		}
+
+		if *role != models.RoleUser {
+			if err := s.SetUserRole(u.Id, *role); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(c.Out(), "created user %d %s (%s)\n", u.Id, u.Email, *role)
+		return nil
+	})
+}
+
+func (t *Tool) usersList(c *Command, args []string) error {
+	if _, err := parse(c, c.Flags(), args, 0); err != nil {
+		return err
+	}
+
+	return t.withStore(func(s Store) error {
+		users, err := s.ListUsers()
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(c.Out(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tEMAIL\tROLE\t2FA\tCREATED")
+		for _, u := range users {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%t\t%s\n", u.Id, u.Email, u.Role, u.TOTPEnabled, u.CreatedAt.Format("2006-01-02"))
+		}
+
+		return tw.Flush()
+	})
+}
+
+func (t *Tool) usersSetRole(c *Command, args []string) error {
+	args, err := parse(c, c.Flags(), args, 2)
+	if err != nil {
+		return err
+	}
+
+	email, role := args[0], args[1]
+	if !models.ValidRole(role) {
+		return usageErrorf("unknown role %q", role)
+	}
+
+	return t.withStore(func(s Store) error {
+		u, err := s.GetUserByEmail(email)
+		if err != nil {
+			return err
+		}
+
+		if err := s.SetUserRole(u.Id, role); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.Out(), "%s is now %s\n", email, role)
+		return nil
+	})
+}
+
+func (t *Tool) usersResetPassword(c *Command, args []string) error {
+	fs := c.Flags()
+	password := fs.String("password", "", "new password, generated when empty")
+	args, err := parse(c, fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return t.withStore(func(s Store) error {
+		u, err := s.GetUserByEmail(args[0])
+		if err != nil {
+			return err
+		}
+
+		pw, err := passwordOrGenerated(c, *password)
+		if err != nil {
+			return err
+		}
+
+		if err := s.ResetPassword(u.Id, pw); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.Out(), "reset the password of %s, and ended their sessions\n", u.Email)
+		return nil
+	})
+}
+
+func (t *Tool) usersDelete(c *Command, args []string) error {
+	fs := c.Flags()
+	yes := fs.Bool("yes", false, "confirm the user and their posts are moved to the trash")
+	args, err := parse(c, fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	if !*yes {
+		return usageErrorf("deleting %s also moves their posts to the trash, pass -yes to confirm", args[0])
+	}
+
+	return t.withStore(func(s Store) error {
+		u, err := s.GetUserByEmail(args[0])
+		if err != nil {
+			return err
+		}
+
+		if err := s.DeleteUser(u.Id); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.Out(), "moved %s to the trash\n", u.Email)
+		return nil
+	})
+}
+
+func (t *Tool) usersRestore(c *Command, args []string) error {
+	args, err := parse(c, c.Flags(), args, 1)
+	if err != nil {
+		return err
+	}
+
+	return t.withStore(func(s Store) error {
+		users, err := s.DeletedUsers()
+		if err != nil {
+			return err
+		}
+
+		for _, u := range users {
+			if u.Email != args[0] {
+				continue
+			}
+
+			if err := s.RestoreUser(u.Id); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(c.Out(), "restored %s\n", u.Email)
+			return nil
+		}
+
+		return fmt.Errorf("%s is not in the trash", args[0])
+	})
+}
+
+func (t *Tool) sessionsPurge(c *Command, args []string) error {
+	fs := c.Flags()
+	email := fs.String("user", "", "only end the sessions of the user with this email")
+	if _, err := parse(c, fs, args, 0); err != nil {
+		return err
+	}
+
+	return t.withStore(func(s Store) error {
+		if *email == "" {
+			n, err := s.PurgeSessions()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(c.Out(), "ended %d session(s)\n", n)
+			return nil
+		}
+
+		u, err := s.GetUserByEmail(*email)
+		if err != nil {
+			return err
+		}
+
+		if err := s.RemoveAllUserSessions(u.Id); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.Out(), "ended every session of %s\n", u.Email)
+		return nil
+	})
+}
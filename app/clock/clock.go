@@ -0,0 +1,28 @@
+/*
+Package clock tells the time and waits, behind an interface, so code depending on them can be tested with the fake
+clock of clocktest
+*/
+package clock
+
+import "time"
+
+// Clock tells the time and waits
+type Clock interface {
+	// Now returns the current time in UTC, as times are stored
+	Now() time.Time
+	// After sends the time on the channel once d has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,82 @@
+/*
+Package clocktest contains a fake clock, whose time only moves when tests advance it
+*/
+package clocktest
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a clock.Clock whose time is set by the test
+type Fake struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewFake returns a fake clock set to now
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the time the clock is set to
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// After returns a channel which receives the time once the clock is advanced by d
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- f.now
+		return c
+	}
+
+	f.waiters = append(f.waiters, waiter{at: f.now.Add(d), c: c})
+	f.changed.Broadcast()
+	return c
+}
+
+// Advance moves the clock forward by d, waking the callers of After whose time has come
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+
+	waiting := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			waiting = append(waiting, w)
+		} else {
+			w.c <- f.now
+		}
+	}
+	f.waiters = waiting
+	f.changed.Broadcast()
+}
+
+// BlockUntil waits until n callers of After are waiting, so a test advances the clock once the code under test waits
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.waiters) < n {
+		f.changed.Wait()
+	}
+}
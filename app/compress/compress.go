@@ -0,0 +1,329 @@
+/*
+Package compress compresses responses in the best encoding the client accepts,
+and serves the precompressed variants of static files when they exist.
+
+Responses are only compressed on the fly with gzip. The standard library has
+no brotli encoder, so br is limited to the precompressed .br files served by
+FileServer, unless an encoder is added with Register.
+*/
+package compress
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Encoder wraps w in a writer compressing into it
+type Encoder func(w io.Writer) (io.WriteCloser, error)
+
+// Gzip is the encoder registered by New
+func Gzip(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+}
+
+// DefaultMinSize is the smallest response New compresses. Below it the encoding overhead outweighs the savings
+const DefaultMinSize = 1024
+
+// skippedTypes are already compressed, so compressing them again only costs CPU
+var skippedTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/pdf",
+	"application/octet-stream",
+}
+
+// Compressible reports whether responses of the content type are worth compressing
+func Compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+
+	// SVG is XML text, unlike the other images
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+
+	for _, t := range skippedTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type encoding struct {
+	name string
+	enc  Encoder
+}
+
+// Compressor compresses responses with the registered encodings
+type Compressor struct {
+	// MinSize is the smallest response compressed
+	MinSize   int
+	encodings []encoding
+}
+
+// New creates a compressor with gzip. Other encodings, such as br from a third party package, may be added with Register
+func New(minSize int) *Compressor {
+	c := &Compressor{MinSize: minSize}
+	c.Register("gzip", Gzip)
+	return c
+}
+
+// Register adds an encoding. Encodings registered later are preferred when the client accepts them equally
+func (c *Compressor) Register(name string, enc Encoder) {
+	c.encodings = append([]encoding{{name: name, enc: enc}}, c.encodings...)
+}
+
+// Negotiate returns the registered encoding the client prefers, by the q-values of its Accept-Encoding header
+func (c *Compressor) Negotiate(acceptEncoding string) (string, Encoder) {
+	names := make([]string, len(c.encodings))
+	for i, e := range c.encodings {
+		names[i] = e.name
+	}
+
+	name := Negotiate(acceptEncoding, names)
+	for _, e := range c.encodings {
+		if e.name == name {
+			return e.name, e.enc
+		}
+	}
+
+	return "", nil
+}
+
+// Negotiate returns the first of the offered encodings with the highest q-value in the Accept-Encoding header, or an
+// empty string when the client accepts none of them
+func Negotiate(acceptEncoding string, offered []string) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+
+		value := 1.0
+		for _, p := range params[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(p), "="); ok && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					value = f
+				}
+			}
+		}
+		q[name] = value
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range offered {
+		value, ok := q[name]
+		if !ok {
+			value, ok = q["*"]
+		}
+		if ok && value > bestQ {
+			best, bestQ = name, value
+		}
+	}
+
+	return best
+}
+
+// Handler compresses the responses of next when the client accepts a registered encoding, they are at least MinSize
+// bytes, and their content type is Compressible
+func (c *Compressor) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the response depends on Accept-Encoding, whether or not this one is compressed
+		varyAcceptEncoding(w.Header())
+
+		name, enc := c.Negotiate(r.Header.Get("Accept-Encoding"))
+		if enc == nil || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &writer{ResponseWriter: w, name: name, enc: enc, minSize: c.MinSize}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// varyAcceptEncoding adds Accept-Encoding to the Vary header, unless it is already listed
+func varyAcceptEncoding(h http.Header) {
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), "Accept-Encoding") {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", "Accept-Encoding")
+}
+
+// writer buffers the start of the response, until it knows whether the response is worth compressing
+type writer struct {
+	http.ResponseWriter
+	name    string
+	enc     Encoder
+	minSize int
+
+	status  int
+	buf     []byte
+	decided bool
+	// out is the compressing writer, or nil when the response is written as is
+	out io.WriteCloser
+}
+
+func (w *writer) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if w.out != nil {
+		return w.out.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// decide compresses the response when big is set and its headers allow it, then writes the status and the buffer
+func (w *writer) decide(big bool) error {
+	w.decided = true
+	h := w.Header()
+
+	// without a Content-Type, net/http would sniff the compressed bytes
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	// the response is only encoded, and its ETag weakened, when there are bytes to encode
+	if big && len(w.buf) > 0 && w.compressible() {
+		out, err := w.enc(w.ResponseWriter)
+		if err != nil {
+			return err
+		}
+
+		w.out = out
+		h.Set("Content-Encoding", w.name)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+
+		// the compressed bytes differ, so a strong validator no longer holds
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	if w.out != nil {
+		_, err := w.out.Write(buf)
+		return err
+	}
+
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *writer) compressible() bool {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || w.status < 200 || w.status == http.StatusNoContent ||
+		w.status == http.StatusNotModified || w.status == http.StatusPartialContent {
+		return false
+	}
+
+	return Compressible(h.Get("Content-Type"))
+}
+
+// Close writes what is still buffered, uncompressed when the response stayed under MinSize, and ends the encoding
+func (w *writer) Close() error {
+	if !w.decided {
+		if w.status == 0 {
+			// nothing was written, let net/http send its default response
+			return nil
+		}
+
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+
+	if w.out != nil {
+		return w.out.Close()
+	}
+
+	return nil
+}
+
+// Flush sends what was written so far, compressing it when the response is compressed, for streamed responses
+func (w *writer) Flush() {
+	// nothing is sent before the first bytes of the body, which decide whether it is compressed
+	if !w.decided && len(w.buf) > 0 {
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+
+	if f, ok := w.out.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets websockets through, as long as nothing was written
+func (w *writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("compress: the response writer cannot be hijacked")
+	}
+
+	w.decided = true
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
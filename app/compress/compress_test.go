@@ -0,0 +1,244 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	offered := []string{"br", "gzip"}
+
+	cases := []struct {
+		header   string
+		expected string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"gzip;q=0, br;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.1, gzip;q=0", "br"},
+		{"identity", ""},
+		{"GZIP; Q=0.8", "gzip"},
+	}
+
+	for _, c := range cases {
+		if got := Negotiate(c.header, offered); got != c.expected {
+			t.Errorf("Expected %q to negotiate %q, got %q", c.header, c.expected, got)
+		}
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	for ct, expected := range map[string]bool{
+		"application/json":          true,
+		"text/html; charset=utf-8":  true,
+		"image/svg+xml":             true,
+		"image/png":                 false,
+		"font/woff2":                false,
+		"application/zip":           false,
+		"video/mp4":                 false,
+		"application/javascript":    true,
+		"application/octet-stream":  false,
+		"APPLICATION/GZIP; foo=bar": false,
+	} {
+		if got := Compressible(ct); got != expected {
+			t.Errorf("Expected %q compressible to be %t, got %t", ct, expected, got)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	big := strings.Repeat(`{"title":"post"},`, 200)
+
+	serve := func(acceptEncoding string, h http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/posts", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+
+		rr := httptest.NewRecorder()
+		New(DefaultMinSize).Handler(h).ServeHTTP(rr, req)
+		return rr
+	}
+
+	writeJSON := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "1")
+			w.Header().Set("ETag", `"v1"`)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(body[:len(body)/2]))
+			w.Write([]byte(body[len(body)/2:]))
+		}
+	}
+
+	t.Run("Large responses are gzipped", func(t *testing.T) {
+		rr := serve("gzip, deflate", writeJSON(big))
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("Expected status %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Expected a gzipped response varying on Accept-Encoding, got %v", rr.Header())
+		}
+		if rr.Header().Get("Content-Length") != "" {
+			t.Error("Expected the uncompressed Content-Length to be removed")
+		}
+		if rr.Header().Get("ETag") != `W/"v1"` {
+			t.Errorf("Expected the ETag to be weakened, got %s", rr.Header().Get("ETag"))
+		}
+
+		zr, err := gzip.NewReader(rr.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(zr)
+		if string(body) != big {
+			t.Error("Expected the body to decompress to the original")
+		}
+	})
+
+	t.Run("Small responses are sent as is", func(t *testing.T) {
+		rr := serve("gzip", writeJSON(`{"title":"post"}`))
+
+		if rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != `{"title":"post"}` {
+			t.Errorf("Expected an uncompressed body, got %q", rr.Body.String())
+		}
+		if rr.Code != http.StatusCreated || rr.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Expected the status and Vary to be kept, got %d %v", rr.Code, rr.Header())
+		}
+	})
+
+	t.Run("Empty responses keep their ETag", func(t *testing.T) {
+		rr := serve("gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		})
+
+		if rr.Header().Get("Content-Encoding") != "" || rr.Header().Get("ETag") != `"v1"` || rr.Body.Len() != 0 {
+			t.Errorf("Expected an empty response with a strong ETag, got %v %q", rr.Header(), rr.Body.String())
+		}
+	})
+
+	t.Run("Clients without a known encoding get the original", func(t *testing.T) {
+		rr := serve("identity", writeJSON(big))
+
+		if rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != big {
+			t.Error("Expected an uncompressed body")
+		}
+	})
+
+	t.Run("Compressed types are skipped", func(t *testing.T) {
+		rr := serve("gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(big))
+		})
+
+		if rr.Header().Get("Content-Encoding") != "" {
+			t.Error("Expected the image not to be compressed")
+		}
+	})
+
+	t.Run("The content type is sniffed from the uncompressed body", func(t *testing.T) {
+		rr := serve("gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<html>" + big))
+		})
+
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("Expected text/html, got %s", ct)
+		}
+	})
+
+	t.Run("Registered encodings are preferred", func(t *testing.T) {
+		c := New(0)
+		c.Register("test", func(w io.Writer) (io.WriteCloser, error) {
+			return nopCloser{w}, nil
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip, test")
+		rr := httptest.NewRecorder()
+		c.Handler(writeJSON(big)).ServeHTTP(rr, req)
+
+		if rr.Header().Get("Content-Encoding") != "test" {
+			t.Errorf("Expected the registered encoding, got %s", rr.Header().Get("Content-Encoding"))
+		}
+	})
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestFileServer(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.css"), []byte("body { color: red; }"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.css.gz"), []byte("gzipped"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.css.br"), []byte("brotli"), 0644)
+	os.WriteFile(filepath.Join(dir, "orphan.js.gz"), []byte("gzipped"), 0644)
+
+	serve := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+
+		rr := httptest.NewRecorder()
+		FileServer(http.Dir(dir)).ServeHTTP(rr, req)
+		return rr
+	}
+
+	cases := []struct {
+		path, acceptEncoding string
+		status               int
+		encoding, body       string
+	}{
+		{"/main.css", "gzip, br", http.StatusOK, "br", "brotli"},
+		{"/main.css", "gzip", http.StatusOK, "gzip", "gzipped"},
+		{"/main.css", "", http.StatusOK, "", "body { color: red; }"},
+		{"/main.css", "deflate", http.StatusOK, "", "body { color: red; }"},
+		{"/orphan.js", "gzip", http.StatusNotFound, "", ""},
+	}
+
+	for _, c := range cases {
+		rr := serve(c.path, c.acceptEncoding)
+
+		if rr.Code != c.status || rr.Header().Get("Content-Encoding") != c.encoding {
+			t.Errorf("Expected %s with %q to be %d %q, got %d %q",
+				c.path, c.acceptEncoding, c.status, c.encoding, rr.Code, rr.Header().Get("Content-Encoding"))
+		}
+
+		if c.status == http.StatusOK {
+			if rr.Body.String() != c.body {
+				t.Errorf("Expected %s with %q to serve %q, got %q", c.path, c.acceptEncoding, c.body, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/css") {
+				t.Errorf("Expected the type of the original file, got %s", ct)
+			}
+			if rr.Header().Get("Vary") != "Accept-Encoding" {
+				t.Error("Expected Vary: Accept-Encoding")
+			}
+		}
+	}
+
+	t.Run("Behind the compressor Vary is sent once", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/main.css", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+
+		rr := httptest.NewRecorder()
+		New(DefaultMinSize).Handler(FileServer(http.Dir(dir))).ServeHTTP(rr, req)
+
+		if vary := rr.Header().Values("Vary"); len(vary) != 1 {
+			t.Errorf("Expected a single Vary: Accept-Encoding, got %v", vary)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package compress
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// precompressed are the variants FileServer looks for, by their file extension
+var precompressed = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+// FileServer serves files like http.FileServer, but sends file.br or file.gz instead of file when it exists next to it
+// and the client accepts the encoding
+func FileServer(root http.FileSystem) http.Handler {
+	files := http.FileServer(root)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		varyAcceptEncoding(w.Header())
+
+		name := path.Clean("/" + r.URL.Path)
+		if !strings.HasSuffix(r.URL.Path, "/") && r.Header.Get("Accept-Encoding") != "" {
+			if serveVariant(w, r, root, name) {
+				return
+			}
+		}
+
+		files.ServeHTTP(w, r)
+	})
+}
+
+// serveVariant serves the precompressed variant of name the client prefers, reporting whether there was one
+func serveVariant(w http.ResponseWriter, r *http.Request, root http.FileSystem, name string) bool {
+	// only files which exist uncompressed have variants, so directories and missing files behave as usual
+	original, err := root.Open(name)
+	if err != nil {
+		return false
+	}
+	info, err := original.Stat()
+	original.Close()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	var offered []string
+	for _, encoding := range []string{"br", "gzip"} {
+		if f, err := root.Open(name + precompressed[encoding]); err == nil {
+			f.Close()
+			offered = append(offered, encoding)
+		}
+	}
+
+	encoding := Negotiate(r.Header.Get("Accept-Encoding"), offered)
+	if encoding == "" {
+		return false
+	}
+
+	f, err := root.Open(name + precompressed[encoding])
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	variant, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	h := w.Header()
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		h.Set("Content-Type", ct)
+	} else {
+		h.Set("Content-Type", "application/octet-stream")
+	}
+	h.Set("Content-Encoding", encoding)
+
+	http.ServeContent(w, r, name, variant.ModTime(), f)
+	return true
+}
@@ -1,11 +1,35 @@
 package config
 
 import (
-	"github.com/alexandersmanning/simcha/app/sessions"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/clock"
 	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/lockout"
+	"github.com/alexandersmanning/simcha/app/mailer"
+	"github.com/alexandersmanning/simcha/app/ratelimit"
+	"github.com/alexandersmanning/simcha/app/sessions"
 )
 
 type Env struct {
-	DB    database.Datastore
-	Store sessions.SessionStore
+	Config *Config
+
+	DB      database.Datastore
+	Store   sessions.SessionStore
+	Lockout *lockout.Guard
+	Mailer  mailer.Mailer
+
+	RateLimits ratelimit.Store
+
+	// Clock is the real clock unless set, by tests
+	Clock clock.Clock
+}
+
+// Now returns the current time of the Env's clock
+func (e *Env) Now() time.Time {
+	if e.Clock == nil {
+		return clock.Real.Now()
+	}
+
+	return e.Clock.Now()
 }
@@ -0,0 +1,426 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// MinSecretLength is the shortest APPLICATION_SECRET accepted, as it signs the session and CSRF cookies
+const MinSecretLength = 32
+
+// Config holds every setting of the server. Each field is read, from lowest to highest precedence, from its default,
+// the config file, the environment variable, and the command line flag named in its tags
+type Config struct {
+	DBConnection      string        `env:"DB_CONNECTION" flag:"db" secret:"true" usage:"postgres connection string"`
+	ApplicationSecret string        `env:"APPLICATION_SECRET" flag:"secret" secret:"true" usage:"key signing sessions and CSRF tokens"`
+	Port              int           `env:"PORT" flag:"port" default:"8080" usage:"port the server listens on"`
+	TLSCert           string        `env:"TLS_CERT" flag:"tls-cert" usage:"certificate file, serving HTTPS with TLS_KEY"`
+	TLSKey            string        `env:"TLS_KEY" flag:"tls-key" usage:"private key file of TLS_CERT"`
+	TLSDev            bool          `env:"TLS_DEV" flag:"tls-dev" usage:"serve HTTPS with a certificate signed by a generated local CA"`
+	TLSDevDir         string        `env:"TLS_DEV_DIR" flag:"tls-dev-dir" default:".tls" usage:"directory of the local CA and certificate generated by TLS_DEV"`
+	TLSRedirectAddr   string        `env:"TLS_REDIRECT_ADDR" flag:"tls-redirect-addr" usage:"address of a plain HTTP listener redirecting to HTTPS, such as :80"`
+	Domain            string        `env:"DOMAIN" flag:"domain" usage:"origin allowed to make cross origin requests, when CORS_ORIGINS is empty"`
+	CORSOrigins       []string      `env:"CORS_ORIGINS" flag:"cors-origins" usage:"comma separated origins allowed to make cross origin requests, such as https://*.example.com"`
+	CORSMethods       []string      `env:"CORS_METHODS" flag:"cors-methods" usage:"comma separated methods allowed in cross origin requests"`
+	CORSHeaders       []string      `env:"CORS_HEADERS" flag:"cors-headers" usage:"comma separated headers allowed in cross origin requests"`
+	CORSMaxAge        time.Duration `env:"CORS_MAX_AGE" flag:"cors-max-age" default:"10m" usage:"how long browsers may cache preflight responses"`
+	LogFormat         string        `env:"LOG_FORMAT" flag:"log-format" default:"json" usage:"json or text"`
+	LogLevel          string        `env:"LOG_LEVEL" flag:"log-level" default:"info" usage:"debug, info, warn or error"`
+	TraceExport       string        `env:"TRACE_EXPORT" flag:"trace-export" usage:"stdout, or a file spans are appended to"`
+	MetricsAddr       string        `env:"METRICS_ADDR" flag:"metrics-addr" usage:"separate address serving /metrics"`
+	MetricsToken      string        `env:"METRICS_TOKEN" flag:"metrics-token" secret:"true" usage:"bearer token required by /metrics"`
+	ShutdownGrace     time.Duration `env:"SHUTDOWN_GRACE" flag:"shutdown-grace" default:"15s" usage:"time in-flight requests have to finish on shutdown"`
+	ShutdownDrain     time.Duration `env:"SHUTDOWN_DRAIN" flag:"shutdown-drain" default:"5s" usage:"time /readyz reports not ready before the server stops accepting requests"`
+	CompressMinSize   int           `env:"COMPRESS_MIN_SIZE" flag:"compress-min-size" default:"1024" usage:"smallest response compressed, in bytes"`
+	CSP               string        `env:"CSP" flag:"csp" usage:"Content-Security-Policy replacing the default one, {nonce} is replaced by the request's nonce"`
+	CSPReportOnly     bool          `env:"CSP_REPORT_ONLY" flag:"csp-report-only" usage:"report CSP violations to /csp-report without blocking them"`
+	HSTSMaxAge        time.Duration `env:"HSTS_MAX_AGE" flag:"hsts-max-age" default:"4320h" usage:"max-age of Strict-Transport-Security on TLS requests, 0 to leave it out"`
+	RevisionsKeep     int           `env:"REVISIONS_KEEP" flag:"revisions-keep" usage:"revisions kept for each post, older ones are pruned hourly, 0 keeps every revision"`
+	RevisionsMaxAge   time.Duration `env:"REVISIONS_MAX_AGE" flag:"revisions-max-age" usage:"how long revisions are kept before they are pruned, 0 keeps them forever"`
+	PublishInterval   time.Duration `env:"PUBLISH_INTERVAL" flag:"publish-interval" default:"1m" usage:"how often scheduled posts are published, and the most they are published late by"`
+	TrashRetention    time.Duration `env:"TRASH_RETENTION" flag:"trash-retention" default:"720h" usage:"how long deleted posts and users can be restored before they are purged, 0 keeps them forever"`
+}
+
+// ConfigFileEnv names the config file when the -config flag is not given
+const ConfigFileEnv = "CONFIG_FILE"
+
+type field struct {
+	value  reflect.Value
+	name   string
+	env    string
+	flag   string
+	def    string
+	usage  string
+	secret bool
+}
+
+func (c *Config) fields() []field {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	fields := make([]field, t.NumField())
+	for i := range fields {
+		f := t.Field(i)
+		fields[i] = field{
+			value:  v.Field(i),
+			name:   f.Name,
+			env:    f.Tag.Get("env"),
+			flag:   f.Tag.Get("flag"),
+			def:    f.Tag.Get("default"),
+			usage:  f.Tag.Get("usage"),
+			secret: f.Tag.Get("secret") == "true",
+		}
+	}
+
+	return fields
+}
+
+func set(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(s)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case []string:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// Load reads the config with Read, then validates it
+func Load(args []string) (*Config, error) {
+	c, err := Read(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, c.Validate()
+}
+
+// Read reads the config from the defaults, the config file, the environment and args, the command line arguments
+// without the program name. The config file is given by -config or CONFIG_FILE
+func Read(args []string) (*Config, error) {
+	c := &Config{}
+	fields := c.fields()
+
+	for _, f := range fields {
+		if f.def != "" {
+			if err := set(f.value, f.def); err != nil {
+				return nil, fmt.Errorf("default %s: %v", f.name, err)
+			}
+		}
+	}
+
+	fs := flag.NewFlagSet("simcha", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(ConfigFileEnv), "YAML or TOML file to read the config from")
+	values := map[string]*string{}
+	for _, f := range fields {
+		values[f.flag] = new(string)
+		if f.value.Kind() == reflect.Bool {
+			fs.Var((*boolFlag)(values[f.flag]), f.flag, f.usage)
+		} else {
+			fs.StringVar(values[f.flag], f.flag, "", f.usage)
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *path != "" {
+		if err := c.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range fields {
+		if s, ok := os.LookupEnv(f.env); ok && s != "" {
+			if err := set(f.value, s); err != nil {
+				return nil, fmt.Errorf("%s: %v", f.env, err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.flag == fl.Name && err == nil {
+				if setErr := set(f.value, *values[f.flag]); setErr != nil {
+					err = fmt.Errorf("-%s: %v", f.flag, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// boolFlag lets boolean settings be given as -name, like flag.Bool, while storing the value as a string
+type boolFlag string
+
+func (b *boolFlag) String() string { return string(*b) }
+
+func (b *boolFlag) Set(s string) error {
+	*b = boolFlag(s)
+	return nil
+}
+
+func (b *boolFlag) IsBoolFlag() bool { return true }
+
+// loadFile reads a YAML or TOML file, keyed by the lower case environment names, such as port or db_connection.
+// Names may be split into sections, so grace under a shutdown section, or in a [shutdown] table in TOML, sets shutdown_grace.
+// Lists may be given as arrays or as comma separated strings
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &values)
+	case ".toml":
+		err = toml.Unmarshal(b, &values)
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	return c.setFile(path, "", values)
+}
+
+// setFile sets the fields named by the keys of values, prefixed by the sections they are in
+func (c *Config) setFile(path, prefix string, values map[string]interface{}) error {
+	byKey := map[string]field{}
+	for _, f := range c.fields() {
+		byKey[strings.ToLower(f.env)] = f
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := prefix + strings.ToLower(key)
+
+		if section, ok := values[key].(map[string]interface{}); ok {
+			if err := c.setFile(path, name+"_", section); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, ok := byKey[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown key %s", path, name)
+		}
+
+		value, err := fileValue(values[key])
+		if err == nil {
+			err = set(f.value, value)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", path, name, err)
+		}
+	}
+
+	return nil
+}
+
+// fileValue formats a decoded value like the environment variable setting it, joining arrays with commas
+func fileValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := fileValue(item)
+			if err != nil {
+				return "", err
+			}
+			if _, ok := item.([]interface{}); ok || strings.Contains(s, ",") {
+				return "", fmt.Errorf("list items cannot be lists or contain commas")
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// Validate returns every problem with the config
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.DBConnection == "" {
+		errs = append(errs, errors.New("DB_CONNECTION is required"))
+	}
+
+	if len(c.ApplicationSecret) < MinSecretLength {
+		errs = append(errs, fmt.Errorf("APPLICATION_SECRET must be at least %d characters", MinSecretLength))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT %d is not a valid port", c.Port))
+	}
+
+	if f := strings.ToLower(c.LogFormat); f != "json" && f != "text" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT %q must be json or text", c.LogFormat))
+	}
+
+	if _, err := c.Level(); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL %q must be debug, info, warn or error", c.LogLevel))
+	}
+
+	if c.ShutdownGrace <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_GRACE must be positive"))
+	}
+
+	for _, o := range c.Origins() {
+		if o == "*" {
+			errs = append(errs, errors.New("CORS_ORIGINS cannot contain *, as cross origin requests are sent with the session cookie"))
+		}
+	}
+
+	if c.ShutdownDrain < 0 {
+		errs = append(errs, errors.New("SHUTDOWN_DRAIN must not be negative"))
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		errs = append(errs, errors.New("TLS_CERT and TLS_KEY must be set together"))
+	}
+
+	if c.TLSDev && c.TLSCert != "" {
+		errs = append(errs, errors.New("TLS_DEV cannot be used with TLS_CERT"))
+	}
+
+	if c.TLSRedirectAddr != "" && !c.TLS() {
+		errs = append(errs, errors.New("TLS_REDIRECT_ADDR requires TLS_CERT or TLS_DEV"))
+	}
+
+	if c.CompressMinSize < 0 {
+		errs = append(errs, errors.New("COMPRESS_MIN_SIZE must not be negative"))
+	}
+
+	if c.HSTSMaxAge < 0 {
+		errs = append(errs, errors.New("HSTS_MAX_AGE must not be negative"))
+	}
+
+	if c.RevisionsKeep < 0 {
+		errs = append(errs, errors.New("REVISIONS_KEEP must not be negative"))
+	}
+
+	if c.RevisionsMaxAge < 0 {
+		errs = append(errs, errors.New("REVISIONS_MAX_AGE must not be negative"))
+	}
+
+	if c.PublishInterval <= 0 {
+		errs = append(errs, errors.New("PUBLISH_INTERVAL must be positive"))
+	}
+
+	if c.TrashRetention < 0 {
+		errs = append(errs, errors.New("TRASH_RETENTION must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Origins returns the origins allowed to make cross origin requests, falling back to Domain
+func (c *Config) Origins() []string {
+	if len(c.CORSOrigins) > 0 {
+		return c.CORSOrigins
+	}
+
+	if c.Domain != "" {
+		return []string{c.Domain}
+	}
+
+	return nil
+}
+
+// TLS reports whether the server speaks HTTPS, in which case cookies are only sent over TLS
+func (c *Config) TLS() bool {
+	return c.TLSCert != "" || c.TLSDev
+}
+
+// Level parses LogLevel
+func (c *Config) Level() (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(c.LogLevel))
+	return l, err
+}
+
+// Addr is the address the server listens on
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// Dump writes every setting, sorted by name, with secrets redacted, for debugging
+func (c *Config) Dump(w io.Writer) {
+	fields := c.fields()
+	sort.Slice(fields, func(i, j int) bool { return fields[i].env < fields[j].env })
+
+	for _, f := range fields {
+		value := fmt.Sprint(f.value.Interface())
+		if list, ok := f.value.Interface().([]string); ok {
+			value = strings.Join(list, ",")
+		}
+		if f.secret && value != "" {
+			value = "[redacted]"
+		}
+
+		fmt.Fprintf(w, "%s=%s\n", f.env, value)
+	}
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// setValidators sets the ETag and Last-Modified of the response, and has clients revalidate their copy before using it
+func setValidators(w http.ResponseWriter, etag string, lastModified time.Time) {
+	h := w.Header()
+	h.Set("ETag", etag)
+	if !lastModified.IsZero() {
+		h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	h.Set("Cache-Control", "no-cache")
+}
+
+// notModified answers 304 Not Modified, and returns true, when the If-None-Match or If-Modified-Since headers of the
+// request show the client's copy is current
+func notModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	// If-Modified-Since is ignored when If-None-Match is sent, as ETags are more precise
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err != nil ||
+		lastModified.IsZero() || lastModified.Truncate(time.Second).After(ims) {
+		return false
+	}
+
+	setValidators(w, etag, lastModified)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether etag is listed in an If-None-Match or If-Match header. W/ is ignored, since compression
+// weakens the ETags of responses without changing the post they describe
+func etagMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"encoding/json"
+	"github.com/alexandersmanning/simcha/app/logging"
 	"github.com/gorilla/csrf"
 	"net/http"
 )
@@ -12,7 +13,11 @@ type JSONResponse struct {
 	Error string `json:"error"`
 }
 
-func jsonError(w http.ResponseWriter, err error, status int) {
+func jsonError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error("request failed", "error", err, "status", status)
+	}
+
 	res := JSONResponse{Error: err.Error() }
 	resJSON, jsonErr := json.Marshal(res)
 	if jsonErr != nil {
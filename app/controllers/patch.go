@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/patch"
+)
+
+// ValidationResponse lists what is wrong with each invalid field
+type ValidationResponse struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields"`
+}
+
+func sendValidationErrors(w http.ResponseWriter, r *http.Request, errs models.ValidationErrors) {
+	body, err := json.Marshal(ValidationResponse{Error: "invalid fields", Fields: errs})
+	if err != nil {
+		jsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write(body)
+}
+
+// readPatch applies the patch in the request body to fields, the editable fields of a resource, answering the request
+// and returning false when the patch is invalid. Patches adding fields which are not editable are refused
+func readPatch(w http.ResponseWriter, r *http.Request, fields interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		jsonError(w, r, err, http.StatusBadRequest)
+		return false
+	}
+
+	doc, err := json.Marshal(fields)
+	if err != nil {
+		jsonError(w, r, err, http.StatusInternalServerError)
+		return false
+	}
+
+	patched, err := patch.Apply(r.Header.Get("Content-Type"), doc, body)
+
+	var patchErr *patch.Error
+	switch {
+	case errors.Is(err, patch.ErrUnsupportedType):
+		w.Header().Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+		jsonError(w, r, err, http.StatusUnsupportedMediaType)
+		return false
+	case errors.Is(err, patch.ErrTestFailed):
+		jsonError(w, r, err, http.StatusConflict)
+		return false
+	case errors.As(err, &patchErr):
+		jsonError(w, r, err, http.StatusUnprocessableEntity)
+		return false
+	case err != nil:
+		jsonError(w, r, err, http.StatusBadRequest)
+		return false
+	}
+
+	// fields removed by the patch must end up empty, rather than keep their previous value
+	v := reflect.ValueOf(fields).Elem()
+	v.Set(reflect.Zero(v.Type()))
+
+	d := json.NewDecoder(bytes.NewReader(patched))
+	d.DisallowUnknownFields()
+	if err := d.Decode(fields); err != nil {
+		jsonError(w, r, err, http.StatusUnprocessableEntity)
+		return false
+	}
+
+	return true
+}
@@ -4,26 +4,65 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/database"
 	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/policy"
+	"github.com/alexandersmanning/simcha/app/slug"
 	"github.com/julienschmidt/httprouter"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
+//PostIndex lists the published posts, along with the unpublished posts of the current user, or every post for admins
 func PostIndex(env *config.Env) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		user, err := env.Store.CurrentUser(db, r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		q, err := postQuery(r, user)
+		if err != nil {
+			jsonError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		// the list depends on who is logged in, so caches must not share it between users
+		w.Header().Add("Vary", "Cookie")
+
+		// the version is cheap to query, so clients with a current copy are answered without loading the posts
+		version, err := db.PostsVersion(q)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if notModified(w, r, version.ETag(), version.LastModified) {
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
-		posts, err := env.DB.AllPosts()
+		posts, err := db.AllPosts(q)
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
+		// posts may have changed since the version was queried, so the validators describe the list sent
+		version = models.VersionOf(posts)
+		setValidators(w, version.ETag(), version.LastModified)
+
 		body, err := json.Marshal(posts)
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
@@ -31,13 +70,44 @@ func PostIndex(env *config.Env) httprouter.Handle {
 	}
 }
 
+// postQuery selects the posts the user may read, only those with the tag or in the category named by ?tag= and
+// ?category= when they are given
+func postQuery(r *http.Request, user *models.User) (database.PostQuery, error) {
+	q := database.PostQuery{
+		ViewerId:    user.Id,
+		Unpublished: policy.Authorize(r.Context(), user, policy.PostReadAll, nil).Allowed,
+	}
+
+	var err error
+	if q.Tag, err = filterSlug(r, "tag"); err != nil {
+		return q, err
+	}
+	q.Category, err = filterSlug(r, "category")
+
+	return q, err
+}
+
+// filterSlug returns the slug of the tag or category named by the query parameter. One with no slug can name no post,
+// so it is refused rather than read as no filter
+func filterSlug(r *http.Request, name string) (string, error) {
+	value := r.URL.Query().Get(name)
+	s := slug.Make(value)
+	if s == "" && value != "" {
+		return "", errors.New(name + " " + models.NoSlug)
+	}
+
+	return s, nil
+}
+
 func PostCreate(env *config.Env) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
 		msg, err := ioutil.ReadAll(r.Body)
 		defer r.Body.Close()
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
@@ -45,42 +115,224 @@ func PostCreate(env *config.Env) httprouter.Handle {
 		err = json.Unmarshal(msg, &post)
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// posts are published right away unless they are created as drafts or scheduled
+		status, scheduledFor := post.Status, post.PublishedAt
+		if status == "" {
+			status = models.StatusPublished
+		}
+		post.Status, post.PublishedAt = "", nil
+		post.SetStatus(status, scheduledFor, env.Now())
+
+		if err := post.ValidateStatus(env.Now()); err != nil {
+			sendValidationErrors(w, r, err.(models.ValidationErrors))
+			return
+		}
+
+		if err := post.NormalizeTags(); err != nil {
+			sendValidationErrors(w, r, err.(models.ValidationErrors))
+			return
+		}
+		if err := post.Validate(); err != nil {
+			sendValidationErrors(w, r, err.(models.ValidationErrors))
 			return
 		}
 
-		user, err := env.Store.CurrentUser(env.DB, r)
+		user, err := env.Store.CurrentUser(db, r)
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
 		post.Author = *user
 
-		err = env.DB.CreatePost(&post)
+		err = db.CreatePost(&post)
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
 
 		jsonPost, err := json.Marshal(&post)
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 		}
 
 		sendJsonResponse(w, r, jsonPost)
 	}
 }
 
+// readPost loads the post in the URL, answering the request and returning false when it does not exist, or when the
+// current user may not read it, so unpublished posts are not found rather than forbidden
+func readPost(w http.ResponseWriter, r *http.Request, env *config.Env, db database.Datastore, p httprouter.Params) (*models.Post, bool) {
+	post, err := db.GetPostById(p.ByName("postId"))
+	return checkReadable(w, r, env, db, post, err)
+}
+
+// checkReadable answers the request and returns false when the post could not be loaded, does not exist, or may not
+// be read by the current user
+func checkReadable(w http.ResponseWriter, r *http.Request, env *config.Env, db database.Datastore, post *models.Post, err error) (*models.Post, bool) {
+	if err != nil {
+		jsonError(w, r, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if post.Id == 0 {
+		jsonError(w, r, errors.New("post not found"), http.StatusNotFound)
+		return nil, false
+	}
+
+	user, err := env.Store.CurrentUser(db, r)
+	if err != nil {
+		jsonError(w, r, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if !policy.Authorize(r.Context(), user, policy.PostRead, post).Allowed {
+		jsonError(w, r, errors.New("post not found"), http.StatusNotFound)
+		return nil, false
+	}
+
+	return post, true
+}
+
+//PostShow returns a single post, with its ETag for conditional updates
+func PostShow(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		if post, ok := readPost(w, r, env, db, p); ok {
+			sendPost(w, r, post)
+		}
+	}
+}
+
+//PermalinkPath is the path of the permalink of a post with the slug
+func PermalinkPath(slug string) string {
+	return "/p/" + url.PathEscape(slug)
+}
+
+//PostBySlug returns the post named by a slug, like PostShow. Slugs the post had before its title changed are
+//redirected to its current permalink
+func PostBySlug(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		slug := p.ByName("slug")
+		post, err := db.GetPostBySlug(slug)
+		post, ok := checkReadable(w, r, env, db, post, err)
+		if !ok {
+			return
+		}
+
+		if post.Slug != slug {
+			target := PermalinkPath(post.Slug)
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		sendPost(w, r, post)
+	}
+}
+
+// sendPost sends the post with its validators, or 304 when the client has this version already
+func sendPost(w http.ResponseWriter, r *http.Request, post *models.Post) {
+	if notModified(w, r, post.ETag(), post.ModifiedAt) {
+		return
+	}
+
+	body, err := json.Marshal(post)
+	if err != nil {
+		jsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	setValidators(w, post.ETag(), post.ModifiedAt)
+	sendJsonResponse(w, r, body)
+}
+
+// editorId returns the id of the logged in user, who is recorded as the author of the revision an edit creates
+func editorId(env *config.Env, db database.Datastore, r *http.Request) (int, error) {
+	user, err := env.Store.CurrentUser(db, r)
+	if err != nil {
+		return 0, err
+	}
+
+	return user.Id, nil
+}
+
+//ConflictResponse is sent when an update was based on a stale copy, with the current copy for the client to merge into
+type ConflictResponse struct {
+	Error   string       `json:"error"`
+	Current *models.Post `json:"current"`
+}
+
+func sendConflict(w http.ResponseWriter, r *http.Request, current *models.Post, status int) {
+	body, err := json.Marshal(ConflictResponse{Error: database.ErrStaleVersion.Error(), Current: current})
+	if err != nil {
+		jsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", current.ETag())
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// sendEditError answers an edit the store refused, with the current copy when the post was edited since, and 404 when
+// it was deleted since it was loaded
+func sendEditError(w http.ResponseWriter, r *http.Request, db database.Datastore, id string, err error) {
+	switch {
+	case errors.Is(err, database.ErrStaleVersion):
+		sendStale(w, r, db, id)
+	case errors.Is(err, database.ErrPostNotFound):
+		jsonError(w, r, err, http.StatusNotFound)
+	default:
+		jsonError(w, r, err, http.StatusInternalServerError)
+	}
+}
+
+// sendStale answers an edit refused with ErrStaleVersion with the current copy, and 412 when the edit was conditioned
+// by If-Match, or 409 otherwise. A post which is gone is not found rather than stale
+func sendStale(w http.ResponseWriter, r *http.Request, db database.Datastore, id string) {
+	current, err := db.GetPostById(id)
+	if err != nil {
+		jsonError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if current.Id == 0 {
+		jsonError(w, r, database.ErrPostNotFound, http.StatusNotFound)
+		return
+	}
+
+	status := http.StatusConflict
+	if r.Header.Get("If-Match") != "" {
+		status = http.StatusPreconditionFailed
+	}
+
+	sendConflict(w, r, current, status)
+}
+
+//PostUpdate replaces the title, body, tags and category of the post. With If-Match, or a version in the body, the edit is refused when the post was edited
+//since, with 412 or 409 respectively, and the current copy
 func PostUpdate(env *config.Env) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
 		bytes, err := ioutil.ReadAll(r.Body)
 		defer r.Body.Close()
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
@@ -88,32 +340,223 @@ func PostUpdate(env *config.Env) httprouter.Handle {
 		err = json.Unmarshal(bytes, &post)
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// the post in the URL is the one the permission was checked for
+		if id := p.ByName("postId"); id != "" {
+			if post.Id, err = strconv.Atoi(id); err != nil {
+				jsonError(w, r, errors.New("post Id must be a number"), http.StatusBadRequest)
+				return
+			}
+		}
+		id := strconv.Itoa(post.Id)
+
+		if err := post.NormalizeTags(); err != nil {
+			sendValidationErrors(w, r, err.(models.ValidationErrors))
+			return
+		}
+		if err := post.Validate(); err != nil {
+			sendValidationErrors(w, r, err.(models.ValidationErrors))
+			return
+		}
+
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			current, err := db.GetPostById(id)
+			if err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+
+			if current.Id == 0 {
+				jsonError(w, r, errors.New("post not found"), http.StatusNotFound)
+				return
+			}
+
+			if !etagMatches(ifMatch, current.ETag()) {
+				sendConflict(w, r, current, http.StatusPreconditionFailed)
+				return
+			}
+
+			// the edit only goes through if the post is still at the version If-Match named
+			post.Version = current.Version
+		}
+
+		if post.EditedBy, err = editorId(env, db, r); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
-		err = env.DB.EditPost(&post)
+		err = db.EditPost(&post)
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			sendEditError(w, r, db, id, err)
 			return
 		}
 
+		w.Header().Set("ETag", post.ETag())
 		res := JSONResponse{ Result: "success" }
 		jsonRes, err := json.Marshal(&res)
 		sendJsonResponse(w, r, jsonRes)
 	}
 }
 
+//postFields are the fields of a post clients may edit
+type postFields struct {
+	Title    string   `json:"title"`
+	Body     string   `json:"body"`
+	Tags     []string `json:"tags"`
+	Category string   `json:"category"`
+}
+
+//PostPatch applies a JSON Merge Patch or JSON Patch to the title, body, tags and category of the post in the URL. Like PostUpdate,
+//it honors If-Match, and refuses the edit when the post is edited by someone else before it is saved
+func PostPatch(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		id := p.ByName("postId")
+		current, err := db.GetPostById(id)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if current.Id == 0 {
+			jsonError(w, r, errors.New("post not found"), http.StatusNotFound)
+			return
+		}
+
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, current.ETag()) {
+			sendConflict(w, r, current, http.StatusPreconditionFailed)
+			return
+		}
+
+		// tags are an array even when there are none, so JSON Patch can append to them
+		fields := postFields{
+			Title:    current.Title,
+			Body:     current.Body,
+			Tags:     append([]string{}, current.Tags...),
+			Category: current.Category,
+		}
+		if !readPatch(w, r, &fields) {
+			return
+		}
+
+		// the edit is always conditioned on the version the patch was applied to
+		post := *current
+		post.Title, post.Body, post.Tags, post.Category = fields.Title, fields.Body, fields.Tags, fields.Category
+		if err := post.NormalizeTags(); err != nil {
+			sendValidationErrors(w, r, err.(models.ValidationErrors))
+			return
+		}
+
+		if err := post.Validate(); err != nil {
+			sendValidationErrors(w, r, err.(models.ValidationErrors))
+			return
+		}
+
+		if post.EditedBy, err = editorId(env, db, r); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		err = db.EditPost(&post)
+		if err != nil {
+			sendEditError(w, r, db, id, err)
+			return
+		}
+
+		body, err := json.Marshal(&post)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", post.ETag())
+		sendJsonResponse(w, r, body)
+	}
+}
+
+//statusFields are the fields of a post changed by PostStatus
+type statusFields struct {
+	Status      string     `json:"status"`
+	PublishedAt *time.Time `json:"publishedAt"`
+}
+
+//PostStatus moves the post in the URL through the publishing workflow: publishing, scheduling, archiving it or turning
+//it back into a draft. publishedAt is only read for scheduled posts. Like PostUpdate, it honors If-Match
+func PostStatus(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		id := p.ByName("postId")
+		current, err := db.GetPostById(id)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if current.Id == 0 {
+			jsonError(w, r, errors.New("post not found"), http.StatusNotFound)
+			return
+		}
+
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, current.ETag()) {
+			sendConflict(w, r, current, http.StatusPreconditionFailed)
+			return
+		}
+
+		var fields statusFields
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			jsonError(w, r, err, http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		now := env.Now()
+		post := *current
+		post.SetStatus(fields.Status, fields.PublishedAt, now)
+
+		if err := post.ValidateStatus(now); err != nil {
+			sendValidationErrors(w, r, err.(models.ValidationErrors))
+			return
+		}
+
+		if post.EditedBy, err = editorId(env, db, r); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		err = db.SetPostStatus(&post)
+		if err != nil {
+			sendEditError(w, r, db, id, err)
+			return
+		}
+
+		body, err := json.Marshal(&post)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", post.ETag())
+		sendJsonResponse(w, r, body)
+	}
+}
+
 func PostDelete(env *config.Env) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
 		id := p.ByName("postId")
 		if id == "" {
-			jsonError(w, errors.New("post Id must be provided"), http.StatusBadRequest)
+			jsonError(w, r, errors.New("post Id must be provided"), http.StatusBadRequest)
 			return
 		}
 
-		if err := env.DB.DeletePost(id); err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+		if err := db.DeletePost(id); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
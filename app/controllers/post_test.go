@@ -3,15 +3,20 @@ package controllers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/golang/mock/gomock"
 	"github.com/julienschmidt/httprouter"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alexandersmanning/simcha/app/clock/clocktest"
 	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/database"
 	"github.com/alexandersmanning/simcha/app/mocks/database"
 	"github.com/alexandersmanning/simcha/app/mocks/sessions"
 	"github.com/alexandersmanning/simcha/app/models"
@@ -25,13 +30,20 @@ func TestPostIndex(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
-	env := config.Env{DB: mockDatastore}
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(mockDatastore, req).Return(&models.User{}, nil)
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
 
 	var posts []*models.Post
 	posts = append(posts, &models.Post{Body: "Body Post 1", Title: "Title Post 1"})
 	posts = append(posts, &models.Post{Body: "Body Post 2", Title: "Title Post 2"})
 
-	mockDatastore.EXPECT().AllPosts().Return(posts, nil)
+	// anonymous users only see published posts
+	mockDatastore.EXPECT().PostsVersion(database.PostQuery{}).Return(models.VersionOf(posts), nil)
+	mockDatastore.EXPECT().AllPosts(database.PostQuery{}).Return(posts, nil)
 
 	PostIndex(&env)(rec, req, nil)
 
@@ -59,14 +71,133 @@ func TestPostIndex(t *testing.T) {
 	}
 }
 
-func TestPostCreate(t *testing.T) {
+func TestPostIndexConditional(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{}, nil).AnyTimes()
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
+
+	modified := time.Date(2026, 3, 1, 12, 30, 15, 500000000, time.UTC)
+	posts := []*models.Post{
+		{Id: 1, Title: "Title Post 1", ModifiedAt: modified.Add(-time.Hour)},
+		{Id: 2, Title: "Title Post 2", ModifiedAt: modified},
+	}
+	version := models.VersionOf(posts)
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/posts", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		rec := httptest.NewRecorder()
+		PostIndex(&env)(rec, req, nil)
+		return rec
+	}
+
+	t.Run("The list is sent with its validators", func(t *testing.T) {
+		mockDatastore.EXPECT().PostsVersion(gomock.Any()).Return(version, nil)
+		mockDatastore.EXPECT().AllPosts(gomock.Any()).Return(posts, nil)
+
+		rec := serve(nil)
+
+		checkStatus(rec.Code, http.StatusOK, t)
+		checkHeader(rec.HeaderMap, "Etag", version.ETag(), t)
+		checkHeader(rec.HeaderMap, "Last-Modified", "Sun, 01 Mar 2026 12:30:15 GMT", t)
+	})
+
+	t.Run("A matching ETag does not load the posts", func(t *testing.T) {
+		mockDatastore.EXPECT().PostsVersion(gomock.Any()).Return(version, nil)
+
+		rec := serve(map[string]string{"If-None-Match": `"stale", W/` + version.ETag()})
+
+		checkStatus(rec.Code, http.StatusNotModified, t)
+		checkHeader(rec.HeaderMap, "Etag", version.ETag(), t)
+		if rec.Body.Len() != 0 {
+			t.Errorf("Expected no body, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("A stale ETag gets the list, whatever its If-Modified-Since", func(t *testing.T) {
+		mockDatastore.EXPECT().PostsVersion(gomock.Any()).Return(version, nil)
+		mockDatastore.EXPECT().AllPosts(gomock.Any()).Return(posts, nil)
+
+		rec := serve(map[string]string{
+			"If-None-Match":     `"stale"`,
+			"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat),
+		})
+
+		checkStatus(rec.Code, http.StatusOK, t)
+	})
+
+	t.Run("If-Modified-Since is compared to the second", func(t *testing.T) {
+		mockDatastore.EXPECT().PostsVersion(gomock.Any()).Return(version, nil)
+
+		rec := serve(map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)})
+		checkStatus(rec.Code, http.StatusNotModified, t)
+
+		mockDatastore.EXPECT().PostsVersion(gomock.Any()).Return(version, nil)
+		mockDatastore.EXPECT().AllPosts(gomock.Any()).Return(posts, nil)
+
+		rec = serve(map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)})
+		checkStatus(rec.Code, http.StatusOK, t)
+	})
+}
+
+func TestPostIndexVisibility(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
 	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
 	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
 
+	tests := []struct {
+		name  string
+		user  models.User
+		query database.PostQuery
+	}{
+		{"Authors also see their unpublished posts", models.User{Id: 2}, database.PostQuery{ViewerId: 2}},
+		{"Admins see every post", models.User{Id: 1, Role: models.RoleAdmin}, database.PostQuery{ViewerId: 1, Unpublished: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/posts", nil)
+			user := test.user
+
+			mockSessionStore.EXPECT().CurrentUser(mockDatastore, req).Return(&user, nil)
+			mockDatastore.EXPECT().PostsVersion(test.query).Return(models.PostsVersion{}, nil)
+			mockDatastore.EXPECT().AllPosts(test.query).Return(nil, nil)
+
+			rec := httptest.NewRecorder()
+			PostIndex(&env)(rec, req, nil)
+
+			checkStatus(rec.Code, http.StatusOK, t)
+			checkHeader(rec.HeaderMap, "Vary", "Cookie", t)
+		})
+	}
+}
+
+func TestPostCreate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore, Clock: clocktest.NewFake(now)}
+
 	user := models.User{Id: 100, Email: "email@fake.com"}
 	post := models.Post{Body: "Test Create Body", Title: "Test Create Title", Author: user}
 	postJSON, err := json.Marshal(post)
@@ -79,6 +210,8 @@ func TestPostCreate(t *testing.T) {
 	rec := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/posts", postBuff)
 
+	// posts created without a status are published right away
+	post.Status, post.PublishedAt = models.StatusPublished, &now
 	mockDatastore.EXPECT().CreatePost(&post).Return(nil)
 	mockSessionStore.EXPECT().CurrentUser(mockDatastore, req).Return(&user, nil)
 
@@ -104,13 +237,192 @@ func TestPostCreate(t *testing.T) {
 	}
 }
 
+func TestPostCreateStatus(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{Id: 100}, nil).AnyTimes()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore, Clock: clocktest.NewFake(now)}
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/posts", bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		PostCreate(&env)(rec, req, nil)
+		return rec
+	}
+
+	expectCreate := func(status string, publishedAt *time.Time) {
+		mockDatastore.EXPECT().CreatePost(gomock.Any()).DoAndReturn(func(p models.PostAction) error {
+			post := p.Post()
+			if post.Status != status || !reflect.DeepEqual(post.PublishedAt, publishedAt) {
+				t.Errorf("Expected a %s post published at %v, got %s at %v", status, publishedAt, post.Status, post.PublishedAt)
+			}
+			return nil
+		})
+	}
+
+	t.Run("Drafts are not published, whatever publishedAt is sent", func(t *testing.T) {
+		expectCreate(models.StatusDraft, nil)
+
+		rec := serve(`{"title":"Draft","status":"draft","publishedAt":"2020-01-01T00:00:00Z"}`)
+		checkStatus(rec.Code, http.StatusOK, t)
+	})
+
+	t.Run("Scheduled posts are published at the time they are scheduled for", func(t *testing.T) {
+		at := now.Add(time.Hour)
+		expectCreate(models.StatusScheduled, &at)
+
+		rec := serve(`{"title":"Later","status":"scheduled","publishedAt":"` + at.Format(time.RFC3339) + `"}`)
+		checkStatus(rec.Code, http.StatusOK, t)
+	})
+
+	t.Run("Posts cannot be scheduled in the past", func(t *testing.T) {
+		rec := serve(`{"title":"Late","status":"scheduled","publishedAt":"` + now.Add(-time.Hour).Format(time.RFC3339) + `"}`)
+		checkStatus(rec.Code, http.StatusUnprocessableEntity, t)
+	})
+
+	t.Run("Unknown statuses are refused", func(t *testing.T) {
+		rec := serve(`{"title":"Odd","status":"hidden"}`)
+		checkStatus(rec.Code, http.StatusUnprocessableEntity, t)
+	})
+}
+
+func TestPostCreateValidation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+	mockDatastore.EXPECT().CreatePost(gomock.Any()).Times(0)
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{Id: 100}, nil).AnyTimes()
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
+
+	invalid := map[string]models.Post{
+		"Empty titles are refused": {Title: "  ", Body: "body"},
+		"Long titles are refused":  {Title: strings.Repeat("a", models.MaxTitleLength+1)},
+		"Long bodies are refused":  {Title: "title", Body: strings.Repeat("a", models.MaxBodyLength+1)},
+	}
+
+	for name, post := range invalid {
+		t.Run(name, func(t *testing.T) {
+			body, err := json.Marshal(post)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/posts", bytes.NewBuffer(body))
+			PostCreate(&env)(rec, req, nil)
+
+			checkStatus(rec.Code, http.StatusUnprocessableEntity, t)
+		})
+	}
+}
+
+func TestPostStatus(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{Id: 3}, nil).AnyTimes()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	published := now.Add(-24 * time.Hour)
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore, Clock: clocktest.NewFake(now)}
+	params := httprouter.Params{{Key: "postId", Value: "5"}}
+
+	serve := func(current models.Post, ifMatch, body string) *httptest.ResponseRecorder {
+		mockDatastore.EXPECT().GetPostById("5").Return(&current, nil)
+
+		req, _ := http.NewRequest("PUT", "/posts/5/status", bytes.NewBufferString(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		rec := httptest.NewRecorder()
+		PostStatus(&env)(rec, req, params)
+		return rec
+	}
+
+	expectStatus := func(status string, publishedAt *time.Time) {
+		mockDatastore.EXPECT().SetPostStatus(gomock.Any()).DoAndReturn(func(p models.PostAction) error {
+			post := p.Post()
+			if post.Status != status || !reflect.DeepEqual(post.PublishedAt, publishedAt) || post.Version != 2 || post.EditedBy != 3 {
+				t.Errorf("Expected version 2 to become %s at %v by user 3, got %+v", status, publishedAt, post)
+			}
+			post.Version++
+			return nil
+		})
+	}
+
+	draft := models.Post{Id: 5, Title: "Title", Status: models.StatusDraft, Version: 2}
+	live := models.Post{Id: 5, Title: "Title", Status: models.StatusPublished, PublishedAt: &published, Version: 2}
+
+	t.Run("Publishing a draft publishes it now", func(t *testing.T) {
+		expectStatus(models.StatusPublished, &now)
+
+		rec := serve(draft, `"5-2"`, `{"status":"published"}`)
+
+		checkStatus(rec.Code, http.StatusOK, t)
+		checkHeader(rec.HeaderMap, "Etag", `"5-3"`, t)
+	})
+
+	t.Run("Archived posts keep the time they were published at", func(t *testing.T) {
+		expectStatus(models.StatusArchived, &published)
+
+		checkStatus(serve(live, "", `{"status":"archived"}`).Code, http.StatusOK, t)
+	})
+
+	t.Run("Unpublishing a post turns it back into a draft", func(t *testing.T) {
+		expectStatus(models.StatusDraft, nil)
+
+		checkStatus(serve(live, "", `{"status":"draft"}`).Code, http.StatusOK, t)
+	})
+
+	t.Run("Scheduling requires a time in the future", func(t *testing.T) {
+		checkStatus(serve(draft, "", `{"status":"scheduled"}`).Code, http.StatusUnprocessableEntity, t)
+		checkStatus(serve(draft, "", `{"status":"scheduled","publishedAt":"2020-01-01T00:00:00Z"}`).Code, http.StatusUnprocessableEntity, t)
+	})
+
+	t.Run("A stale If-Match is refused", func(t *testing.T) {
+		checkStatus(serve(draft, `"5-1"`, `{"status":"published"}`).Code, http.StatusPreconditionFailed, t)
+	})
+
+	t.Run("A concurrent change is a conflict", func(t *testing.T) {
+		mockDatastore.EXPECT().SetPostStatus(gomock.Any()).Return(database.ErrStaleVersion)
+		mockDatastore.EXPECT().GetPostById("5").Return(&models.Post{Id: 5, Version: 3}, nil)
+
+		checkStatus(serve(draft, "", `{"status":"published"}`).Code, http.StatusConflict, t)
+	})
+
+	t.Run("A post deleted since it was loaded is not found", func(t *testing.T) {
+		mockDatastore.EXPECT().SetPostStatus(gomock.Any()).Return(database.ErrPostNotFound)
+
+		checkStatus(serve(draft, "", `{"status":"published"}`).Code, http.StatusNotFound, t)
+	})
+}
+
 func TestPostUpdate(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
 
-	env := config.Env{DB: mockDatastore}
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
 
 	post := models.Post{Title: "UpdatedTitle", Body: "UpdatedBody"}
 	post.SetTimestamps()
@@ -125,6 +437,10 @@ func TestPostUpdate(t *testing.T) {
 	rec := httptest.NewRecorder()
 	req, _ := http.NewRequest("PUT", "/posts", postBuff)
 
+	editor := models.User{Id: 3, Email: "editor@fake.com"}
+	post.EditedBy = editor.Id
+
+	mockSessionStore.EXPECT().CurrentUser(mockDatastore, req).Return(&editor, nil)
 	mockDatastore.EXPECT().EditPost(&post).Return(nil)
 	PostUpdate(&env)(rec, req, nil)
 
@@ -135,9 +451,267 @@ func TestPostUpdate(t *testing.T) {
 	}
 }
 
+func TestPostShow(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{}, nil).AnyTimes()
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
+	params := httprouter.Params{{Key: "postId", Value: "5"}}
+
+	t.Run("The post is sent with its ETag", func(t *testing.T) {
+		post := &models.Post{Id: 5, Title: "Title", Version: 3, Status: models.StatusPublished}
+		mockDatastore.EXPECT().GetPostById("5").Return(post, nil)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/posts/5", nil)
+		PostShow(&env)(rec, req, params)
+
+		checkStatus(rec.Code, http.StatusOK, t)
+		checkHeader(rec.HeaderMap, "Etag", `"5-3"`, t)
+	})
+
+	t.Run("Missing posts are not found", func(t *testing.T) {
+		mockDatastore.EXPECT().GetPostById("5").Return(&models.Post{}, nil)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/posts/5", nil)
+		PostShow(&env)(rec, req, params)
+
+		checkStatus(rec.Code, http.StatusNotFound, t)
+	})
+
+	t.Run("Drafts of other users are not found", func(t *testing.T) {
+		mockDatastore.EXPECT().GetPostById("5").Return(&models.Post{Id: 5, Author: models.User{Id: 2}, Status: models.StatusDraft}, nil)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/posts/5", nil)
+		PostShow(&env)(rec, req, params)
+
+		checkStatus(rec.Code, http.StatusNotFound, t)
+	})
+}
+
+func TestPostUpdateConcurrency(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{Id: 3}, nil).AnyTimes()
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
+	params := httprouter.Params{{Key: "postId", Value: "5"}}
+	current := &models.Post{Id: 5, Title: "Server Title", Body: "Server Body", Version: 4}
+
+	serve := func(ifMatch string, post models.Post) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(post)
+		req, _ := http.NewRequest("PUT", "/posts/5", bytes.NewBuffer(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		rec := httptest.NewRecorder()
+		PostUpdate(&env)(rec, req, params)
+		return rec
+	}
+
+	checkCurrent := func(rec *httptest.ResponseRecorder, t *testing.T) {
+		t.Helper()
+
+		var res ConflictResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Current == nil || res.Current.Title != current.Title || res.Current.Version != current.Version {
+			t.Errorf("Expected the current copy of the post, got %+v", res.Current)
+		}
+		checkHeader(rec.HeaderMap, "Etag", current.ETag(), t)
+	}
+
+	t.Run("A matching If-Match updates the post at that version", func(t *testing.T) {
+		mockDatastore.EXPECT().GetPostById("5").Return(current, nil)
+		mockDatastore.EXPECT().EditPost(gomock.Any()).DoAndReturn(func(p models.PostAction) error {
+			post := p.Post()
+			if post.Id != 5 || post.Version != 4 {
+				t.Errorf("Expected an edit of version 4 of post 5, got %+v", post)
+			}
+			post.Version++
+			return nil
+		})
+
+		rec := serve(`"5-4"`, models.Post{Title: "Edited"})
+
+		checkStatus(rec.Code, http.StatusOK, t)
+		checkHeader(rec.HeaderMap, "Etag", `"5-5"`, t)
+	})
+
+	t.Run("A stale If-Match is refused with the current copy", func(t *testing.T) {
+		mockDatastore.EXPECT().GetPostById("5").Return(current, nil)
+
+		rec := serve(`"5-3"`, models.Post{Title: "Edited"})
+
+		checkStatus(rec.Code, http.StatusPreconditionFailed, t)
+		checkCurrent(rec, t)
+	})
+
+	t.Run("An edit racing another one is refused", func(t *testing.T) {
+		mockDatastore.EXPECT().GetPostById("5").Return(current, nil).Times(2)
+		mockDatastore.EXPECT().EditPost(gomock.Any()).Return(database.ErrStaleVersion)
+
+		rec := serve(`"5-4"`, models.Post{Title: "Edited"})
+
+		checkStatus(rec.Code, http.StatusPreconditionFailed, t)
+		checkCurrent(rec, t)
+	})
+
+	t.Run("A stale version in the body is a conflict", func(t *testing.T) {
+		mockDatastore.EXPECT().EditPost(gomock.Any()).Return(database.ErrStaleVersion)
+		mockDatastore.EXPECT().GetPostById("5").Return(current, nil)
+
+		rec := serve("", models.Post{Title: "Edited", Version: 2})
+
+		checkStatus(rec.Code, http.StatusConflict, t)
+		checkCurrent(rec, t)
+	})
+
+	t.Run("Posts deleted since they were loaded are not found", func(t *testing.T) {
+		mockDatastore.EXPECT().EditPost(gomock.Any()).Return(database.ErrPostNotFound)
+
+		checkStatus(serve("", models.Post{Title: "Edited"}).Code, http.StatusNotFound, t)
+
+		mockDatastore.EXPECT().EditPost(gomock.Any()).Return(database.ErrStaleVersion)
+		mockDatastore.EXPECT().GetPostById("5").Return(&models.Post{}, nil)
+
+		checkStatus(serve("", models.Post{Title: "Edited", Version: 2}).Code, http.StatusNotFound, t)
+	})
+}
+
+func TestPostPatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{Id: 3}, nil).AnyTimes()
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
+	params := httprouter.Params{{Key: "postId", Value: "5"}}
+	author := models.User{Id: 2, Email: "author@fake.com"}
+
+	serve := func(contentType, ifMatch, body string) *httptest.ResponseRecorder {
+		current := &models.Post{Id: 5, Title: "Title", Body: "Body", Author: author, Version: 2}
+		mockDatastore.EXPECT().GetPostById("5").Return(current, nil)
+
+		req, _ := http.NewRequest("PATCH", "/posts/5", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		rec := httptest.NewRecorder()
+		PostPatch(&env)(rec, req, params)
+		return rec
+	}
+
+	expectEdit := func(title, body string) {
+		mockDatastore.EXPECT().EditPost(gomock.Any()).DoAndReturn(func(p models.PostAction) error {
+			post := p.Post()
+			if post.Id != 5 || post.Title != title || post.Body != body || post.Version != 2 || post.Author.Id != author.Id || post.EditedBy != 3 {
+				t.Errorf("Unexpected edit %+v", post)
+			}
+			post.Version++
+			return nil
+		})
+	}
+
+	t.Run("A merge patch only changes the fields it names", func(t *testing.T) {
+		expectEdit("New Title", "Body")
+
+		rec := serve("application/merge-patch+json", "", `{"title":"New Title"}`)
+
+		checkStatus(rec.Code, http.StatusOK, t)
+		checkHeader(rec.HeaderMap, "Etag", `"5-3"`, t)
+
+		var post models.Post
+		json.Unmarshal(rec.Body.Bytes(), &post)
+		if post.Title != "New Title" || post.Body != "Body" {
+			t.Errorf("Expected the patched post, got %+v", post)
+		}
+	})
+
+	t.Run("A JSON Patch is applied in order", func(t *testing.T) {
+		expectEdit("Title", "Title")
+
+		rec := serve("application/json-patch+json", `"5-2"`,
+			`[{"op":"test","path":"/body","value":"Body"},{"op":"copy","from":"/title","path":"/body"}]`)
+
+		checkStatus(rec.Code, http.StatusOK, t)
+	})
+
+	t.Run("A failed test operation is a conflict", func(t *testing.T) {
+		rec := serve("application/json-patch+json", "", `[{"op":"test","path":"/body","value":"Other"}]`)
+
+		checkStatus(rec.Code, http.StatusConflict, t)
+	})
+
+	t.Run("The id cannot be patched", func(t *testing.T) {
+		rec := serve("application/merge-patch+json", "", `{"id":9}`)
+
+		checkStatus(rec.Code, http.StatusUnprocessableEntity, t)
+	})
+
+	t.Run("Removing the title fails validation", func(t *testing.T) {
+		rec := serve("application/json-patch+json", "", `[{"op":"remove","path":"/title"}]`)
+
+		checkStatus(rec.Code, http.StatusUnprocessableEntity, t)
+
+		var v ValidationResponse
+		json.Unmarshal(rec.Body.Bytes(), &v)
+		if v.Fields["title"] == "" {
+			t.Errorf("Expected the title to be reported, got %+v", v)
+		}
+	})
+
+	t.Run("Other content types are unsupported", func(t *testing.T) {
+		rec := serve("text/plain", "", `title=x`)
+
+		checkStatus(rec.Code, http.StatusUnsupportedMediaType, t)
+		if rec.Header().Get("Accept-Patch") == "" {
+			t.Error("Expected Accept-Patch to list the supported formats")
+		}
+	})
+
+	t.Run("A stale If-Match is refused", func(t *testing.T) {
+		rec := serve("application/merge-patch+json", `"5-1"`, `{"title":"New Title"}`)
+
+		checkStatus(rec.Code, http.StatusPreconditionFailed, t)
+	})
+
+	t.Run("A concurrent edit is a conflict", func(t *testing.T) {
+		mockDatastore.EXPECT().EditPost(gomock.Any()).Return(database.ErrStaleVersion)
+		mockDatastore.EXPECT().GetPostById("5").Return(&models.Post{Id: 5, Title: "Theirs", Version: 3}, nil)
+
+		rec := serve("application/merge-patch+json", "", `{"title":"New Title"}`)
+
+		checkStatus(rec.Code, http.StatusConflict, t)
+	})
+}
+
 func TestPostDelete(t *testing.T) {
 	mockctrl := gomock.NewController(t)
 	mockdatastore := mockdatabase.NewMockDatastore(mockctrl)
+	mockdatastore.EXPECT().WithContext(gomock.Any()).Return(mockdatastore).AnyTimes()
 	env := config.Env{DB: mockdatastore}
 
 	r, _ := http.NewRequest("DELETE", "/post/2", nil)
@@ -175,3 +749,163 @@ func TestPostDelete(t *testing.T) {
 		}
 	})
 }
+
+func TestPostTags(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{Id: 2}, nil).AnyTimes()
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore, Clock: clocktest.NewFake(time.Now())}
+
+	expectTags := func(method string, tags []string, category string) {
+		check := func(p models.PostAction) error {
+			post := p.Post()
+			if !reflect.DeepEqual(post.Tags, tags) || post.Category != category {
+				t.Errorf("Expected tags %v in %q, got %v in %q", tags, category, post.Tags, post.Category)
+			}
+			return nil
+		}
+
+		if method == "POST" {
+			mockDatastore.EXPECT().CreatePost(gomock.Any()).DoAndReturn(check)
+		} else {
+			mockDatastore.EXPECT().EditPost(gomock.Any()).DoAndReturn(check)
+		}
+	}
+
+	t.Run("Tags and the category are saved as slugs", func(t *testing.T) {
+		expectTags("POST", []string{"go", "web-dev", "creme-brulee"}, "tutorials")
+
+		req, _ := http.NewRequest("POST", "/posts", bytes.NewBufferString(
+			`{"title":"Tagged","tags":["Go","web dev","GO","","Crème brûlée"],"category":"Tutorials"}`))
+		rec := httptest.NewRecorder()
+		PostCreate(&env)(rec, req, nil)
+
+		checkStatus(rec.Code, http.StatusOK, t)
+
+		var post models.Post
+		json.Unmarshal(rec.Body.Bytes(), &post)
+		if !reflect.DeepEqual(post.Tags, []string{"go", "web-dev", "creme-brulee"}) || post.Category != "tutorials" {
+			t.Errorf("Expected the tags in the response, got %+v", post)
+		}
+	})
+
+	t.Run("Too many tags are refused", func(t *testing.T) {
+		tags := make([]string, models.MaxTags+1)
+		for i := range tags {
+			tags[i] = fmt.Sprintf("tag%d", i)
+		}
+		body, _ := json.Marshal(models.Post{Title: "Tagged", Tags: tags})
+
+		req, _ := http.NewRequest("POST", "/posts", bytes.NewBuffer(body))
+		rec := httptest.NewRecorder()
+		PostCreate(&env)(rec, req, nil)
+
+		checkStatus(rec.Code, http.StatusUnprocessableEntity, t)
+	})
+
+	t.Run("Tags and categories with no slug are refused", func(t *testing.T) {
+		for _, body := range []string{
+			`{"title":"Tagged","tags":["go","日本語"]}`,
+			`{"title":"Tagged","tags":["!!!"]}`,
+			`{"title":"Tagged","category":"日本語"}`,
+		} {
+			req, _ := http.NewRequest("POST", "/posts", bytes.NewBufferString(body))
+			rec := httptest.NewRecorder()
+			PostCreate(&env)(rec, req, nil)
+
+			checkStatus(rec.Code, http.StatusUnprocessableEntity, t)
+		}
+	})
+
+	t.Run("JSON Patch appends tags", func(t *testing.T) {
+		current := &models.Post{Id: 5, Title: "Title", Author: models.User{Id: 2}, Tags: []string{"go"}, Category: "news"}
+		mockDatastore.EXPECT().GetPostById("5").Return(current, nil)
+		expectTags("PATCH", []string{"go", "sql"}, "news")
+
+		req, _ := http.NewRequest("PATCH", "/posts/5", bytes.NewBufferString(`[{"op":"add","path":"/tags/-","value":"SQL"}]`))
+		req.Header.Set("Content-Type", "application/json-patch+json")
+		rec := httptest.NewRecorder()
+		PostPatch(&env)(rec, req, httprouter.Params{{Key: "postId", Value: "5"}})
+
+		checkStatus(rec.Code, http.StatusOK, t)
+	})
+
+	t.Run("The list is filtered by tag and category", func(t *testing.T) {
+		q := database.PostQuery{ViewerId: 2, Tag: "web-dev", Category: "news"}
+		mockDatastore.EXPECT().PostsVersion(q).Return(models.PostsVersion{}, nil)
+		mockDatastore.EXPECT().AllPosts(q).Return(nil, nil)
+
+		req, _ := http.NewRequest("GET", "/posts?tag=Web+Dev&category=news", nil)
+		rec := httptest.NewRecorder()
+		PostIndex(&env)(rec, req, nil)
+
+		checkStatus(rec.Code, http.StatusOK, t)
+	})
+
+	t.Run("Filters with no slug are refused rather than ignored", func(t *testing.T) {
+		mockDatastore.EXPECT().PostsVersion(gomock.Any()).Times(0)
+		mockDatastore.EXPECT().AllPosts(gomock.Any()).Times(0)
+
+		for _, query := range []string{"tag=%E6%97%A5%E6%9C%AC%E8%AA%9E", "tag=!!!", "category=!!!"} {
+			req, _ := http.NewRequest("GET", "/posts?"+query, nil)
+			rec := httptest.NewRecorder()
+			PostIndex(&env)(rec, req, nil)
+
+			checkStatus(rec.Code, http.StatusBadRequest, t)
+		}
+	})
+}
+
+func TestPostBySlug(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{}, nil).AnyTimes()
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
+	post := &models.Post{Id: 5, Title: "Hello Again", Slug: "hello-again", Status: models.StatusPublished, Version: 2}
+
+	serve := func(path, slug string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		rec := httptest.NewRecorder()
+		PostBySlug(&env)(rec, req, httprouter.Params{{Key: "slug", Value: slug}})
+		return rec
+	}
+
+	t.Run("The current slug serves the post", func(t *testing.T) {
+		mockDatastore.EXPECT().GetPostBySlug("hello-again").Return(post, nil)
+
+		rec := serve("/p/hello-again", "hello-again")
+
+		checkStatus(rec.Code, http.StatusOK, t)
+		checkHeader(rec.HeaderMap, "Etag", post.ETag(), t)
+	})
+
+	t.Run("Previous slugs redirect to the current one", func(t *testing.T) {
+		mockDatastore.EXPECT().GetPostBySlug("hello").Return(post, nil)
+
+		rec := serve("/p/hello?ref=feed", "hello")
+
+		checkStatus(rec.Code, http.StatusMovedPermanently, t)
+		checkHeader(rec.HeaderMap, "Location", "/p/hello-again?ref=feed", t)
+	})
+
+	t.Run("Unknown slugs and unreadable posts are not found", func(t *testing.T) {
+		mockDatastore.EXPECT().GetPostBySlug("missing").Return(&models.Post{}, nil)
+		checkStatus(serve("/p/missing", "missing").Code, http.StatusNotFound, t)
+
+		draft := &models.Post{Id: 6, Slug: "draft-2", Status: models.StatusDraft, Author: models.User{Id: 9}}
+		mockDatastore.EXPECT().GetPostBySlug("draft").Return(draft, nil)
+		checkStatus(serve("/p/draft", "draft").Code, http.StatusNotFound, t)
+	})
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/diff"
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+// RevisionIndex lists the revisions of the post, newest first
+func RevisionIndex(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		if _, ok := readPost(w, r, env, db, p); !ok {
+			return
+		}
+
+		revisions, err := db.PostRevisions(p.ByName("postId"))
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		body, err := json.Marshal(revisions)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		sendJsonResponse(w, r, body)
+	}
+}
+
+// RevisionShow returns a single revision of the post
+func RevisionShow(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		if _, ok := readPost(w, r, env, db, p); !ok {
+			return
+		}
+
+		revision, ok := loadRevision(w, r, db, p)
+		if !ok {
+			return
+		}
+
+		body, err := json.Marshal(revision)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		sendJsonResponse(w, r, body)
+	}
+}
+
+// DiffResponse is the word level diff of the title and body between two revisions
+type DiffResponse struct {
+	From  int         `json:"from"`
+	To    int         `json:"to"`
+	Title []diff.Edit `json:"title"`
+	Body  []diff.Edit `json:"body"`
+}
+
+// RevisionDiff compares the revision in the URL with the one given by ?from=, the previous revision by default. With
+// ?format=unified, the diff is sent as text in the unified format, otherwise it is a DiffResponse
+func RevisionDiff(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		number, err := strconv.Atoi(p.ByName("rev"))
+		if err != nil {
+			jsonError(w, r, errors.New("revision must be a number"), http.StatusBadRequest)
+			return
+		}
+
+		fromNumber := -1
+		if s := r.URL.Query().Get("from"); s != "" {
+			if fromNumber, err = strconv.Atoi(s); err != nil {
+				jsonError(w, r, errors.New("from must be a revision number"), http.StatusBadRequest)
+				return
+			}
+		}
+
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "unified" && format != "words" {
+			jsonError(w, r, errors.New("format must be unified or words"), http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := readPost(w, r, env, db, p); !ok {
+			return
+		}
+
+		revisions, err := db.PostRevisions(p.ByName("postId"))
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// revisions are newest first, so the previous revision is the first older one. The first revision is compared
+		// with an empty post
+		var to, from *models.Revision
+		for _, rev := range revisions {
+			switch {
+			case rev.Number == number:
+				to = rev
+			case rev.Number == fromNumber, fromNumber < 0 && rev.Number < number && from == nil:
+				from = rev
+			}
+		}
+
+		if to == nil || (fromNumber >= 0 && from == nil) {
+			jsonError(w, r, errors.New("revision not found"), http.StatusNotFound)
+			return
+		}
+		if from == nil {
+			from = &models.Revision{}
+		}
+
+		if format == "unified" {
+			name := func(rev *models.Revision, field string) string {
+				return fmt.Sprintf("r%d/%s", rev.Number, field)
+			}
+
+			text := diff.Unified(name(from, "title"), name(to, "title"), from.Title+"\n", to.Title+"\n", diff.DefaultContext) +
+				diff.Unified(name(from, "body"), name(to, "body"), from.Body, to.Body, diff.DefaultContext)
+
+			w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+			w.Write([]byte(text))
+			return
+		}
+
+		body, err := json.Marshal(DiffResponse{
+			From:  from.Number,
+			To:    to.Number,
+			Title: diff.Words(from.Title, to.Title),
+			Body:  diff.Words(from.Body, to.Body),
+		})
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		sendJsonResponse(w, r, body)
+	}
+}
+
+// RevisionRestore edits the post back to the title and body of the revision in the URL, which saves them as a new
+// revision. Like PostUpdate, it honors If-Match
+func RevisionRestore(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		revision, ok := loadRevision(w, r, db, p)
+		if !ok {
+			return
+		}
+
+		id := p.ByName("postId")
+		post, err := db.GetPostById(id)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, post.ETag()) {
+			sendConflict(w, r, post, http.StatusPreconditionFailed)
+			return
+		}
+
+		if post.EditedBy, err = editorId(env, db, r); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		post.Title, post.Body = revision.Title, revision.Body
+		err = db.EditPost(post)
+		if err != nil {
+			sendEditError(w, r, db, id, err)
+			return
+		}
+
+		body, err := json.Marshal(post)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("ETag", post.ETag())
+		sendJsonResponse(w, r, body)
+	}
+}
+
+// loadRevision loads the revision named by the URL, answering the request and returning false when it does not exist
+func loadRevision(w http.ResponseWriter, r *http.Request, db database.Datastore, p httprouter.Params) (*models.Revision, bool) {
+	number, err := strconv.Atoi(p.ByName("rev"))
+	if err != nil {
+		jsonError(w, r, errors.New("revision must be a number"), http.StatusBadRequest)
+		return nil, false
+	}
+
+	revision, err := db.GetRevision(p.ByName("postId"), number)
+	if err != nil {
+		jsonError(w, r, err, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if revision.Number == 0 {
+		jsonError(w, r, errors.New("revision not found"), http.StatusNotFound)
+		return nil, false
+	}
+
+	return revision, true
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/diff"
+	"github.com/alexandersmanning/simcha/app/mocks/database"
+	"github.com/alexandersmanning/simcha/app/mocks/sessions"
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+func TestRevisionIndex(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{}, nil).AnyTimes()
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
+	params := httprouter.Params{{Key: "postId", Value: "5"}}
+
+	t.Run("It lists the revisions", func(t *testing.T) {
+		revisions := []*models.Revision{{PostId: 5, Number: 2, Title: "Second"}, {PostId: 5, Number: 1, Title: "First"}}
+		mockDatastore.EXPECT().GetPostById("5").Return(&models.Post{Id: 5, Status: models.StatusPublished}, nil)
+		mockDatastore.EXPECT().PostRevisions("5").Return(revisions, nil)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/posts/5/revisions", nil)
+		RevisionIndex(&env)(rec, req, params)
+
+		checkStatus(rec.Code, http.StatusOK, t)
+
+		var res []models.Revision
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		if len(res) != 2 || res[0].Number != 2 || res[1].Title != "First" {
+			t.Errorf("Expected the revisions, got %+v", res)
+		}
+	})
+
+	t.Run("Revisions of drafts are not found", func(t *testing.T) {
+		mockDatastore.EXPECT().GetPostById("5").Return(&models.Post{Id: 5, Author: models.User{Id: 2}, Status: models.StatusDraft}, nil)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/posts/5/revisions", nil)
+		RevisionIndex(&env)(rec, req, params)
+
+		checkStatus(rec.Code, http.StatusNotFound, t)
+	})
+}
+
+func TestRevisionDiff(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{}, nil).AnyTimes()
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
+	revisions := []*models.Revision{
+		{PostId: 5, Number: 3, Title: "Title", Body: "one two three\n"},
+		{PostId: 5, Number: 2, Title: "Title", Body: "one 2 three\n"},
+		{PostId: 5, Number: 1, Title: "Draft", Body: "one\n"},
+	}
+
+	serve := func(rev, query string) *httptest.ResponseRecorder {
+		mockDatastore.EXPECT().GetPostById("5").Return(&models.Post{Id: 5, Status: models.StatusPublished}, nil)
+		mockDatastore.EXPECT().PostRevisions("5").Return(revisions, nil)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/posts/5/revisions/"+rev+"/diff"+query, nil)
+		RevisionDiff(&env)(rec, req, httprouter.Params{{Key: "postId", Value: "5"}, {Key: "rev", Value: rev}})
+		return rec
+	}
+
+	t.Run("It compares with the previous revision by default", func(t *testing.T) {
+		rec := serve("3", "")
+
+		checkStatus(rec.Code, http.StatusOK, t)
+
+		var res DiffResponse
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		if res.From != 2 || res.To != 3 {
+			t.Errorf("Expected a diff from 2 to 3, got %d to %d", res.From, res.To)
+		}
+
+		expected := []diff.Edit{
+			{Op: diff.Equal, Text: "one "},
+			{Op: diff.Delete, Text: "2"},
+			{Op: diff.Insert, Text: "two"},
+			{Op: diff.Equal, Text: " three\n"},
+		}
+		if len(res.Body) != len(expected) {
+			t.Fatalf("Expected %v, got %v", expected, res.Body)
+		}
+		for i := range expected {
+			if res.Body[i] != expected[i] {
+				t.Errorf("Expected %v, got %v", expected, res.Body)
+			}
+		}
+	})
+
+	t.Run("It compares any two revisions as a unified diff", func(t *testing.T) {
+		rec := serve("3", "?from=1&format=unified")
+
+		checkStatus(rec.Code, http.StatusOK, t)
+
+		body := rec.Body.String()
+		for _, s := range []string{"--- r1/title\n+++ r3/title\n", "-Draft\n+Title\n", "-one\n+one two three\n"} {
+			if !strings.Contains(body, s) {
+				t.Errorf("Expected the diff to contain %q, got\n%s", s, body)
+			}
+		}
+	})
+
+	t.Run("The first revision is compared with an empty post", func(t *testing.T) {
+		rec := serve("1", "")
+
+		var res DiffResponse
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		if res.From != 0 || len(res.Title) != 1 || res.Title[0].Op != diff.Insert {
+			t.Errorf("Expected the title to be inserted, got %+v", res)
+		}
+	})
+
+	t.Run("Missing revisions are not found", func(t *testing.T) {
+		checkStatus(serve("4", "").Code, http.StatusNotFound, t)
+		checkStatus(serve("3", "?from=9").Code, http.StatusNotFound, t)
+	})
+}
+
+func TestRevisionRestore(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockSessionStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{Id: 3}, nil).AnyTimes()
+
+	env := config.Env{DB: mockDatastore, Store: mockSessionStore}
+	params := httprouter.Params{{Key: "postId", Value: "5"}, {Key: "rev", Value: "1"}}
+
+	serve := func(ifMatch string) *httptest.ResponseRecorder {
+		mockDatastore.EXPECT().GetRevision("5", 1).Return(&models.Revision{PostId: 5, Number: 1, Title: "Old", Body: "Old Body"}, nil)
+		mockDatastore.EXPECT().GetPostById("5").Return(&models.Post{Id: 5, Title: "New", Body: "New Body", Version: 4}, nil)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/posts/5/revisions/1/restore", nil)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		RevisionRestore(&env)(rec, req, params)
+		return rec
+	}
+
+	t.Run("It edits the post back to the revision", func(t *testing.T) {
+		mockDatastore.EXPECT().EditPost(gomock.Any()).DoAndReturn(func(p models.PostAction) error {
+			post := p.Post()
+			if post.Title != "Old" || post.Body != "Old Body" || post.Version != 4 || post.EditedBy != 3 {
+				t.Errorf("Unexpected edit %+v", post)
+			}
+			post.Version++
+			return nil
+		})
+
+		rec := serve(`"5-4"`)
+
+		checkStatus(rec.Code, http.StatusOK, t)
+		checkHeader(rec.HeaderMap, "Etag", `"5-5"`, t)
+	})
+
+	t.Run("A stale If-Match is refused", func(t *testing.T) {
+		checkStatus(serve(`"5-3"`).Code, http.StatusPreconditionFailed, t)
+	})
+
+	t.Run("A concurrent edit is a conflict", func(t *testing.T) {
+		mockDatastore.EXPECT().EditPost(gomock.Any()).Return(database.ErrStaleVersion)
+		mockDatastore.EXPECT().GetPostById("5").Return(&models.Post{Id: 5, Version: 5}, nil)
+
+		checkStatus(serve("").Code, http.StatusConflict, t)
+	})
+
+	t.Run("Missing revisions are not found", func(t *testing.T) {
+		mockDatastore.EXPECT().GetRevision("5", 1).Return(&models.Revision{}, nil)
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/posts/5/revisions/1/restore", nil)
+		RevisionRestore(&env)(rec, req, params)
+
+		checkStatus(rec.Code, http.StatusNotFound, t)
+	})
+}
@@ -2,44 +2,167 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/julienschmidt/httprouter"
 	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/logging"
+	"github.com/alexandersmanning/simcha/app/mailer"
+	"github.com/alexandersmanning/simcha/app/metrics"
 	"github.com/alexandersmanning/simcha/app/models"
 )
 
+var errTooManyAttempts = errors.New("too many login attempts, try again later")
+
+// logins counts login attempts, including second factors, by their result: success, failure or throttled
+var logins = metrics.Default.Counter("simcha_logins_total", "Number of login attempts by result.", "result")
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// throttled responds with a 429 if any of the keys still has to wait before its next attempt
+func throttled(env *config.Env, w http.ResponseWriter, r *http.Request, keys ...string) bool {
+	wait, err := env.Lockout.Wait(keys...)
+	if err != nil {
+		jsonError(w, r, err, http.StatusInternalServerError)
+		return true
+	}
+
+	if wait > 0 {
+		logins.Inc("throttled")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		jsonError(w, r, errTooManyAttempts, http.StatusTooManyRequests)
+		return true
+	}
+
+	return false
+}
+
+// loginFailed records the failure, and notifies the owner of the email if it has just been locked out.
+// The notice is only sent if the account exists, but the response is the same either way
+func loginFailed(env *config.Env, db database.Datastore, r *http.Request, email string, keys ...string) error {
+	logins.Inc("failure")
+
+	locked, err := env.Lockout.Fail(keys...)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range locked {
+		if k != emailKey(email) || env.Mailer == nil {
+			continue
+		}
+
+		exists, err := db.UserExists(email)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			logger := logging.FromContext(r.Context())
+			notice := lockoutNotice(email, env.Lockout.LockoutDuration)
+			go func() {
+				if err := env.Mailer.Send(notice); err != nil {
+					logger.Error("sending lockout notice failed", "error", err)
+				}
+			}()
+		}
+	}
+
+	return nil
+}
+
+func lockoutNotice(email string, d time.Duration) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Your account has been temporarily locked",
+		Body: "There have been too many failed attempts to log in to your account. " +
+			"Logging in has been disabled for " + d.String() + ". " +
+			"If this was not you, consider changing your password once the lock expires.",
+	}
+}
+
 func Login(env *config.Env) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
 		msg, err := ioutil.ReadAll(r.Body)
 		defer r.Body.Close()
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
 		var user models.User
 		if err := json.Unmarshal(msg, &user); err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
-		user, err = env.DB.GetUserByEmailAndPassword(user.Email, user.Password)
+		// the ip is only used to throttle, a successful login does not reset it
+		email := user.Email
+		keys := []string{emailKey(email), ipKey(r)}
+		if throttled(env, w, r, keys...) {
+			return
+		}
+
+		user, err = db.GetUserByEmailAndPassword(user.Email, user.Password)
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			if _, ok := err.(*models.ModelError); ok {
+				if err := loginFailed(env, db, r, email, keys...); err != nil {
+					jsonError(w, r, err, http.StatusInternalServerError)
+					return
+				}
+			}
+
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err := env.Lockout.Succeed(emailKey(email)); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
-		if err := env.Store.Login(&user, env.DB, w, r); err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+		// the session is only created once the second factor is verified in TwoFactorVerify
+		if user.TOTPEnabled {
+			if err := env.Store.BeginTwoFactor(&user, w, r); err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+
+			jsonResponse(w, r, TwoFactorRequired)
 			return
 		}
 
+		if err := env.Store.Login(&user, db, w, r); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		logins.Inc("success")
+
 		jsonUser, err := json.Marshal(&user)
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 		}
 
 		sendJsonResponse(w, r, jsonUser)
@@ -48,8 +171,10 @@ func Login(env *config.Env) httprouter.Handle {
 
 func Logout(env *config.Env) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		if err := env.Store.Logout(env.DB, w, r); err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+		db := env.DB.WithContext(r.Context())
+
+		if err := env.Store.Logout(db, w, r); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
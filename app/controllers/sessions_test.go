@@ -13,6 +13,9 @@ import (
 	"errors"
 	"github.com/alexandersmanning/simcha/app/mocks/database"
 	"github.com/alexandersmanning/simcha/app/mocks/sessions"
+	"github.com/alexandersmanning/simcha/app/lockout"
+	"github.com/alexandersmanning/simcha/app/mailer"
+	"time"
 )
 
 func TestLogin(t *testing.T) {
@@ -21,6 +24,7 @@ func TestLogin(t *testing.T) {
 
 	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
 	mockDataStore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDataStore.EXPECT().WithContext(gomock.Any()).Return(mockDataStore).AnyTimes()
 	env := config.Env{DB: mockDataStore, Store: mockSessionStore}
 	u := models.User{Email: "fake@email.com", Password: "thisisatestpassword"}
 
@@ -98,6 +102,8 @@ func TestLogout(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDataStore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDataStore.EXPECT().WithContext(gomock.Any()).Return(mockDataStore).AnyTimes()
+
 	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
 
 	env := &config.Env{DB: mockDataStore, Store: mockSessionStore}
@@ -152,3 +158,105 @@ func TestLogout(t *testing.T) {
 		}
 	})
 }
+
+type fakeMailer struct {
+	sent chan mailer.Message
+}
+
+func (f *fakeMailer) Send(m mailer.Message) error {
+	f.sent <- m
+	return nil
+}
+
+func TestLoginLockout(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockDataStore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDataStore.EXPECT().WithContext(gomock.Any()).Return(mockDataStore).AnyTimes()
+	fm := &fakeMailer{sent: make(chan mailer.Message, 1)}
+
+	guard := lockout.NewGuard(lockout.NewMemoryStore(time.Hour))
+	guard.FreeAttempts, guard.MaxFailures = 2, 3
+	env := config.Env{DB: mockDataStore, Store: mockSessionStore, Lockout: guard, Mailer: fm}
+
+	u := models.User{Email: "fake@email.com", Password: "wrongpassword"}
+	badCredentials := &models.ModelError{FieldName: "Email or Password", ErrorText: "was not found, or does not match our records"}
+
+	login := func(remoteAddr string) *httptest.ResponseRecorder {
+		jsonUser, err := json.Marshal(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(jsonUser))
+		req.RemoteAddr = remoteAddr
+		Login(&env)(rec, req, nil)
+		return rec
+	}
+
+	t.Run("Free attempts are not delayed", func(t *testing.T) {
+		mockDataStore.EXPECT().GetUserByEmailAndPassword(u.Email, u.Password).Return(models.User{}, badCredentials).Times(2)
+
+		login("10.0.0.1:1234")
+		rec := login("10.0.0.2:1234")
+		checkStatus(rec.Code, 500, t)
+	})
+
+	t.Run("Further attempts have to wait", func(t *testing.T) {
+		rec := login("10.0.0.3:1234")
+
+		checkStatus(rec.Code, 429, t)
+		if rec.Header().Get("Retry-After") == "" {
+			t.Error("Expected a Retry-After header")
+		}
+	})
+
+	t.Run("The owner is notified of a lockout", func(t *testing.T) {
+		guard.Now = func() time.Time { return time.Now().Add(time.Minute) }
+		mockDataStore.EXPECT().GetUserByEmailAndPassword(u.Email, u.Password).Return(models.User{}, badCredentials)
+		mockDataStore.EXPECT().UserExists(u.Email).Return(true, nil)
+
+		login("10.0.0.4:1234")
+
+		select {
+		case m := <-fm.sent:
+			if m.To != u.Email {
+				t.Errorf("Expected a notice to %s, got %s", u.Email, m.To)
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected a lockout notice to be sent")
+		}
+
+		guard.Now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		checkStatus(login("10.0.0.5:1234").Code, 429, t)
+	})
+
+	t.Run("Unknown emails get the same responses", func(t *testing.T) {
+		guard.Now = time.Now
+		unknown := u
+		unknown.Email = "unknown@email.com"
+		u, unknown = unknown, u
+		defer func() { u = unknown }()
+
+		mockDataStore.EXPECT().GetUserByEmailAndPassword(u.Email, u.Password).Return(models.User{}, badCredentials).Times(3)
+		mockDataStore.EXPECT().UserExists(u.Email).Return(false, nil)
+
+		for i := 0; i < 2; i++ {
+			checkStatus(login("10.0.1.1:1234").Code, 500, t)
+		}
+		checkStatus(login("10.0.1.2:1234").Code, 429, t)
+
+		guard.Now = func() time.Time { return time.Now().Add(time.Minute) }
+		login("10.0.1.3:1234")
+		checkStatus(login("10.0.1.4:1234").Code, 429, t)
+
+		select {
+		case m := <-fm.sent:
+			t.Errorf("Expected no notice for an unknown email, got %v", m)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
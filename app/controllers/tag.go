@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+// TagIndex lists the tags of the posts the current user may read, with how many of those posts each is on. Like
+// PostIndex, ?category= only counts the posts in that category
+func TagIndex(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		user, err := env.Store.CurrentUser(db, r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		q, err := postQuery(r, user)
+		if err != nil {
+			jsonError(w, r, err, http.StatusBadRequest)
+			return
+		}
+		q.Tag = ""
+
+		tags, err := db.Tags(q)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if tags == nil {
+			tags = []models.TagCount{}
+		}
+
+		body, err := json.Marshal(tags)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// the counts depend on who is logged in, so caches must not share them between users
+		w.Header().Add("Vary", "Cookie")
+		sendJsonResponse(w, r, body)
+	}
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/mocks/database"
+	"github.com/alexandersmanning/simcha/app/mocks/sessions"
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+func TestTagIndex(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDB.EXPECT().WithContext(gomock.Any()).Return(mockDB).AnyTimes()
+
+	mockSession := mocksession.NewMockSessionStore(mockCtrl)
+	env := &config.Env{DB: mockDB, Store: mockSession}
+
+	serve := func(url string, user models.User) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", url, nil)
+		mockSession.EXPECT().CurrentUser(mockDB, req).Return(&user, nil)
+
+		rec := httptest.NewRecorder()
+		TagIndex(env)(rec, req, nil)
+		return rec
+	}
+
+	t.Run("Tags are counted over the posts the user may read", func(t *testing.T) {
+		counts := []models.TagCount{{Tag: "go", Posts: 3}, {Tag: "sql", Posts: 1}}
+		mockDB.EXPECT().Tags(database.PostQuery{ViewerId: 2, Category: "news"}).Return(counts, nil)
+
+		rec := serve("/tags?category=News&tag=ignored", models.User{Id: 2})
+
+		checkStatus(rec.Code, http.StatusOK, t)
+		checkHeader(rec.HeaderMap, "Vary", "Cookie", t)
+
+		var got []models.TagCount
+		json.Unmarshal(rec.Body.Bytes(), &got)
+		if !reflect.DeepEqual(got, counts) {
+			t.Errorf("Expected %v, got %v", counts, got)
+		}
+	})
+
+	t.Run("No tags is an empty list", func(t *testing.T) {
+		mockDB.EXPECT().Tags(database.PostQuery{ViewerId: 1, Unpublished: true}).Return(nil, nil)
+
+		rec := serve("/tags", models.User{Id: 1, Role: models.RoleAdmin})
+
+		if body := rec.Body.String(); body != "[]" {
+			t.Errorf("Expected an empty list, got %s", body)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/policy"
+)
+
+// TrashResponse lists what the current user can restore. Only admins see the deleted users
+type TrashResponse struct {
+	Posts []*models.Post `json:"posts"`
+	Users []models.User  `json:"users,omitempty"`
+}
+
+// TrashIndex lists the posts of the current user in the trash, and the deleted users for admins
+func TrashIndex(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		subject, err := env.Store.CurrentUser(db, r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		res := TrashResponse{Posts: []*models.Post{}}
+		if posts, err := db.TrashedPosts(subject.Id); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		} else if posts != nil {
+			res.Posts = posts
+		}
+
+		if policy.Authorize(r.Context(), subject, policy.UserRestore, nil).Allowed {
+			if res.Users, err = db.DeletedUsers(); err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		body, err := json.Marshal(res)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		sendJsonResponse(w, r, body)
+	}
+}
+
+// TrashRestorePost takes a post out of the trash. Like deleting it, restoring is left to its author and admins
+func TrashRestorePost(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		subject, err := env.Store.CurrentUser(db, r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		post, err := db.GetTrashedPost(p.ByName("postId"))
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// posts of other users are reported as missing, so the trash does not reveal them
+		if post.Id == 0 || !policy.Authorize(r.Context(), subject, policy.PostRestore, post).Allowed {
+			jsonError(w, r, errors.New("post is not in the trash"), http.StatusNotFound)
+			return
+		}
+
+		err = db.RestorePost(p.ByName("postId"))
+		if errors.Is(err, database.ErrNotInTrash) {
+			jsonError(w, r, errors.New("the author of the post is in the trash"), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		post.DeletedAt = nil
+		body, err := json.Marshal(post)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		sendJsonResponse(w, r, body)
+	}
+}
+
+// TrashRestoreUser takes a user out of the trash along with the posts deleted with them. Only admins may restore users
+func TrashRestoreUser(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		id, err := strconv.Atoi(p.ByName("userId"))
+		if err != nil {
+			jsonError(w, r, errors.New("user Id must be a number"), http.StatusBadRequest)
+			return
+		}
+
+		subject, err := env.Store.CurrentUser(db, r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if d := policy.Authorize(r.Context(), subject, policy.UserRestore, &models.User{Id: id}); !d.Allowed {
+			jsonError(w, r, errors.New("only admins may restore users"), http.StatusForbidden)
+			return
+		}
+
+		err = db.RestoreUser(id)
+		if errors.Is(err, database.ErrNotInTrash) {
+			jsonError(w, r, errors.New("user is not in the trash"), http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		u, err := db.GetUserById(id)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		body, err := json.Marshal(u)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		sendJsonResponse(w, r, body)
+	}
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/mocks/database"
+	"github.com/alexandersmanning/simcha/app/mocks/sessions"
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+func TestTrash(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDB.EXPECT().WithContext(gomock.Any()).Return(mockDB).AnyTimes()
+
+	mockSession := mocksession.NewMockSessionStore(mockCtrl)
+
+	env := &config.Env{DB: mockDB, Store: mockSession}
+	author := models.User{Id: 7, Email: "author@fake.com", Role: models.RoleUser}
+	admin := models.User{Id: 1, Email: "admin@fake.com", Role: models.RoleAdmin}
+	deletedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	trashed := &models.Post{Id: 3, Title: "Gone", Author: author, DeletedAt: &deletedAt}
+
+	request := func(method, path string, subject models.User) (*httptest.ResponseRecorder, *http.Request) {
+		req, _ := http.NewRequest(method, path, nil)
+		mockSession.EXPECT().CurrentUser(mockDB, req).Return(&subject, nil)
+		return httptest.NewRecorder(), req
+	}
+
+	t.Run("Users list their own posts in the trash", func(t *testing.T) {
+		res, req := request("GET", "/trash", author)
+		mockDB.EXPECT().TrashedPosts(7).Return([]*models.Post{trashed}, nil)
+
+		TrashIndex(env)(res, req, nil)
+
+		checkStatus(res.Code, http.StatusOK, t)
+
+		var trash TrashResponse
+		json.Unmarshal(res.Body.Bytes(), &trash)
+		if len(trash.Posts) != 1 || trash.Posts[0].DeletedAt == nil || trash.Users != nil {
+			t.Errorf("Expected the trashed post only, got %+v", trash)
+		}
+	})
+
+	t.Run("Admins also see deleted users", func(t *testing.T) {
+		res, req := request("GET", "/trash", admin)
+		mockDB.EXPECT().TrashedPosts(1).Return(nil, nil)
+		mockDB.EXPECT().DeletedUsers().Return([]models.User{{Id: 9, DeletedAt: &deletedAt}}, nil)
+
+		TrashIndex(env)(res, req, nil)
+
+		var trash TrashResponse
+		json.Unmarshal(res.Body.Bytes(), &trash)
+		if trash.Posts == nil || len(trash.Users) != 1 {
+			t.Errorf("Expected an empty post list and the deleted user, got %+v", trash)
+		}
+	})
+
+	t.Run("Authors restore their posts", func(t *testing.T) {
+		res, req := request("POST", "/trash/posts/3/restore", author)
+		mockDB.EXPECT().GetTrashedPost("3").Return(trashed, nil)
+		mockDB.EXPECT().RestorePost("3").Return(nil)
+
+		TrashRestorePost(env)(res, req, httprouter.Params{{Key: "postId", Value: "3"}})
+
+		checkStatus(res.Code, http.StatusOK, t)
+
+		var post models.Post
+		json.Unmarshal(res.Body.Bytes(), &post)
+		if post.Id != 3 || post.DeletedAt != nil {
+			t.Errorf("Expected the restored post, got %+v", post)
+		}
+	})
+
+	t.Run("Posts of other users are not found", func(t *testing.T) {
+		res, req := request("POST", "/trash/posts/3/restore", models.User{Id: 8, Email: "other@fake.com"})
+		mockDB.EXPECT().GetTrashedPost("3").Return(trashed, nil)
+
+		TrashRestorePost(env)(res, req, httprouter.Params{{Key: "postId", Value: "3"}})
+
+		checkStatus(res.Code, http.StatusNotFound, t)
+	})
+
+	t.Run("Posts of deleted authors conflict", func(t *testing.T) {
+		res, req := request("POST", "/trash/posts/3/restore", admin)
+		mockDB.EXPECT().GetTrashedPost("3").Return(trashed, nil)
+		mockDB.EXPECT().RestorePost("3").Return(database.ErrNotInTrash)
+
+		TrashRestorePost(env)(res, req, httprouter.Params{{Key: "postId", Value: "3"}})
+
+		checkStatus(res.Code, http.StatusConflict, t)
+	})
+
+	t.Run("Only admins restore users", func(t *testing.T) {
+		params := httprouter.Params{{Key: "userId", Value: "9"}}
+
+		res, req := request("POST", "/trash/users/9/restore", author)
+		TrashRestoreUser(env)(res, req, params)
+		checkStatus(res.Code, http.StatusForbidden, t)
+
+		res, req = request("POST", "/trash/users/9/restore", admin)
+		mockDB.EXPECT().RestoreUser(9).Return(nil)
+		mockDB.EXPECT().GetUserById(9).Return(models.User{Id: 9}, nil)
+		TrashRestoreUser(env)(res, req, params)
+		checkStatus(res.Code, http.StatusOK, t)
+
+		res, req = request("POST", "/trash/users/9/restore", admin)
+		mockDB.EXPECT().RestoreUser(9).Return(database.ErrNotInTrash)
+		TrashRestoreUser(env)(res, req, params)
+		checkStatus(res.Code, http.StatusNotFound, t)
+	})
+}
@@ -0,0 +1,296 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/totp"
+)
+
+// TwoFactorRequired is the result returned by Login when the user still has to provide a code
+const TwoFactorRequired = "two_factor_required"
+
+// TwoFactorIssuer is the name shown next to the account in authenticator apps
+var TwoFactorIssuer = "simcha"
+
+// RecoveryCodeCount is the number of recovery codes handed out when two factor is enabled
+var RecoveryCodeCount = 10
+
+var errInvalidCode = errors.New("invalid two factor code")
+
+// TwoFactorCode is the request body for confirming, verifying and disabling two factor.
+// Either a code from the authenticator app or a recovery code can be provided
+type TwoFactorCode struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// TwoFactorEnrollment is returned when a user starts enrolling, the URI can be rendered as a QR code
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodes is returned once, when two factor is enabled
+type RecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
+
+func readTwoFactorCode(r *http.Request) (TwoFactorCode, error) {
+	var c TwoFactorCode
+
+	msg, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal(msg, &c)
+	return c, err
+}
+
+// useCode validates a code against the user's secret, and records it so it cannot be replayed within its period
+func useCode(db database.Datastore, u *models.User, code string) (bool, error) {
+	step, ok := totp.Step(u.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return db.UseTOTPStep(u.Id, step)
+}
+
+// checkSecondFactor validates a code against the user's secret, falling back to a recovery code
+func checkSecondFactor(db database.Datastore, u *models.User, c TwoFactorCode) (bool, error) {
+	if c.Code != "" {
+		return useCode(db, u, c.Code)
+	}
+
+	if c.RecoveryCode != "" {
+		return db.UseRecoveryCode(u.Id, c.RecoveryCode)
+	}
+
+	return false, nil
+}
+
+// TwoFactorEnroll creates a new secret for the current user, which is only enabled after TwoFactorConfirm
+func TwoFactorEnroll(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		u, err := env.Store.CurrentUser(db, r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		user, err := db.GetUserById(u.Id)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if user.TOTPEnabled {
+			jsonError(w, r, errors.New("two factor is already enabled"), http.StatusBadRequest)
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err := db.SetTOTPSecret(user.Id, secret); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(TwoFactorEnrollment{Secret: secret, URI: totp.URI(TwoFactorIssuer, user.Email, secret)})
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		sendJsonResponse(w, r, res)
+	}
+}
+
+// TwoFactorConfirm enables two factor once the user proves their app generates valid codes, returning recovery codes
+func TwoFactorConfirm(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		c, err := readTwoFactorCode(r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		u, err := env.Store.CurrentUser(db, r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		user, err := db.GetUserById(u.Id)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if user.TOTPSecret == "" {
+			jsonError(w, r, errors.New("two factor enrollment has not been started"), http.StatusBadRequest)
+			return
+		}
+
+		if ok, err := useCode(db, &user, c.Code); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		} else if !ok {
+			jsonError(w, r, errInvalidCode, http.StatusUnauthorized)
+			return
+		}
+
+		codes, err := totp.GenerateRecoveryCodes(RecoveryCodeCount)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err := db.EnableTOTP(user.Id, codes); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(RecoveryCodes{Codes: codes})
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		sendJsonResponse(w, r, res)
+	}
+}
+
+// TwoFactorDisable turns off two factor for the current user, requiring a valid code or recovery code
+func TwoFactorDisable(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		c, err := readTwoFactorCode(r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		u, err := env.Store.CurrentUser(db, r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		user, err := db.GetUserById(u.Id)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if !user.TOTPEnabled {
+			jsonError(w, r, errors.New("two factor is not enabled"), http.StatusBadRequest)
+			return
+		}
+
+		if ok, err := checkSecondFactor(db, &user, c); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		} else if !ok {
+			jsonError(w, r, errInvalidCode, http.StatusUnauthorized)
+			return
+		}
+
+		if err := db.DisableTOTP(user.Id); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		jsonResponse(w, r, "success")
+	}
+}
+
+// TwoFactorVerify completes a login started by Login for a user with two factor enabled
+func TwoFactorVerify(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		c, err := readTwoFactorCode(r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		id, err := env.Store.PendingTwoFactor(r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if id == 0 {
+			jsonError(w, r, errors.New("no login is waiting on a two factor code"), http.StatusUnauthorized)
+			return
+		}
+
+		key := "2fa:" + strconv.Itoa(id)
+		if throttled(env, w, r, key) {
+			return
+		}
+
+		user, err := db.GetUserById(id)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if ok, err := checkSecondFactor(db, &user, c); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		} else if !ok {
+			logins.Inc("failure")
+			if _, err := env.Lockout.Fail(key); err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+
+			jsonError(w, r, errInvalidCode, http.StatusUnauthorized)
+			return
+		}
+
+		if err := env.Lockout.Succeed(key); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err := env.Store.Login(&user, db, w, r); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		logins.Inc("success")
+
+		jsonUser, err := json.Marshal(&user)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		sendJsonResponse(w, r, jsonUser)
+	}
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/mocks/database"
+	"github.com/alexandersmanning/simcha/app/mocks/sessions"
+	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/totp"
+)
+
+const testSecret = "JBSWY3DPEHPK3PXP"
+
+func twoFactorRequest(t *testing.T, url string, c TwoFactorCode) *http.Request {
+	t.Helper()
+
+	body, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	return req
+}
+
+func currentCode(t *testing.T) string {
+	t.Helper()
+
+	code, err := totp.Code(testSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code
+}
+
+func TestLoginWithTwoFactor(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockDataStore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDataStore.EXPECT().WithContext(gomock.Any()).Return(mockDataStore).AnyTimes()
+	env := config.Env{DB: mockDataStore, Store: mockSessionStore}
+	u := models.User{Id: 1, Email: "fake@email.com", Password: "thisisatestpassword"}
+
+	jsonUser, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(jsonUser))
+
+	found := u
+	found.TOTPEnabled = true
+	mockDataStore.EXPECT().GetUserByEmailAndPassword(u.Email, u.Password).Return(found, nil)
+	mockSessionStore.EXPECT().BeginTwoFactor(&found, rec, req).Return(nil)
+	mockSessionStore.EXPECT().Login(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	Login(&env)(rec, req, nil)
+
+	checkStatus(rec.Code, 200, t)
+
+	var res JSONResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Result != TwoFactorRequired {
+		t.Errorf("Expected %s, got %s", TwoFactorRequired, res.Result)
+	}
+}
+
+func TestTwoFactorVerify(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockDataStore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDataStore.EXPECT().WithContext(gomock.Any()).Return(mockDataStore).AnyTimes()
+	env := config.Env{DB: mockDataStore, Store: mockSessionStore}
+	u := models.User{Id: 1, Email: "fake@email.com", TOTPSecret: testSecret, TOTPEnabled: true}
+
+	t.Run("Without a pending login", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := twoFactorRequest(t, "/login/2fa", TwoFactorCode{Code: "123456"})
+
+		mockSessionStore.EXPECT().PendingTwoFactor(req).Return(0, nil)
+
+		TwoFactorVerify(&env)(rec, req, nil)
+		checkStatus(rec.Code, 401, t)
+	})
+
+	t.Run("With a valid code", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := twoFactorRequest(t, "/login/2fa", TwoFactorCode{Code: currentCode(t)})
+
+		mockSessionStore.EXPECT().PendingTwoFactor(req).Return(u.Id, nil)
+		mockDataStore.EXPECT().GetUserById(u.Id).Return(u, nil)
+		mockDataStore.EXPECT().UseTOTPStep(u.Id, gomock.Any()).Return(true, nil)
+		mockSessionStore.EXPECT().Login(&u, env.DB, rec, req).Return(nil)
+
+		TwoFactorVerify(&env)(rec, req, nil)
+		checkStatus(rec.Code, 200, t)
+
+		msg, err := ioutil.ReadAll(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found models.User
+		if err := json.Unmarshal(msg, &found); err != nil {
+			t.Fatal(err)
+		}
+
+		if found.Email != u.Email {
+			t.Errorf("Expected %v, got %v", u, found)
+		}
+	})
+
+	t.Run("With a code which was already used", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := twoFactorRequest(t, "/login/2fa", TwoFactorCode{Code: currentCode(t)})
+
+		mockSessionStore.EXPECT().PendingTwoFactor(req).Return(u.Id, nil)
+		mockDataStore.EXPECT().GetUserById(u.Id).Return(u, nil)
+		mockDataStore.EXPECT().UseTOTPStep(u.Id, gomock.Any()).Return(false, nil)
+		mockSessionStore.EXPECT().Login(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		TwoFactorVerify(&env)(rec, req, nil)
+		checkStatus(rec.Code, 401, t)
+	})
+
+	t.Run("With an invalid code", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := twoFactorRequest(t, "/login/2fa", TwoFactorCode{Code: "000000"})
+
+		mockSessionStore.EXPECT().PendingTwoFactor(req).Return(u.Id, nil)
+		mockDataStore.EXPECT().GetUserById(u.Id).Return(u, nil)
+		mockSessionStore.EXPECT().Login(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		// a six digit code can collide with the current one, so make sure it does not
+		if totp.Validate(testSecret, "000000", time.Now()) {
+			t.Skip("current code happens to be 000000")
+		}
+
+		TwoFactorVerify(&env)(rec, req, nil)
+		checkStatus(rec.Code, 401, t)
+	})
+
+	t.Run("With a recovery code", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := twoFactorRequest(t, "/login/2fa", TwoFactorCode{RecoveryCode: "aaaaa-bbbbb"})
+
+		mockSessionStore.EXPECT().PendingTwoFactor(req).Return(u.Id, nil)
+		mockDataStore.EXPECT().GetUserById(u.Id).Return(u, nil)
+		mockDataStore.EXPECT().UseRecoveryCode(u.Id, "aaaaa-bbbbb").Return(true, nil)
+		mockSessionStore.EXPECT().Login(&u, env.DB, rec, req).Return(nil)
+
+		TwoFactorVerify(&env)(rec, req, nil)
+		checkStatus(rec.Code, 200, t)
+	})
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockDataStore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDataStore.EXPECT().WithContext(gomock.Any()).Return(mockDataStore).AnyTimes()
+	env := config.Env{DB: mockDataStore, Store: mockSessionStore}
+	current := models.User{Id: 1, Email: "fake@email.com"}
+
+	t.Run("Enroll returns a new secret", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/users/2fa/enroll", nil)
+
+		mockSessionStore.EXPECT().CurrentUser(env.DB, req).Return(&current, nil)
+		mockDataStore.EXPECT().GetUserById(current.Id).Return(current, nil)
+		mockDataStore.EXPECT().SetTOTPSecret(current.Id, gomock.Any()).Return(nil)
+
+		TwoFactorEnroll(&env)(rec, req, nil)
+		checkStatus(rec.Code, 200, t)
+
+		var res TwoFactorEnrollment
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Secret == "" || res.URI == "" {
+			t.Errorf("Expected a secret and uri, got %v", res)
+		}
+	})
+
+	t.Run("Confirm enables two factor and returns recovery codes", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := twoFactorRequest(t, "/users/2fa/confirm", TwoFactorCode{Code: currentCode(t)})
+
+		pending := current
+		pending.TOTPSecret = testSecret
+
+		mockSessionStore.EXPECT().CurrentUser(env.DB, req).Return(&current, nil)
+		mockDataStore.EXPECT().GetUserById(current.Id).Return(pending, nil)
+		mockDataStore.EXPECT().UseTOTPStep(current.Id, gomock.Any()).Return(true, nil)
+		mockDataStore.EXPECT().EnableTOTP(current.Id, gomock.Len(RecoveryCodeCount)).Return(nil)
+
+		TwoFactorConfirm(&env)(rec, req, nil)
+		checkStatus(rec.Code, 200, t)
+
+		var res RecoveryCodes
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Codes) != RecoveryCodeCount {
+			t.Errorf("Expected %d recovery codes, got %d", RecoveryCodeCount, len(res.Codes))
+		}
+	})
+
+	t.Run("Confirm without enrolling", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := twoFactorRequest(t, "/users/2fa/confirm", TwoFactorCode{Code: "123456"})
+
+		mockSessionStore.EXPECT().CurrentUser(env.DB, req).Return(&current, nil)
+		mockDataStore.EXPECT().GetUserById(current.Id).Return(current, nil)
+		mockDataStore.EXPECT().EnableTOTP(gomock.Any(), gomock.Any()).Times(0)
+
+		TwoFactorConfirm(&env)(rec, req, nil)
+		checkStatus(rec.Code, 400, t)
+	})
+
+	t.Run("Disable requires a valid code", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := twoFactorRequest(t, "/users/2fa/disable", TwoFactorCode{Code: currentCode(t)})
+
+		enabled := current
+		enabled.TOTPSecret, enabled.TOTPEnabled = testSecret, true
+
+		mockSessionStore.EXPECT().CurrentUser(env.DB, req).Return(&current, nil)
+		mockDataStore.EXPECT().GetUserById(current.Id).Return(enabled, nil)
+		mockDataStore.EXPECT().UseTOTPStep(current.Id, gomock.Any()).Return(true, nil)
+		mockDataStore.EXPECT().DisableTOTP(current.Id).Return(nil)
+
+		TwoFactorDisable(&env)(rec, req, nil)
+		checkStatus(rec.Code, 200, t)
+	})
+}
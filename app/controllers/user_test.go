@@ -9,6 +9,7 @@ import (
 	"github.com/alexandersmanning/simcha/app/mocks/sessions"
 	"github.com/alexandersmanning/simcha/app/models"
 	"github.com/golang/mock/gomock"
+	"github.com/julienschmidt/httprouter"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -22,6 +23,8 @@ func TestUserCreate(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDatastore.EXPECT().WithContext(gomock.Any()).Return(mockDatastore).AnyTimes()
+
 	mockSessionStore := mocksession.NewMockSessionStore(mockCtrl)
 
 	env := &config.Env{DB: mockDatastore, Store: mockSessionStore}
@@ -66,6 +69,8 @@ func TestCurrentUser(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockDB := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDB.EXPECT().WithContext(gomock.Any()).Return(mockDB).AnyTimes()
+
 	mockSession := mocksession.NewMockSessionStore(mockCtrl)
 
 	env := &config.Env{DB: mockDB, Store: mockSession}
@@ -127,3 +132,158 @@ func TestCurrentUser(t *testing.T) {
 		}
 	})
 }
+
+func TestUserPatch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDB.EXPECT().WithContext(gomock.Any()).Return(mockDB).AnyTimes()
+
+	mockSession := mocksession.NewMockSessionStore(mockCtrl)
+
+	env := &config.Env{DB: mockDB, Store: mockSession}
+	self := models.User{Id: 7, Email: "self@fake.com", Role: models.RoleUser}
+	admin := models.User{Id: 1, Email: "admin@fake.com", Role: models.RoleAdmin}
+	params := httprouter.Params{{Key: "userId", Value: "7"}}
+
+	serve := func(subject models.User, contentType, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PATCH", "/users/7", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+
+		mockSession.EXPECT().CurrentUser(mockDB, req).Return(&subject, nil)
+		mockDB.EXPECT().GetUserById(7).Return(self, nil)
+
+		res := httptest.NewRecorder()
+		UserPatch(env)(res, req, params)
+		return res
+	}
+
+	t.Run("Users change their own email with a merge patch", func(t *testing.T) {
+		mockDB.EXPECT().EmailTaken("new@fake.com").Return(false, nil)
+		mockDB.EXPECT().SetUserEmail(7, "new@fake.com").Return(nil)
+
+		res := serve(self, "application/merge-patch+json", `{"email":"new@fake.com"}`)
+
+		checkStatus(res.Code, http.StatusOK, t)
+
+		var u models.User
+		json.Unmarshal(res.Body.Bytes(), &u)
+		if u.Email != "new@fake.com" || u.Role != models.RoleUser {
+			t.Errorf("Expected the updated user, got %+v", u)
+		}
+	})
+
+	t.Run("Users cannot change their role", func(t *testing.T) {
+		res := serve(self, "application/json-patch+json", `[{"op":"replace","path":"/role","value":"admin"}]`)
+
+		checkStatus(res.Code, http.StatusForbidden, t)
+	})
+
+	t.Run("Admins change roles", func(t *testing.T) {
+		mockDB.EXPECT().SetUserRole(7, models.RoleAdmin).Return(nil)
+
+		res := serve(admin, "application/json-patch+json", `[{"op":"replace","path":"/role","value":"admin"}]`)
+
+		checkStatus(res.Code, http.StatusOK, t)
+	})
+
+	t.Run("Other users are forbidden", func(t *testing.T) {
+		res := serve(models.User{Id: 8, Email: "other@fake.com"}, "application/merge-patch+json", `{"email":"x@fake.com"}`)
+
+		checkStatus(res.Code, http.StatusForbidden, t)
+	})
+
+	t.Run("Fields are validated", func(t *testing.T) {
+		res := serve(self, "application/merge-patch+json", `{"email":"not an email","role":"owner"}`)
+
+		checkStatus(res.Code, http.StatusUnprocessableEntity, t)
+
+		var v ValidationResponse
+		json.Unmarshal(res.Body.Bytes(), &v)
+		if v.Fields["email"] == "" || v.Fields["role"] == "" {
+			t.Errorf("Expected email and role to be reported, got %+v", v)
+		}
+	})
+
+	t.Run("Fields which are not editable are refused", func(t *testing.T) {
+		res := serve(self, "application/merge-patch+json", `{"id":1}`)
+
+		checkStatus(res.Code, http.StatusUnprocessableEntity, t)
+	})
+
+	t.Run("Taken emails are refused", func(t *testing.T) {
+		mockDB.EXPECT().EmailTaken("admin@fake.com").Return(true, nil)
+
+		res := serve(self, "application/merge-patch+json", `{"email":"admin@fake.com"}`)
+
+		checkStatus(res.Code, http.StatusUnprocessableEntity, t)
+	})
+
+	t.Run("Emails of users in the trash are refused", func(t *testing.T) {
+		mockDB.EXPECT().UserExists(gomock.Any()).Times(0)
+		mockDB.EXPECT().EmailTaken("trashed@fake.com").Return(true, nil)
+		mockDB.EXPECT().SetUserEmail(gomock.Any(), gomock.Any()).Times(0)
+
+		res := serve(self, "application/merge-patch+json", `{"email":"trashed@fake.com"}`)
+
+		checkStatus(res.Code, http.StatusUnprocessableEntity, t)
+
+		var v ValidationResponse
+		json.Unmarshal(res.Body.Bytes(), &v)
+		if v.Fields["email"] != "is already taken" {
+			t.Errorf("Expected the email to be taken, got %+v", v)
+		}
+	})
+}
+
+func TestUserDelete(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDB.EXPECT().WithContext(gomock.Any()).Return(mockDB).AnyTimes()
+
+	mockSession := mocksession.NewMockSessionStore(mockCtrl)
+
+	env := &config.Env{DB: mockDB, Store: mockSession}
+	self := models.User{Id: 7, Email: "self@fake.com", Role: models.RoleUser}
+	admin := models.User{Id: 1, Email: "admin@fake.com", Role: models.RoleAdmin}
+	params := httprouter.Params{{Key: "userId", Value: "7"}}
+
+	serve := func(subject models.User) (*httptest.ResponseRecorder, *http.Request) {
+		req, _ := http.NewRequest("DELETE", "/users/7", nil)
+
+		mockSession.EXPECT().CurrentUser(mockDB, req).Return(&subject, nil)
+		mockDB.EXPECT().GetUserById(7).Return(self, nil)
+
+		return httptest.NewRecorder(), req
+	}
+
+	t.Run("Users delete their own account and are logged out", func(t *testing.T) {
+		res, req := serve(self)
+		mockDB.EXPECT().DeleteUser(7).Return(nil)
+		mockSession.EXPECT().Logout(mockDB, res, req).Return(nil)
+
+		UserDelete(env)(res, req, params)
+
+		checkStatus(res.Code, http.StatusOK, t)
+	})
+
+	t.Run("Admins delete other users and stay logged in", func(t *testing.T) {
+		res, req := serve(admin)
+		mockDB.EXPECT().DeleteUser(7).Return(nil)
+
+		UserDelete(env)(res, req, params)
+
+		checkStatus(res.Code, http.StatusOK, t)
+	})
+
+	t.Run("Other users are forbidden", func(t *testing.T) {
+		res, req := serve(models.User{Id: 8, Email: "other@fake.com"})
+
+		UserDelete(env)(res, req, params)
+
+		checkStatus(res.Code, http.StatusForbidden, t)
+	})
+}
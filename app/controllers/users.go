@@ -2,43 +2,48 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/julienschmidt/httprouter"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 
 	"github.com/alexandersmanning/simcha/app/config"
 	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/policy"
 )
 
 func UserCreate(env *config.Env) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
 		msg, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
 		var u models.User
 		if err := json.Unmarshal(msg, &u); err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
-		err = env.DB.CreateUser(&u)
+		err = db.CreateUser(&u)
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
-		if err := env.Store.Login(&u, env.DB, w, r); err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+		if err := env.Store.Login(&u, db, w, r); err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
 		res, err := json.Marshal(u)
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 		}
 
 		sendJsonResponse(w, r, res)
@@ -47,19 +52,171 @@ func UserCreate(env *config.Env) httprouter.Handle {
 
 func CurrentUser(env *config.Env) httprouter.Handle {
 	return func (w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		u, err := env.Store.CurrentUser(env.DB, r)
+		db := env.DB.WithContext(r.Context())
+
+		u, err := env.Store.CurrentUser(db, r)
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
 		jsonBytes, err := json.Marshal(u)
 
 		if err != nil {
-			jsonError(w, err, http.StatusInternalServerError)
+			jsonError(w, r, err, http.StatusInternalServerError)
 		}
 
 		sendJsonResponse(w, r, jsonBytes)
 	}
 }
+
+//userFields are the fields of a user's profile which can be edited. Only admins may change the role
+type userFields struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+//UserPatch applies a JSON Merge Patch or JSON Patch to the profile of the user in the URL, who must be the current
+//user or edited by an admin
+func UserPatch(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		id, err := strconv.Atoi(p.ByName("userId"))
+		if err != nil {
+			jsonError(w, r, errors.New("user Id must be a number"), http.StatusBadRequest)
+			return
+		}
+
+		subject, err := env.Store.CurrentUser(db, r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		u, err := db.GetUserById(id)
+		var notFound *models.ModelError
+		if errors.As(err, &notFound) {
+			jsonError(w, r, err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if d := policy.Authorize(r.Context(), subject, policy.UserUpdate, &u); !d.Allowed {
+			jsonError(w, r, errors.New("you may only edit your own profile"), http.StatusForbidden)
+			return
+		}
+
+		fields := userFields{Email: u.Email, Role: u.Role}
+		if !readPatch(w, r, &fields) {
+			return
+		}
+
+		errs := models.ValidationErrors{}
+		if !models.ValidEmail(fields.Email) {
+			errs["email"] = "must be a valid address"
+		}
+		if !models.ValidRole(fields.Role) {
+			errs["role"] = "must be " + models.RoleUser + " or " + models.RoleAdmin
+		}
+		if len(errs) > 0 {
+			sendValidationErrors(w, r, errs)
+			return
+		}
+
+		if fields.Role != u.Role {
+			if d := policy.Authorize(r.Context(), subject, policy.UserSetRole, &u); !d.Allowed {
+				jsonError(w, r, errors.New("only admins may change roles"), http.StatusForbidden)
+				return
+			}
+		}
+
+		if fields.Email != u.Email {
+			// users in the trash keep their email until they are purged, so it can not be taken yet
+			if exists, err := db.EmailTaken(fields.Email); err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			} else if exists {
+				sendValidationErrors(w, r, models.ValidationErrors{"email": "is already taken"})
+				return
+			}
+
+			if err := db.SetUserEmail(u.Id, fields.Email); err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+			u.Email = fields.Email
+		}
+
+		if fields.Role != u.Role {
+			if err := db.SetUserRole(u.Id, fields.Role); err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+			u.Role = fields.Role
+		}
+
+		res, err := json.Marshal(u)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		sendJsonResponse(w, r, res)
+	}
+}
+
+//UserDelete moves the user in the URL to the trash along with their posts, and ends their sessions. Users may delete
+//their own account, which also logs them out, and admins may delete anyone's
+func UserDelete(env *config.Env) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		db := env.DB.WithContext(r.Context())
+
+		id, err := strconv.Atoi(p.ByName("userId"))
+		if err != nil {
+			jsonError(w, r, errors.New("user Id must be a number"), http.StatusBadRequest)
+			return
+		}
+
+		subject, err := env.Store.CurrentUser(db, r)
+		if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		u, err := db.GetUserById(id)
+		var notFound *models.ModelError
+		if errors.As(err, &notFound) {
+			jsonError(w, r, err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if d := policy.Authorize(r.Context(), subject, policy.UserDelete, &u); !d.Allowed {
+			jsonError(w, r, errors.New("you may only delete your own account"), http.StatusForbidden)
+			return
+		}
+
+		if err := db.DeleteUser(u.Id); errors.As(err, &notFound) {
+			jsonError(w, r, err, http.StatusNotFound)
+			return
+		} else if err != nil {
+			jsonError(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if subject.Id == u.Id {
+			if err := env.Store.Logout(db, w, r); err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		jsonResponse(w, r, "Success")
+	}
+}
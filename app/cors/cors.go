@@ -0,0 +1,178 @@
+/*
+Package cors answers cross origin requests from an allowlist of origins, and
+short-circuits preflight requests before they reach the router or the CSRF check
+*/
+package cors
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy decides which origins may make cross origin requests, and what they may send
+type Policy struct {
+	// AllowedOrigins are full origins, such as https://example.com, wildcard subdomains, such as
+	// https://*.example.com, or * for any origin. Policies allowing credentials ignore *, as it would let any site
+	// make requests as the logged in user
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// DefaultMethods and DefaultHeaders are used by policies which do not list their own
+var (
+	DefaultMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+	DefaultHeaders = []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"}
+)
+
+// AllowsOrigin checks the origin against the allowlist
+func (p *Policy) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" && !p.AllowCredentials || strings.EqualFold(allowed, origin) || matchWildcard(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchWildcard matches https://*.example.com against any subdomain of example.com, with the same scheme and port
+func matchWildcard(pattern, origin string) bool {
+	i := strings.Index(pattern, "://*.")
+	if i < 0 {
+		return false
+	}
+
+	scheme, domain := strings.ToLower(pattern[:i]), strings.ToLower(pattern[i+len("://*"):])
+
+	u, err := url.Parse(origin)
+	if err != nil || strings.ToLower(u.Scheme) != scheme || u.Path != "" {
+		return false
+	}
+
+	host := strings.ToLower(u.Host)
+	return strings.HasSuffix(host, domain) && len(host) > len(domain)
+}
+
+func (p *Policy) methods() []string {
+	if len(p.AllowedMethods) == 0 {
+		return DefaultMethods
+	}
+
+	return p.AllowedMethods
+}
+
+func (p *Policy) headers() []string {
+	if len(p.AllowedHeaders) == 0 {
+		return DefaultHeaders
+	}
+
+	return p.AllowedHeaders
+}
+
+func (p *Policy) allowsMethod(method string) bool {
+	if method == http.MethodOptions {
+		return true
+	}
+
+	for _, m := range p.methods() {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type override struct {
+	prefix string
+	policy *Policy
+}
+
+// CORS applies the default policy, or the policy of the longest matching path prefix
+type CORS struct {
+	Default   *Policy
+	overrides []override
+}
+
+// New creates a CORS handler applying the policy to every path without an override
+func New(p *Policy) *CORS {
+	return &CORS{Default: p}
+}
+
+// Route overrides the policy for every path starting with prefix
+func (c *CORS) Route(prefix string, p *Policy) {
+	c.overrides = append(c.overrides, override{prefix: prefix, policy: p})
+}
+
+// PolicyFor returns the policy applied to the path
+func (c *CORS) PolicyFor(path string) *Policy {
+	p, longest := c.Default, -1
+	for _, o := range c.overrides {
+		if strings.HasPrefix(path, o.prefix) && len(o.prefix) > longest {
+			p, longest = o.policy, len(o.prefix)
+		}
+	}
+
+	return p
+}
+
+// Handler adds the CORS headers to responses for allowed origins, and answers preflight requests itself
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := c.PolicyFor(r.URL.Path)
+		origin := r.Header.Get("Origin")
+		h := w.Header()
+
+		// the response depends on the origin, so caches must not share it between origins
+		h.Add("Vary", "Origin")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+
+			if !p.AllowsOrigin(origin) || !p.allowsMethod(r.Header.Get("Access-Control-Request-Method")) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			allowOrigin(h, p, origin)
+			h.Set("Access-Control-Allow-Methods", strings.Join(p.methods(), ", "))
+			h.Set("Access-Control-Allow-Headers", strings.Join(p.headers(), ", "))
+			if p.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if p.AllowsOrigin(origin) {
+			allowOrigin(h, p, origin)
+			if len(p.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowOrigin echoes the origin rather than *, which browsers refuse alongside credentials
+func allowOrigin(h http.Header, p *Policy, origin string) {
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,130 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAllowsOrigin(t *testing.T) {
+	p := &Policy{AllowedOrigins: []string{"https://simcha.dev", "https://*.example.com", "http://*.local.test:8080"}}
+
+	cases := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://simcha.dev", true},
+		{"https://SIMCHA.dev", true},
+		{"http://simcha.dev", false},
+		{"https://app.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},
+		{"https://evilexample.com", false},
+		{"http://app.example.com", false},
+		{"https://app.example.com:8443", false},
+		{"http://app.local.test:8080", true},
+		{"http://app.local.test", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		if got := p.AllowsOrigin(c.origin); got != c.allowed {
+			t.Errorf("Expected %q allowed to be %t, got %t", c.origin, c.allowed, got)
+		}
+	}
+
+	if !(&Policy{AllowedOrigins: []string{"*"}}).AllowsOrigin("https://anything.io") {
+		t.Error("Expected * to allow any origin")
+	}
+
+	if (&Policy{AllowedOrigins: []string{"*"}, AllowCredentials: true}).AllowsOrigin("https://anything.io") {
+		t.Error("Expected * to be ignored when credentials are allowed")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := New(&Policy{
+		AllowedOrigins:   []string{"https://simcha.dev"},
+		ExposedHeaders:   []string{"X-CSRF-Token"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	c.Route("/public/", &Policy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}})
+
+	var reached bool
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	serve := func(method, path, origin, requestMethod string) *httptest.ResponseRecorder {
+		reached = false
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", requestMethod)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Preflights are answered without reaching the next handler", func(t *testing.T) {
+		rec := serve("OPTIONS", "/posts", "https://simcha.dev", "PUT")
+
+		if reached || rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected a 204 short-circuit, got %d (reached %t)", rec.Code, reached)
+		}
+
+		expected := map[string]string{
+			"Access-Control-Allow-Origin":      "https://simcha.dev",
+			"Access-Control-Allow-Credentials": "true",
+			"Access-Control-Allow-Methods":     "GET, POST, PUT, PATCH, DELETE",
+			"Access-Control-Max-Age":           "600",
+		}
+		for k, v := range expected {
+			if rec.Header().Get(k) != v {
+				t.Errorf("Expected %s to be %s, got %s", k, v, rec.Header().Get(k))
+			}
+		}
+
+		if vary := rec.Header().Values("Vary"); len(vary) != 3 || vary[0] != "Origin" {
+			t.Errorf("Expected to vary on the origin and requested method and headers, got %v", vary)
+		}
+	})
+
+	t.Run("Preflights from unknown origins are refused", func(t *testing.T) {
+		rec := serve("OPTIONS", "/posts", "https://evil.io", "DELETE")
+		if reached || rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("Expected a 403 without CORS headers, got %d %v", rec.Code, rec.Header())
+		}
+	})
+
+	t.Run("Allowed origins get CORS headers", func(t *testing.T) {
+		rec := serve("GET", "/posts", "https://simcha.dev", "")
+		if !reached || rec.Header().Get("Access-Control-Allow-Origin") != "https://simcha.dev" || rec.Header().Get("Access-Control-Expose-Headers") != "X-CSRF-Token" {
+			t.Errorf("Unexpected headers %v", rec.Header())
+		}
+	})
+
+	t.Run("Other origins are served without CORS headers", func(t *testing.T) {
+		rec := serve("GET", "/posts", "https://evil.io", "")
+		if !reached || rec.Header().Get("Access-Control-Allow-Origin") != "" || rec.Header().Get("Vary") != "Origin" {
+			t.Errorf("Unexpected headers %v", rec.Header())
+		}
+	})
+
+	t.Run("Routes can override the policy", func(t *testing.T) {
+		rec := serve("OPTIONS", "/public/main.css", "https://evil.io", "GET")
+		if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("Expected any origin without credentials, got %d %v", rec.Code, rec.Header())
+		}
+
+		if rec := serve("OPTIONS", "/public/main.css", "https://evil.io", "POST"); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected methods outside the override to be refused, got %d", rec.Code)
+		}
+	})
+}
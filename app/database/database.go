@@ -5,7 +5,14 @@ and the Datastore and Generic functions and types to be used by all models
 package database
 
 import (
+	"context"
 	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/logging"
+	"github.com/alexandersmanning/simcha/app/tracing"
 	_ "github.com/lib/pq" //PQ is used for postgres db
 )
 
@@ -14,13 +21,23 @@ type Datastore interface {
 	PostStore
 	UserStore
 	UserSessionStore
+	TwoFactorStore
+	RevisionStore
+	TrashStore
+	TagStore
+	WithContext(ctx context.Context) Datastore
 }
 
 //DB is the public struct whose methods interact directly with the database
 type DB struct {
 	*sql.DB
+	ctx       context.Context
+	operation string
 }
 
+//SlowQuery is the duration after which a query is logged as a warning
+var SlowQuery = 500 * time.Millisecond
+
 //InitDB initializes the database, creating a new DB struct
 func InitDB(dataSourceName string) (*DB, error) {
 	db, err := sql.Open("postgres", dataSourceName)
@@ -29,7 +46,149 @@ func InitDB(dataSourceName string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db}, nil
+}
+
+//WithContext returns a copy of the DB whose queries run with, and log to, the request context
+func (db *DB) WithContext(ctx context.Context) Datastore {
+	return db.with(ctx)
+}
+
+func (db *DB) with(ctx context.Context) *DB {
+	c := *db
+	c.ctx = ctx
+	return &c
+}
+
+//Context returns the context queries run with
+func (db *DB) Context() context.Context {
+	if db.ctx == nil {
+		return context.Background()
+	}
+
+	return db.ctx
+}
+
+//Logger returns the request scoped logger
+func (db *DB) Logger() *slog.Logger {
+	return logging.FromContext(db.Context())
+}
+
+//op returns a copy of the DB whose queries are traced and logged as the named operation. Every Datastore method
+//names itself, and the helpers it calls inherit the name
+func (db *DB) op(name string) *DB {
+	c := *db
+	c.operation = name
+	return &c
+}
+
+func (db *DB) logQuery(query string, start time.Time, err error) {
+	d := time.Since(start)
+	switch {
+	case err != nil:
+		db.Logger().Error("query failed", "op", db.operation, "error", err, "duration", d, "sql", query)
+	case d > SlowQuery:
+		db.Logger().Warn("slow query", "op", db.operation, "duration", d, "sql", query)
+	default:
+		db.Logger().Debug("query", "op", db.operation, "duration", d, "sql", query)
+	}
+}
+
+//startSpan starts a span named after the operation running the query, such as DB.AllPosts
+func (db *DB) startSpan(query string) (context.Context, *tracing.Span) {
+	name := "DB.query"
+	if db.operation != "" {
+		name = "DB." + db.operation
+	}
+
+	ctx, span := tracing.Start(db.Context(), name)
+	span.SetAttr("db.system", "postgresql")
+	span.SetAttr("db.statement", strings.Join(strings.Fields(query), " "))
+	return ctx, span
+}
+
+//runner is implemented by both sql.DB and sql.Tx
+type runner interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (db *DB) query(r runner, query string, args []interface{}) (*sql.Rows, error) {
+	ctx, span := db.startSpan(query)
+	defer span.End()
+
+	start := time.Now()
+	rows, err := r.QueryContext(ctx, query, args...)
+	db.logQuery(query, start, err)
+	span.RecordError(err)
+	return rows, err
+}
+
+func (db *DB) queryRow(r runner, query string, args []interface{}) *sql.Row {
+	ctx, span := db.startSpan(query)
+	defer span.End()
+
+	start := time.Now()
+	row := r.QueryRowContext(ctx, query, args...)
+	db.logQuery(query, start, row.Err())
+	span.RecordError(row.Err())
+	return row
+}
+
+func (db *DB) exec(r runner, query string, args []interface{}) (sql.Result, error) {
+	ctx, span := db.startSpan(query)
+	defer span.End()
+
+	start := time.Now()
+	res, err := r.ExecContext(ctx, query, args...)
+	db.logQuery(query, start, err)
+	span.RecordError(err)
+	return res, err
+}
+
+//Query runs the query with the DB's context
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.query(db.DB, query, args)
+}
+
+//QueryRow runs the query with the DB's context
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.queryRow(db.DB, query, args)
+}
+
+//Exec runs the statement with the DB's context
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.exec(db.DB, query, args)
+}
+
+//Tx is a transaction whose statements are traced and logged like those of the DB which began it
+type Tx struct {
+	*sql.Tx
+	db *DB
+}
+
+//Begin starts a transaction with the DB's context
+func (db *DB) Begin() (*Tx, error) {
+	tx, err := db.DB.BeginTx(db.Context(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, db: db}, nil
+}
+
+//Query runs the query in the transaction
+func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.db.query(tx.Tx, query, args)
 }
 
+//QueryRow runs the query in the transaction
+func (tx *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.db.queryRow(tx.Tx, query, args)
+}
 
+//Exec runs the statement in the transaction
+func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.db.exec(tx.Tx, query, args)
+}
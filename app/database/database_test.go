@@ -3,6 +3,7 @@ package database
 import (
 	"fmt"
 	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/tracing"
 	"math/rand"
 	"os"
 	"testing"
@@ -67,3 +68,39 @@ func makeTestUser(t *testing.T) *models.User {
 func teardownModels() {
 	db.Close()
 }
+
+type spanNames []string
+
+func (n *spanNames) ExportSpan(s *tracing.SpanData) error {
+	*n = append(*n, s.Name)
+	return nil
+}
+
+func TestSpanNames(t *testing.T) {
+	var names spanNames
+	tracing.Default.SetExporter(&names)
+	defer tracing.Default.SetExporter(nil)
+
+	u := makeTestUser(t)
+	names = nil
+
+	if _, err := db.UserExists(u.Email); err != nil {
+		t.Fatal(err)
+	}
+
+	// the statements of transactions are traced too, under the operation which began them
+	if err := db.DeleteUser(u.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) < 2 || names[0] != "DB.UserExists" {
+		t.Fatalf("Expected a span named after UserExists first, got %v", names)
+	}
+
+	for _, n := range names[1:] {
+		if n != "DB.DeleteUser" {
+			t.Errorf("Expected every statement of DeleteUser to be named after it, got %v", names)
+			break
+		}
+	}
+}
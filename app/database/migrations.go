@@ -0,0 +1,346 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Migration is a single versioned change to the schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations lists every schema change in the order they are applied
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create users, posts and user_sessions",
+		Up: `
+			CREATE TABLE IF NOT EXISTS users (
+				id              SERIAL PRIMARY KEY,
+				email           TEXT NOT NULL UNIQUE,
+				password_digest TEXT NOT NULL,
+				created_at      TIMESTAMP NOT NULL,
+				modified_at     TIMESTAMP NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS posts (
+				id          SERIAL PRIMARY KEY,
+				user_id     INTEGER REFERENCES users(id),
+				title       TEXT NOT NULL DEFAULT '',
+				body        TEXT NOT NULL DEFAULT '',
+				created_at  TIMESTAMP NOT NULL,
+				modified_at TIMESTAMP NOT NULL
+			);
+			CREATE TABLE IF NOT EXISTS user_sessions (
+				id            SERIAL PRIMARY KEY,
+				user_id       INTEGER NOT NULL REFERENCES users(id),
+				session_token TEXT NOT NULL
+			);
+		`,
+		Down: `
+			DROP TABLE user_sessions;
+			DROP TABLE posts;
+			DROP TABLE users;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "add two factor authentication",
+		Up: `
+			ALTER TABLE users
+				ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '',
+				ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+			CREATE TABLE recovery_codes (
+				id          SERIAL PRIMARY KEY,
+				user_id     INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				code_digest TEXT NOT NULL,
+				used_at     TIMESTAMP
+			);
+		`,
+		Down: `
+			DROP TABLE recovery_codes;
+			ALTER TABLE users DROP COLUMN totp_secret, DROP COLUMN totp_enabled;
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "add user roles",
+		Up:      `ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';`,
+		Down:    `ALTER TABLE users DROP COLUMN role;`,
+	},
+	{
+		Version: 4,
+		Name:    "index posts by modification",
+		Up:      `CREATE INDEX posts_modified_at_idx ON posts (modified_at);`,
+		Down:    `DROP INDEX posts_modified_at_idx;`,
+	},
+	{
+		Version: 5,
+		Name:    "add post versions",
+		Up:      `ALTER TABLE posts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+		Down:    `ALTER TABLE posts DROP COLUMN version;`,
+	},
+	{
+		Version: 6,
+		Name:    "add post revisions",
+		Up: `
+			CREATE TABLE post_revisions (
+				id         SERIAL PRIMARY KEY,
+				post_id    INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				revision   INTEGER NOT NULL,
+				user_id    INTEGER REFERENCES users(id) ON DELETE SET NULL,
+				title      TEXT NOT NULL,
+				body       TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				UNIQUE (post_id, revision)
+			);
+			INSERT INTO post_revisions (post_id, revision, user_id, title, body, created_at)
+				SELECT id, version, user_id, title, body, modified_at FROM posts;
+		`,
+		Down: `DROP TABLE post_revisions;`,
+	},
+	{
+		Version: 7,
+		Name:    "add post statuses",
+		Up: `
+			ALTER TABLE posts
+				ADD COLUMN status TEXT NOT NULL DEFAULT 'published',
+				ADD COLUMN published_at TIMESTAMP;
+			UPDATE posts SET published_at = created_at;
+			CREATE INDEX posts_status_published_at_idx ON posts (status, published_at);
+		`,
+		Down: `
+			DROP INDEX posts_status_published_at_idx;
+			ALTER TABLE posts DROP COLUMN status, DROP COLUMN published_at;
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "add soft deletion of posts and users",
+		Up: `
+			ALTER TABLE posts ADD COLUMN deleted_at TIMESTAMP;
+			ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+			CREATE INDEX posts_trash_idx ON posts (user_id, deleted_at) WHERE deleted_at IS NOT NULL;
+			CREATE INDEX users_trash_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+		`,
+		Down: `
+			DROP INDEX users_trash_idx;
+			DROP INDEX posts_trash_idx;
+			ALTER TABLE users DROP COLUMN deleted_at;
+			ALTER TABLE posts DROP COLUMN deleted_at;
+		`,
+	},
+	{
+		Version: 9,
+		Name:    "add tags and categories",
+		Up: `
+			ALTER TABLE posts ADD COLUMN category TEXT NOT NULL DEFAULT '';
+			CREATE INDEX posts_category_idx ON posts (category) WHERE category <> '';
+			CREATE TABLE tags (
+				id   SERIAL PRIMARY KEY,
+				slug TEXT NOT NULL UNIQUE
+			);
+			CREATE TABLE post_tags (
+				post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				tag_id  INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+				PRIMARY KEY (post_id, tag_id)
+			);
+			CREATE INDEX post_tags_tag_id_idx ON post_tags (tag_id);
+		`,
+		Down: `
+			DROP TABLE post_tags;
+			DROP TABLE tags;
+			DROP INDEX posts_category_idx;
+			ALTER TABLE posts DROP COLUMN category;
+		`,
+	},
+	{
+		Version: 10,
+		Name:    "add post slugs",
+		// existing posts get their id as a suffix, which keeps their slugs unique without transliterating their titles
+		Up: `
+			ALTER TABLE posts ADD COLUMN slug TEXT UNIQUE;
+			UPDATE posts SET slug = COALESCE(
+				NULLIF(trim(both '-' from lower(regexp_replace(title, '[^A-Za-z0-9]+', '-', 'g'))), ''), 'post'
+			) || '-' || id;
+			CREATE TABLE post_slugs (
+				slug       TEXT PRIMARY KEY,
+				post_id    INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+				created_at TIMESTAMP NOT NULL
+			);
+			CREATE INDEX post_slugs_post_id_idx ON post_slugs (post_id);
+			INSERT INTO post_slugs (slug, post_id, created_at) SELECT slug, id, modified_at FROM posts;
+		`,
+		Down: `
+			DROP TABLE post_slugs;
+			ALTER TABLE posts DROP COLUMN slug;
+		`,
+	},
+	{
+		Version: 11,
+		Name:    "remember the last two factor code used",
+		Up:      `ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;`,
+		Down:    `ALTER TABLE users DROP COLUMN totp_last_step;`,
+	},
+}
+
+// Migrate applies every migration that has not been run yet, each in its own transaction
+func (db *DB) Migrate() error {
+	db = db.op("Migrate")
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT now()
+		)
+	`); err != nil {
+		return err
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range Migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(m.Up); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %v", m.Version, m.Name, err)
+		}
+
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, m.Version); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first, each in its own transaction
+func (db *DB) MigrateDown(steps int) error {
+	db = db.op("MigrateDown")
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for i := len(Migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := Migrations[i]
+		if m.Version > current {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(m.Down); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("reverting migration %d (%s): %v", m.Version, m.Name, err)
+		}
+
+		if _, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		steps--
+	}
+
+	return nil
+}
+
+// MigrationStatus is a known migration, and when it was applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// MigrationStatus lists every known migration, and whether it has been applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	db = db.op("MigrationStatus")
+
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(Migrations))
+	for i, m := range Migrations {
+		at, ok := applied[m.Version]
+		status[i] = MigrationStatus{Migration: m, Applied: ok, AppliedAt: at}
+	}
+
+	return status, nil
+}
+
+// SchemaVersion returns the version of the last migration applied to the database
+func (db *DB) SchemaVersion() (int, error) {
+	db = db.op("SchemaVersion")
+
+	var v int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+	return v, err
+}
+
+// LatestVersion is the version of the last migration known to this build
+func LatestVersion() int {
+	if len(Migrations) == 0 {
+		return 0
+	}
+
+	return Migrations[len(Migrations)-1].Version
+}
+
+// CheckMigrations returns an error unless every migration has been applied
+func (db *DB) CheckMigrations(ctx context.Context) error {
+	v, err := db.with(ctx).SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if v < LatestVersion() {
+		return fmt.Errorf("schema is at version %d, expected %d", v, LatestVersion())
+	}
+
+	return nil
+}
@@ -1,30 +1,74 @@
 package database
 
-import "github.com/alexandersmanning/simcha/app/models"
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
 
 //PostStore is the store interface for Posts
 type PostStore interface {
-	AllPosts() ([]*models.Post, error)
+	AllPosts(q PostQuery) ([]*models.Post, error)
+	PostsVersion(q PostQuery) (models.PostsVersion, error)
 	CreatePost(p models.PostAction) error
 	DeletePost(id string) error
 	EditPost(p models.PostAction) error
+	SetPostStatus(p models.PostAction) error
+	PublishDue(now time.Time) (int64, error)
 	GetPostById(id string) (*models.Post, error)
+	GetPostBySlug(slug string) (*models.Post, error)
+}
+
+//PostQuery selects the posts listed. Published posts are always listed, and posts in the trash never are
+type PostQuery struct {
+	//ViewerId also lists the unpublished posts written by this user
+	ViewerId int
+	//Unpublished lists every post, whatever its status
+	Unpublished bool
+	//Tag and Category only list the posts with this tag or in this category, when they are not empty
+	Tag      string
+	Category string
+}
+
+//where is the condition selecting the posts, with its arguments numbered from $1
+func (q PostQuery) where() (string, []interface{}) {
+	return `posts.deleted_at IS NULL AND (posts.status = 'published' OR $1 OR posts.user_id = $2)
+		AND ($3 = '' OR posts.category = $3)
+		AND ($4 = '' OR EXISTS (
+			SELECT 1 FROM post_tags JOIN tags ON tags.id = post_tags.tag_id
+			WHERE post_tags.post_id = posts.id AND tags.slug = $4
+		))`,
+		[]interface{}{q.Unpublished, q.ViewerId, q.Category, q.Tag}
 }
 
 //AllPosts queries the posts table and returns a slice of Post objects, or and error
-func (db *DB) AllPosts() ([]*models.Post, error) {
+func (db *DB) AllPosts(q PostQuery) ([]*models.Post, error) {
+	db = db.op("AllPosts")
+
+	where, args := q.where()
 	rows, err := db.Query(`
 		SELECT posts.id,
 		       users.id,
 		       users.email,
+		       COALESCE(users.modified_at, posts.modified_at),
 		       posts.body,
 		       posts.title,
 		       posts.created_at,
-		       posts.modified_at
+		       posts.modified_at,
+		       posts.version,
+		       posts.status,
+		       posts.published_at,
+		       posts.category,
+		       COALESCE(posts.slug, '')
 		FROM posts
 		LEFT JOIN users ON users.id = posts.user_id
+		WHERE `+where+`
 		ORDER BY posts.modified_at DESC
-	`)
+	`, args...)
 
 	if err != nil {
 		return nil, err
@@ -36,28 +80,65 @@ func (db *DB) AllPosts() ([]*models.Post, error) {
 
 	for rows.Next() {
 		post := models.Post{}
-		if err := rows.Scan(&post.Id, &post.Author.Id, &post.Author.Email, &post.Body, &post.Title, &post.CreatedAt, &post.ModifiedAt); err != nil {
+		if err := rows.Scan(&post.Id, &post.Author.Id, &post.Author.Email, &post.Author.ModifiedAt, &post.Body, &post.Title, &post.CreatedAt, &post.ModifiedAt, &post.Version, &post.Status, &post.PublishedAt, &post.Category, &post.Slug); err != nil {
 			return nil, err
 		}
 		posts = append(posts, &post)
 	}
 
-	return posts, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, db.loadTags(posts)
+}
+
+//PostsVersion returns the count, highest id and latest modification of the posts the query lists and of their
+//authors, whose emails are listed with them, so clients with a current copy of the list can be answered without
+//loading it
+func (db *DB) PostsVersion(q PostQuery) (models.PostsVersion, error) {
+	db = db.op("PostsVersion")
+
+	var v models.PostsVersion
+	var lastModified sql.NullTime
+
+	where, args := q.where()
+	err := db.QueryRow(`
+		SELECT COUNT(*),
+		       COALESCE(MAX(posts.id), 0),
+		       MAX(GREATEST(posts.modified_at, users.modified_at))
+		FROM posts
+		LEFT JOIN users ON users.id = posts.user_id
+		WHERE `+where, args...).Scan(&v.Count, &v.MaxId, &lastModified)
+	if err != nil {
+		return v, err
+	}
+
+	v.LastModified = lastModified.Time
+	return v, nil
 }
 
 // Returns the Post and Related Author
 func (db *DB) GetPostById(id string) (*models.Post, error) {
+	db = db.op("GetPostById")
+
 	var post models.Post
 	rows, err := db.Query(`
-		SELECT users.id,
+		SELECT posts.id,
+		       users.id,
 		       users.email,
 		       posts.title,
 		       posts.body,
 		       posts.created_at,
-		       posts.modified_at
+		       posts.modified_at,
+		       posts.version,
+		       posts.status,
+		       posts.published_at,
+		       posts.category,
+		       COALESCE(posts.slug, '')
 		FROM posts
 		JOIN users ON posts.user_id = users.id
-		WHERE posts.id = $1
+		WHERE posts.id = $1 AND posts.deleted_at IS NULL
 	`,id)
 	if err != nil {
 		return &post, err
@@ -66,57 +147,181 @@ func (db *DB) GetPostById(id string) (*models.Post, error) {
 	defer rows.Close()
 	for rows.Next() {
 		if err := rows.Scan(
+			&post.Id,
 			&post.Author.Id,
 			&post.Author.Email,
 			&post.Title,
 			&post.Body,
 			&post.CreatedAt,
 			&post.ModifiedAt,
+			&post.Version,
+			&post.Status,
+			&post.PublishedAt,
+			&post.Category,
+			&post.Slug,
 		); err != nil {
 			return &post, err
 		}
 	}
 
-	return &post, nil
+	if post.Id == 0 {
+		return &post, rows.Err()
+	}
+
+	return &post, db.loadTags([]*models.Post{&post})
 }
 
-//CreatePost creates a new Post object, and returns an ID of the created object
+//CreatePost creates a new Post object, and returns an ID of the created object. Posts without a status are published.
+//The slug is made from the title, with a suffix when it is taken
 func (db *DB) CreatePost(p models.PostAction) error {
+	db = db.op("CreatePost")
+
 	post := p.Post()
 	post.SetTimestamps()
+	if post.Status == "" {
+		post.SetStatus(models.StatusPublished, nil, post.CreatedAt)
+	}
 
-	rows, err := db.Query(
-		`INSERT INTO posts(user_id, title, body, created_at, modified_at)
-			   VALUES($1, $2, $3, $4, $5)
-			   RETURNING id`,
-		post.Author.Id, post.Title, post.Body, post.CreatedAt, post.ModifiedAt)
-
-	var id int
-	defer rows.Close()
-	for rows.Next() {
-		if err := rows.Scan(&id); err != nil {
+	return db.withSlug(post.Title, 0, func(slug string) error {
+		var id int
+		err := db.QueryRow(
+			`WITH created AS (
+				INSERT INTO posts(user_id, title, body, created_at, modified_at, status, published_at, category, slug)
+				VALUES($1, $2, $3, $4, $5, $6, $7, $8, $10)
+				RETURNING id, version, user_id, title, body, created_at
+			), revision AS (
+				INSERT INTO post_revisions (post_id, revision, user_id, title, body, created_at)
+				SELECT id, version, user_id, title, body, created_at FROM created
+			), slugged AS (
+				INSERT INTO post_slugs (slug, post_id, created_at)
+				SELECT $10, id, created_at FROM created
+			), `+tagPost("created", "$9")+`
+			SELECT id, version FROM created`,
+			post.Author.Id, post.Title, post.Body, post.CreatedAt, post.ModifiedAt, post.Status, post.PublishedAt,
+			post.Category, pq.Array(post.Tags), slug).Scan(&id, &post.Version)
+		if err != nil {
 			return err
 		}
-	}
-
-	p.SetID(id)
 
-	return err
+		p.SetID(id)
+		post.Slug = slug
+		return nil
+	})
 }
 
+//ErrStaleVersion is returned by EditPost when the post was edited since the version being updated
+var ErrStaleVersion = errors.New("post was edited by someone else, reload it and apply the changes again")
+
+//ErrPostNotFound is returned by EditPost and SetPostStatus when the post carries no version and there is no post to
+//change, as it was deleted or moved to the trash since it was loaded
+var ErrPostNotFound = errors.New("post not found")
+
+//EditPost saves the title, body, tags and category, increments the version, and saves the new version as a revision.
+//When the post carries a version, the edit is only made if it is still the current one, otherwise ErrStaleVersion is
+//returned. When the title no longer makes the slug, the post gets a new one, and its previous slugs keep naming it
 func (db *DB) EditPost(p models.PostAction) error {
+	db = db.op("EditPost")
+
+	p.SetTimestamps()
+	post := p.Post()
+
+	return db.withSlug(post.Title, post.Id, func(slug string) error {
+		err := db.QueryRow(
+			`WITH edited AS (
+				UPDATE posts SET title = $2, body = $3, modified_at = $4, version = version + 1, category = $7, slug = $9
+				WHERE id = $1 AND ($5 = 0 OR version = $5) AND deleted_at IS NULL
+				RETURNING id, version, user_id, title, body, modified_at
+			), revision AS (
+				INSERT INTO post_revisions (post_id, revision, user_id, title, body, created_at)
+				SELECT id, version, COALESCE(NULLIF($6, 0), user_id), title, body, modified_at FROM edited
+			), slugged AS (
+				INSERT INTO post_slugs (slug, post_id, created_at)
+				SELECT $9, id, modified_at FROM edited
+				ON CONFLICT (slug) DO NOTHING
+			), `+tagPost("edited", "$8")+`
+			SELECT version FROM edited`,
+			post.Id, post.Title, post.Body, post.ModifiedAt, post.Version, post.EditedBy, post.Category,
+			pq.Array(post.Tags), slug).Scan(&post.Version)
+
+		if err == sql.ErrNoRows {
+			return noPostEdited(post)
+		}
+		if err != nil {
+			return err
+		}
+
+		post.Slug = slug
+		return nil
+	})
+}
+
+//SetPostStatus saves the status and publication time, increments the version, and saves the new version as a
+//revision, so every version of a post has one. Like EditPost, the change is only made if the version the post carries
+//is still the current one
+func (db *DB) SetPostStatus(p models.PostAction) error {
+	db = db.op("SetPostStatus")
+
 	p.SetTimestamps()
 	post := p.Post()
 
-	_, err := db.Query(
-		`UPDATE posts SET title = $2, body = $3, modified_at = $4 WHERE id = $1`,
-		post.Id, post.Title, post.Body, post.ModifiedAt)
+	err := db.QueryRow(
+		`WITH changed AS (
+			UPDATE posts SET status = $2, published_at = $3, modified_at = $4, version = version + 1
+			WHERE id = $1 AND ($5 = 0 OR version = $5) AND deleted_at IS NULL
+			RETURNING id, version, user_id, title, body, modified_at
+		), revision AS (
+			INSERT INTO post_revisions (post_id, revision, user_id, title, body, created_at)
+			SELECT id, version, COALESCE(NULLIF($6, 0), user_id), title, body, modified_at FROM changed
+		)
+		SELECT version FROM changed`,
+		post.Id, post.Status, post.PublishedAt, post.ModifiedAt, post.Version, post.EditedBy).Scan(&post.Version)
+
+	if err == sql.ErrNoRows {
+		return noPostEdited(post)
+	}
 
 	return err
 }
 
+//noPostEdited explains why an edit changed no row. With a version, the post is assumed edited since, and otherwise gone
+func noPostEdited(post *models.Post) error {
+	if post.Version != 0 {
+		return ErrStaleVersion
+	}
+
+	return ErrPostNotFound
+}
+
+//PublishDue publishes the scheduled posts whose publication time is not after now, and returns how many there were.
+//Like SetPostStatus, each new version is saved as a revision, made by the author
+func (db *DB) PublishDue(now time.Time) (int64, error) {
+	db = db.op("PublishDue")
+
+	now = now.UTC()
+	var published int64
+	err := db.QueryRow(`
+		WITH changed AS (
+			UPDATE posts SET status = 'published', modified_at = $1, version = version + 1
+			WHERE status = 'scheduled' AND published_at <= $1 AND deleted_at IS NULL
+			RETURNING id, version, user_id, title, body, modified_at
+		), revision AS (
+			INSERT INTO post_revisions (post_id, revision, user_id, title, body, created_at)
+			SELECT id, version, user_id, title, body, modified_at FROM changed
+		)
+		SELECT COUNT(*) FROM changed
+	`, now).Scan(&published)
+
+	return published, err
+}
+
+//DeletePost moves the post to the trash, from which it can be restored until it is purged. Moving posts in and out of
+//the trash modifies them, so the version of the lists they were or are on changes
 func (db *DB) DeletePost(id string) error {
-	_, err := db.Query(`DELETE FROM posts WHERE id = $1`, id)
+	db = db.op("DeletePost")
+
+	_, err := db.Exec(`
+		UPDATE posts SET deleted_at = $2, modified_at = $2 WHERE id = $1 AND deleted_at IS NULL
+	`, id, time.Now().UTC())
 	if err != nil {
 		return err
 	}
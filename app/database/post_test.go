@@ -3,6 +3,8 @@ package database
 import (
 	"fmt"
 	"github.com/alexandersmanning/simcha/app/models"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
@@ -104,7 +106,7 @@ func TestCreatePost(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		posts, err := db.AllPosts()
+		posts, err := db.AllPosts(PostQuery{})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -139,7 +141,7 @@ func TestCreatePost(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		posts, err := db.AllPosts()
+		posts, err := db.AllPosts(PostQuery{})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -218,6 +220,59 @@ func TestEditPost(t *testing.T) {
 			t.Error("Expected modified date to be different than created date")
 		}
 	})
+
+	t.Run("It increments the version", func(t *testing.T) {
+		current, err := db.GetPostById(strconv.Itoa(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := models.Post{Id: id, Title: "Versioned", Version: current.Version}
+		if err := db.EditPost(&p); err != nil {
+			t.Fatal(err)
+		}
+
+		if p.Version != current.Version+1 {
+			t.Errorf("Expected version %d, got %d", current.Version+1, p.Version)
+		}
+	})
+
+	t.Run("It refuses edits of a stale version", func(t *testing.T) {
+		current, err := db.GetPostById(strconv.Itoa(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := models.Post{Id: id, Title: "Stale", Version: current.Version - 1}
+		if err := db.EditPost(&p); err != ErrStaleVersion {
+			t.Fatalf("Expected ErrStaleVersion, got %v", err)
+		}
+
+		after, err := db.GetPostById(strconv.Itoa(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if after.Title != current.Title || after.Version != current.Version {
+			t.Errorf("Expected the post to be unchanged, got %+v", after)
+		}
+	})
+
+	t.Run("Posts moved to the trash are not found", func(t *testing.T) {
+		if err := db.DeletePost(strconv.Itoa(id)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.EditPost(&models.Post{Id: id, Title: "Gone"}); err != ErrPostNotFound {
+			t.Errorf("Expected %v editing, got %v", ErrPostNotFound, err)
+		}
+
+		p := &models.Post{Id: id}
+		p.SetStatus(models.StatusArchived, nil, time.Now())
+		if err := db.SetPostStatus(p); err != ErrPostNotFound {
+			t.Errorf("Expected %v changing the status, got %v", ErrPostNotFound, err)
+		}
+	})
 }
 
 func TestGetPostByID(t *testing.T) {
@@ -290,13 +345,13 @@ func TestDeletePost(t *testing.T) {
 		}
 	})
 
-	t.Run("It deletes the post", func(t *testing.T) {
+	t.Run("It moves the post to the trash", func(t *testing.T) {
 		if err := db.DeletePost(strconv.Itoa(p.Id)); err != nil {
 			t.Fatal(err)
 		}
 
 		foundPost := models.Post{}
-		rows, err := db.Query(`SELECT id, title, body, user_id FROM posts WHERE id = $1`, p.Id)
+		rows, err := db.Query(`SELECT id, title, body, user_id FROM posts WHERE id = $1 AND deleted_at IS NULL`, p.Id)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -311,5 +366,207 @@ func TestDeletePost(t *testing.T) {
 		if foundPost.Author.Id != 0 || foundPost.Title != "" || foundPost.Id != 0 {
 			t.Errorf("Expected an emty return, got %v", foundPost)
 		}
+
+		if found, err := db.GetPostById(strconv.Itoa(p.Id)); err != nil || found.Id != 0 {
+			t.Errorf("Expected the post to be hidden, got %+v, %v", found, err)
+		}
+	})
+}
+
+func TestPostsVersion(t *testing.T) {
+	clearPosts(t)
+
+	t.Run("No posts", func(t *testing.T) {
+		v, err := db.PostsVersion(PostQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if v.Count != 0 || v.MaxId != 0 || !v.LastModified.IsZero() {
+			t.Errorf("Expected an empty version, got %+v", v)
+		}
+	})
+
+	t.Run("It matches the version of the loaded list", func(t *testing.T) {
+		u := makeTestUser(t)
+		for _, title := range []string{"first", "second"} {
+			if err := db.CreatePost(&models.Post{Title: title, Author: *u}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		v, err := db.PostsVersion(PostQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		posts, err := db.AllPosts(PostQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := models.VersionOf(posts); v.ETag() != expected.ETag() || v.Count != 2 {
+			t.Errorf("Expected %+v, got %+v", expected, v)
+		}
+	})
+
+	t.Run("It changes with the emails of the authors", func(t *testing.T) {
+		before, err := db.PostsVersion(PostQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		posts, err := db.AllPosts(PostQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.SetUserEmail(posts[0].Author.Id, "renamed-author@fake.com"); err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := db.PostsVersion(PostQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if after.ETag() == before.ETag() {
+			t.Error("Expected the version to change with the email of an author")
+		}
+
+		posts, err = db.AllPosts(PostQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := models.VersionOf(posts); after.ETag() != expected.ETag() {
+			t.Errorf("Expected %+v, got %+v", expected, after)
+		}
+	})
+}
+
+func TestPostStatuses(t *testing.T) {
+	clearPosts(t)
+	author := makeTestUser(t)
+	other := makeTestUser(t)
+
+	now := time.Now().UTC()
+	later := now.Add(time.Hour)
+
+	create := func(title, status string, publishedAt *time.Time) *models.Post {
+		t.Helper()
+
+		p := &models.Post{Title: title, Author: *author, Status: status, PublishedAt: publishedAt}
+		if err := db.CreatePost(p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	create("published", "", nil)
+	create("draft", models.StatusDraft, nil)
+	scheduled := create("scheduled", models.StatusScheduled, &later)
+
+	titles := func(q PostQuery) []string {
+		t.Helper()
+
+		posts, err := db.AllPosts(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v, err := db.PostsVersion(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Count != len(posts) {
+			t.Errorf("Expected the version to count %d posts, got %d", len(posts), v.Count)
+		}
+
+		var titles []string
+		for _, p := range posts {
+			titles = append(titles, p.Title)
+		}
+		sort.Strings(titles)
+		return titles
+	}
+
+	t.Run("Posts without a status are published", func(t *testing.T) {
+		if got := titles(PostQuery{}); !reflect.DeepEqual(got, []string{"published"}) {
+			t.Errorf("Expected only the published post, got %v", got)
+		}
+
+		if got := titles(PostQuery{ViewerId: other.Id}); !reflect.DeepEqual(got, []string{"published"}) {
+			t.Errorf("Expected only the published post for other users, got %v", got)
+		}
+	})
+
+	t.Run("Authors and admins list unpublished posts", func(t *testing.T) {
+		expected := []string{"draft", "published", "scheduled"}
+
+		if got := titles(PostQuery{ViewerId: author.Id}); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected %v for the author, got %v", expected, got)
+		}
+
+		if got := titles(PostQuery{Unpublished: true}); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected %v for admins, got %v", expected, got)
+		}
+	})
+
+	t.Run("Scheduled posts are published once due", func(t *testing.T) {
+		if n, err := db.PublishDue(now); err != nil || n != 0 {
+			t.Fatalf("Expected nothing to be due, got %d, %v", n, err)
+		}
+
+		if n, err := db.PublishDue(later); err != nil || n != 1 {
+			t.Fatalf("Expected the scheduled post to be published, got %d, %v", n, err)
+		}
+
+		p, err := db.GetPostById(strconv.Itoa(scheduled.Id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.Status != models.StatusPublished || p.Version != scheduled.Version+1 || p.PublishedAt == nil {
+			t.Errorf("Expected a published post at a new version, got %+v", p)
+		}
+	})
+
+	t.Run("Status changes are refused on a stale version", func(t *testing.T) {
+		p, err := db.GetPostById(strconv.Itoa(scheduled.Id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p.SetStatus(models.StatusArchived, nil, now)
+		if err := db.SetPostStatus(p); err != nil {
+			t.Fatal(err)
+		}
+
+		p.Version--
+		if err := db.SetPostStatus(p); err != ErrStaleVersion {
+			t.Errorf("Expected %v, got %v", ErrStaleVersion, err)
+		}
+	})
+
+	t.Run("Every version has a revision", func(t *testing.T) {
+		p, err := db.GetPostById(strconv.Itoa(scheduled.Id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		revisions, err := db.PostRevisions(strconv.Itoa(scheduled.Id))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(revisions) != p.Version {
+			t.Fatalf("Expected %d revisions, got %d", p.Version, len(revisions))
+		}
+		for i, r := range revisions {
+			if r.Number != p.Version-i {
+				t.Errorf("Expected revision %d, got %d", p.Version-i, r.Number)
+			}
+		}
 	})
 }
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"math"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+// RevisionStore is the store interface for the revisions of posts
+type RevisionStore interface {
+	PostRevisions(postId string) ([]*models.Revision, error)
+	GetRevision(postId string, number int) (*models.Revision, error)
+	PruneRevisions(policy RetentionPolicy, now time.Time) (int64, error)
+}
+
+// RetentionPolicy decides which revisions are pruned. The revision of the current version of a post is always kept
+type RetentionPolicy struct {
+	// Keep is the number of revisions kept for each post, or zero to keep any number
+	Keep int
+	// MaxAge is how long revisions are kept, or zero to keep them forever
+	MaxAge time.Duration
+}
+
+// Enabled reports whether the policy prunes anything
+func (p RetentionPolicy) Enabled() bool {
+	return p.Keep > 0 || p.MaxAge > 0
+}
+
+const selectRevisions = `
+	SELECT post_revisions.post_id,
+	       post_revisions.revision,
+	       COALESCE(users.id, 0),
+	       COALESCE(users.email, ''),
+	       post_revisions.title,
+	       post_revisions.body,
+	       post_revisions.created_at
+	FROM post_revisions
+	LEFT JOIN users ON users.id = post_revisions.user_id
+`
+
+// PostRevisions returns the revisions of the post, newest first
+func (db *DB) PostRevisions(postId string) ([]*models.Revision, error) {
+	db = db.op("PostRevisions")
+
+	rows, err := db.Query(selectRevisions+`
+		WHERE post_revisions.post_id = $1
+		ORDER BY post_revisions.revision DESC
+	`, postId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var revisions []*models.Revision
+	for rows.Next() {
+		var r models.Revision
+		if err := rows.Scan(&r.PostId, &r.Number, &r.Author.Id, &r.Author.Email, &r.Title, &r.Body, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &r)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetRevision returns a revision of the post, whose Number is zero when it does not exist
+func (db *DB) GetRevision(postId string, number int) (*models.Revision, error) {
+	db = db.op("GetRevision")
+
+	var r models.Revision
+	rows, err := db.Query(selectRevisions+`
+		WHERE post_revisions.post_id = $1 AND post_revisions.revision = $2
+	`, postId, number)
+	if err != nil {
+		return &r, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&r.PostId, &r.Number, &r.Author.Id, &r.Author.Email, &r.Title, &r.Body, &r.CreatedAt); err != nil {
+			return &r, err
+		}
+	}
+
+	return &r, rows.Err()
+}
+
+// PruneRevisions deletes the revisions the policy no longer keeps, and returns how many were deleted
+func (db *DB) PruneRevisions(policy RetentionPolicy, now time.Time) (int64, error) {
+	db = db.op("PruneRevisions")
+
+	if !policy.Enabled() {
+		return 0, nil
+	}
+
+	keep := policy.Keep
+	if keep <= 0 {
+		keep = math.MaxInt32
+	}
+
+	// revisions created before the zero time do not exist, so a zero MaxAge prunes nothing by age
+	var cutoff time.Time
+	if policy.MaxAge > 0 {
+		cutoff = now.UTC().Add(-policy.MaxAge)
+	}
+
+	res, err := db.Exec(`
+		DELETE FROM post_revisions
+		USING (
+			SELECT id, row_number() OVER (PARTITION BY post_id ORDER BY revision DESC) AS newer
+			FROM post_revisions
+		) ranked
+		WHERE post_revisions.id = ranked.id
+		  AND ranked.newer > 1
+		  AND (ranked.newer > $1 OR post_revisions.created_at < $2)
+	`, keep, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
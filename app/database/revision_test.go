@@ -0,0 +1,112 @@
+package database
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+func TestPostRevisions(t *testing.T) {
+	clearPosts(t)
+	author := makeTestUser(t)
+	editor := makeTestUser(t)
+
+	post := models.Post{Title: "First", Body: "First Body", Author: *author}
+	if err := db.CreatePost(&post); err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.Itoa(post.Id)
+
+	post.Title, post.EditedBy = "Second", editor.Id
+	if err := db.EditPost(&post); err != nil {
+		t.Fatal(err)
+	}
+
+	post.Title, post.EditedBy = "Third", 0
+	if err := db.EditPost(&post); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Every version is saved as a revision, newest first", func(t *testing.T) {
+		revisions, err := db.PostRevisions(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []struct {
+			number int
+			title  string
+			author int
+		}{
+			{3, "Third", author.Id},
+			{2, "Second", editor.Id},
+			{1, "First", author.Id},
+		}
+
+		if len(revisions) != len(expected) {
+			t.Fatalf("Expected %d revisions, got %d", len(expected), len(revisions))
+		}
+
+		for i, e := range expected {
+			r := revisions[i]
+			if r.Number != e.number || r.Title != e.title || r.Author.Id != e.author || r.Body != "First Body" {
+				t.Errorf("Expected revision %d %q by %d, got %+v", e.number, e.title, e.author, r)
+			}
+		}
+	})
+
+	t.Run("It gets a single revision", func(t *testing.T) {
+		r, err := db.GetRevision(id, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if r.Number != 2 || r.Title != "Second" {
+			t.Errorf("Expected revision 2, got %+v", r)
+		}
+
+		if r, err = db.GetRevision(id, 9); err != nil || r.Number != 0 {
+			t.Errorf("Expected no revision, got %+v, %v", r, err)
+		}
+	})
+
+	t.Run("Pruning keeps the current revision", func(t *testing.T) {
+		n, err := db.PruneRevisions(RetentionPolicy{Keep: 2}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n != 1 {
+			t.Errorf("Expected 1 revision to be pruned, got %d", n)
+		}
+
+		if n, err = db.PruneRevisions(RetentionPolicy{MaxAge: time.Nanosecond}, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		revisions, err := db.PostRevisions(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n != 1 || len(revisions) != 1 || revisions[0].Number != 3 {
+			t.Errorf("Expected only revision 3 to be left, got %d pruned and %+v", n, revisions)
+		}
+	})
+
+	t.Run("Revisions are deleted when the post is purged", func(t *testing.T) {
+		if err := db.DeletePost(id); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := db.PurgeTrash(time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		if revisions, err := db.PostRevisions(id); err != nil || len(revisions) != 0 {
+			t.Errorf("Expected no revisions, got %+v, %v", revisions, err)
+		}
+	})
+}
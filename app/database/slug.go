@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/lib/pq"
+
+	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/slug"
+)
+
+// slugAttempts is how many slugs a write tries, when the slug it picked is taken by another write at the same time
+const slugAttempts = 3
+
+// GetPostBySlug returns the post with the slug, current or previous, whose Id is zero when there is no such post.
+// The slug of the post returned is its current one, so callers can redirect previous slugs to it
+func (db *DB) GetPostBySlug(s string) (*models.Post, error) {
+	db = db.op("GetPostBySlug")
+
+	// current slugs are looked up first, so a slug which is current for a post never resolves to another one
+	var id int
+	err := db.QueryRow(`
+		SELECT id FROM (
+			SELECT id, 0 AS rank FROM posts WHERE slug = $1
+			UNION ALL
+			SELECT post_id, 1 FROM post_slugs WHERE slug = $1
+		) found
+		ORDER BY rank
+		LIMIT 1
+	`, s).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.Post{}, nil
+	}
+	if err != nil {
+		return &models.Post{}, err
+	}
+
+	return db.GetPostById(strconv.Itoa(id))
+}
+
+// pickSlug returns the slug of a post with the title. A post keeps its current slug when the title still makes it, and
+// may take back any of its previous slugs. Other slugs, current or previous, are taken
+func (db *DB) pickSlug(title string, postId int) (string, error) {
+	base := slug.Make(title)
+	if base == "" {
+		base = slug.Fallback
+	}
+
+	var current string
+	if postId != 0 {
+		err := db.QueryRow(`SELECT COALESCE(slug, '') FROM posts WHERE id = $1`, postId).Scan(&current)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+	}
+
+	if current != "" && slug.HasBase(current, base) {
+		return current, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT slug, post_id FROM post_slugs
+		WHERE slug = $1 OR left(slug, length($1) + 1) = $1 || '-'
+		UNION
+		SELECT slug, id FROM posts
+		WHERE slug = $1 OR left(slug, length($1) + 1) = $1 || '-'
+	`, base)
+	if err != nil {
+		return "", err
+	}
+
+	defer rows.Close()
+
+	owners := map[string]int{}
+	for rows.Next() {
+		var s string
+		var owner int
+		if err := rows.Scan(&s, &owner); err != nil {
+			return "", err
+		}
+		if owners[s] == 0 || owner != postId {
+			owners[s] = owner
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	return slug.Unique(base, func(s string) bool {
+		owner, ok := owners[s]
+		return ok && owner != postId
+	}), nil
+}
+
+// withSlug runs the write with the slug picked for the title, picking another one when a concurrent write took it first
+func (db *DB) withSlug(title string, postId int, write func(slug string) error) error {
+	for attempt := 1; ; attempt++ {
+		s, err := db.pickSlug(title, postId)
+		if err != nil {
+			return err
+		}
+
+		err = write(s)
+		if attempt < slugAttempts && slugTaken(err) {
+			continue
+		}
+
+		return err
+	}
+}
+
+// slugTaken reports whether the error is the violation of the uniqueness of slugs
+func slugTaken(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return false
+	}
+
+	return pqErr.Constraint == "posts_slug_key" || pqErr.Constraint == "post_slugs_pkey"
+}
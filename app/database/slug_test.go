@@ -0,0 +1,77 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+func TestPostSlugs(t *testing.T) {
+	clearPosts(t)
+	u := makeTestUser(t)
+
+	first := models.Post{Title: "Hello World", Author: *u}
+	second := models.Post{Title: "Hello, world!", Author: *u}
+	for _, p := range []*models.Post{&first, &second} {
+		if err := db.CreatePost(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Taken slugs get a suffix", func(t *testing.T) {
+		if first.Slug != "hello-world" || second.Slug != "hello-world-2" {
+			t.Errorf("Expected hello-world and hello-world-2, got %q and %q", first.Slug, second.Slug)
+		}
+	})
+
+	t.Run("Titles making the same slug keep it", func(t *testing.T) {
+		second.Title = "Hello World"
+		if err := db.EditPost(&second); err != nil {
+			t.Fatal(err)
+		}
+
+		if second.Slug != "hello-world-2" {
+			t.Errorf("Expected the slug to be kept, got %q", second.Slug)
+		}
+	})
+
+	t.Run("Previous slugs still name the post", func(t *testing.T) {
+		first.Title = "Hello Again"
+		if err := db.EditPost(&first); err != nil {
+			t.Fatal(err)
+		}
+
+		if first.Slug != "hello-again" {
+			t.Errorf("Expected hello-again, got %q", first.Slug)
+		}
+
+		p, err := db.GetPostBySlug("hello-world")
+		if err != nil || p.Id != first.Id || p.Slug != "hello-again" {
+			t.Errorf("Expected the renamed post with its current slug, got %+v, %v", p, err)
+		}
+
+		if p, err := db.GetPostBySlug("missing"); err != nil || p.Id != 0 {
+			t.Errorf("Expected no post, got %+v, %v", p, err)
+		}
+	})
+
+	t.Run("Posts take back their previous slugs, but not those of other posts", func(t *testing.T) {
+		first.Title = "Hello World"
+		if err := db.EditPost(&first); err != nil {
+			t.Fatal(err)
+		}
+
+		if first.Slug != "hello-world" {
+			t.Errorf("Expected hello-world to be taken back, got %q", first.Slug)
+		}
+
+		third := models.Post{Title: "Hello Again", Author: *u}
+		if err := db.CreatePost(&third); err != nil {
+			t.Fatal(err)
+		}
+
+		if third.Slug != "hello-again-2" {
+			t.Errorf("Expected hello-again-2, got %q", third.Slug)
+		}
+	})
+}
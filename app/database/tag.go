@@ -0,0 +1,107 @@
+package database
+
+import (
+	"github.com/lib/pq"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+// TagStore is the store interface for the tags of posts
+type TagStore interface {
+	Tags(q PostQuery) ([]models.TagCount, error)
+}
+
+// tagPost returns the common table expressions which tag the post returned by the CTE named post with the slugs in
+// the text array parameter slugs, creating the tags which do not exist yet, and untag it from every other tag
+func tagPost(post, slugs string) string {
+	return `
+	wanted AS (
+		SELECT DISTINCT unnest(` + slugs + `::text[]) AS slug
+	), new_tags AS (
+		INSERT INTO tags (slug) SELECT slug FROM wanted
+		ON CONFLICT (slug) DO NOTHING
+		RETURNING id
+	), tagged AS (
+		SELECT id FROM new_tags
+		UNION
+		SELECT tags.id FROM tags JOIN wanted ON wanted.slug = tags.slug
+	), untagged AS (
+		DELETE FROM post_tags
+		WHERE post_id IN (SELECT id FROM ` + post + `) AND tag_id NOT IN (SELECT id FROM tagged)
+	), retagged AS (
+		INSERT INTO post_tags (post_id, tag_id)
+		SELECT ` + post + `.id, tagged.id FROM ` + post + `, tagged
+		ON CONFLICT DO NOTHING
+	)`
+}
+
+// Tags returns the tags of the posts the query lists, with how many of those posts each is on, most used first
+func (db *DB) Tags(q PostQuery) ([]models.TagCount, error) {
+	db = db.op("Tags")
+
+	where, args := q.where()
+	rows, err := db.Query(`
+		SELECT tags.slug, COUNT(*)
+		FROM tags
+		JOIN post_tags ON post_tags.tag_id = tags.id
+		JOIN posts ON posts.id = post_tags.post_id
+		WHERE `+where+`
+		GROUP BY tags.slug
+		ORDER BY COUNT(*) DESC, tags.slug
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tags []models.TagCount
+	for rows.Next() {
+		var t models.TagCount
+		if err := rows.Scan(&t.Tag, &t.Posts); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// loadTags sets the tags of the posts with a single query, rather than one for each post
+func (db *DB) loadTags(posts []*models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	byId := make(map[int]*models.Post, len(posts))
+	ids := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		byId[p.Id] = p
+		ids = append(ids, int64(p.Id))
+	}
+
+	rows, err := db.Query(`
+		SELECT post_tags.post_id, tags.slug
+		FROM post_tags
+		JOIN tags ON tags.id = post_tags.tag_id
+		WHERE post_tags.post_id = ANY($1)
+		ORDER BY tags.slug
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var slug string
+		if err := rows.Scan(&id, &slug); err != nil {
+			return err
+		}
+		if p := byId[id]; p != nil {
+			p.Tags = append(p.Tags, slug)
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+func TestTags(t *testing.T) {
+	clearPosts(t)
+	u := makeTestUser(t)
+
+	first := models.Post{Title: "First", Author: *u, Tags: []string{"go", "sql"}, Category: "tutorials"}
+	second := models.Post{Title: "Second", Author: *u, Tags: []string{"go"}}
+	for _, p := range []*models.Post{&first, &second} {
+		if err := db.CreatePost(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Posts are loaded with their tags", func(t *testing.T) {
+		posts, err := db.AllPosts(PostQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tags := map[int][]string{}
+		for _, p := range posts {
+			tags[p.Id] = p.Tags
+		}
+		if !reflect.DeepEqual(tags[first.Id], []string{"go", "sql"}) || !reflect.DeepEqual(tags[second.Id], []string{"go"}) {
+			t.Errorf("Unexpected tags %v", tags)
+		}
+
+		p, err := db.GetPostById(strconv.Itoa(first.Id))
+		if err != nil || !reflect.DeepEqual(p.Tags, []string{"go", "sql"}) || p.Category != "tutorials" {
+			t.Errorf("Expected the tags and category, got %+v, %v", p, err)
+		}
+	})
+
+	t.Run("Posts are filtered by tag and category", func(t *testing.T) {
+		if posts, err := db.AllPosts(PostQuery{Tag: "sql"}); err != nil || len(posts) != 1 || posts[0].Id != first.Id {
+			t.Errorf("Expected the first post, got %v, %v", posts, err)
+		}
+
+		if posts, err := db.AllPosts(PostQuery{Category: "tutorials", Tag: "go"}); err != nil || len(posts) != 1 {
+			t.Errorf("Expected the first post, got %v, %v", posts, err)
+		}
+	})
+
+	t.Run("Tags are counted and replaced by edits", func(t *testing.T) {
+		counts, err := db.Tags(PostQuery{})
+		expected := []models.TagCount{{Tag: "go", Posts: 2}, {Tag: "sql", Posts: 1}}
+		if err != nil || !reflect.DeepEqual(counts, expected) {
+			t.Errorf("Expected %v, got %v, %v", expected, counts, err)
+		}
+
+		second.Tags = []string{"sql", "web"}
+		if err := db.EditPost(&second); err != nil {
+			t.Fatal(err)
+		}
+
+		counts, err = db.Tags(PostQuery{})
+		expected = []models.TagCount{{Tag: "sql", Posts: 2}, {Tag: "go", Posts: 1}, {Tag: "web", Posts: 1}}
+		if err != nil || !reflect.DeepEqual(counts, expected) {
+			t.Errorf("Expected %v, got %v, %v", expected, counts, err)
+		}
+	})
+}
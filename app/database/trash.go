@@ -0,0 +1,233 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+// TrashStore is the store interface for the posts and users which were deleted but not yet purged
+type TrashStore interface {
+	TrashedPosts(userId int) ([]*models.Post, error)
+	GetTrashedPost(id string) (*models.Post, error)
+	RestorePost(id string) error
+	DeletedUsers() ([]models.User, error)
+	RestoreUser(id int) error
+	PurgeTrash(before time.Time) (posts int64, users int64, err error)
+}
+
+// ErrNotInTrash is returned when restoring a post or user which is not in the trash. A post whose author is in the
+// trash cannot be restored on its own
+var ErrNotInTrash = errors.New("not in the trash")
+
+const selectTrashedPosts = `
+	SELECT posts.id,
+	       users.id,
+	       users.email,
+	       posts.body,
+	       posts.title,
+	       posts.created_at,
+	       posts.modified_at,
+	       posts.version,
+	       posts.status,
+	       posts.published_at,
+	       posts.deleted_at,
+	       posts.category,
+	       COALESCE(posts.slug, '')
+	FROM posts
+	JOIN users ON users.id = posts.user_id
+	WHERE posts.deleted_at IS NOT NULL
+`
+
+func scanTrashedPost(rows *sql.Rows) (*models.Post, error) {
+	var p models.Post
+	err := rows.Scan(&p.Id, &p.Author.Id, &p.Author.Email, &p.Body, &p.Title, &p.CreatedAt, &p.ModifiedAt, &p.Version,
+		&p.Status, &p.PublishedAt, &p.DeletedAt, &p.Category, &p.Slug)
+	return &p, err
+}
+
+// TrashedPosts returns the posts of the user in the trash, most recently deleted first
+func (db *DB) TrashedPosts(userId int) ([]*models.Post, error) {
+	db = db.op("TrashedPosts")
+
+	rows, err := db.Query(selectTrashedPosts+`
+		AND posts.user_id = $1
+		ORDER BY posts.deleted_at DESC, posts.id DESC
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var posts []*models.Post
+	for rows.Next() {
+		p, err := scanTrashedPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, db.loadTags(posts)
+}
+
+// GetTrashedPost returns a post in the trash, whose Id is zero when there is no such post
+func (db *DB) GetTrashedPost(id string) (*models.Post, error) {
+	db = db.op("GetTrashedPost")
+
+	rows, err := db.Query(selectTrashedPosts+`AND posts.id = $1`, id)
+	if err != nil {
+		return &models.Post{}, err
+	}
+
+	defer rows.Close()
+
+	p := &models.Post{}
+	for rows.Next() {
+		if p, err = scanTrashedPost(rows); err != nil {
+			return p, err
+		}
+	}
+
+	if p.Id == 0 {
+		return p, rows.Err()
+	}
+
+	return p, db.loadTags([]*models.Post{p})
+}
+
+// RestorePost takes the post out of the trash
+func (db *DB) RestorePost(id string) error {
+	db = db.op("RestorePost")
+
+	res, err := db.Exec(`
+		UPDATE posts SET deleted_at = NULL, modified_at = $2
+		FROM users
+		WHERE posts.id = $1 AND posts.deleted_at IS NOT NULL
+		  AND users.id = posts.user_id AND users.deleted_at IS NULL
+	`, id, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return trashAffected(res)
+}
+
+// DeletedUsers returns the users in the trash, most recently deleted first
+func (db *DB) DeletedUsers() ([]models.User, error) {
+	db = db.op("DeletedUsers")
+
+	rows, err := db.Query(`
+		SELECT id, email, totp_enabled, role, created_at, modified_at, deleted_at
+		FROM users
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.Id, &u.Email, &u.TOTPEnabled, &u.Role, &u.CreatedAt, &u.ModifiedAt, &u.DeletedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// RestoreUser takes the user out of the trash along with the posts deleted with them. Posts the user deleted before
+// their account stay in the trash. Their sessions were ended by DeleteUser, so they have to log in again
+func (db *DB) RestoreUser(id int) error {
+	db = db.op("RestoreUser")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var deletedAt time.Time
+	err = tx.QueryRow(`
+		UPDATE users SET deleted_at = NULL
+		FROM (SELECT id, deleted_at FROM users WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE) deleted
+		WHERE users.id = deleted.id
+		RETURNING deleted.deleted_at
+	`, id).Scan(&deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNotInTrash
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE posts SET deleted_at = NULL, modified_at = $3 WHERE user_id = $1 AND deleted_at = $2
+	`, id, deletedAt, time.Now().UTC()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeTrash deletes the posts and users moved to the trash before the given time for good, and returns how many of
+// each were deleted. The posts of purged users are deleted with them
+func (db *DB) PurgeTrash(before time.Time) (posts int64, users int64, err error) {
+	db = db.op("PurgeTrash")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	before = before.UTC()
+	res, err := tx.Exec(`
+		DELETE FROM posts
+		WHERE deleted_at < $1
+		   OR user_id IN (SELECT id FROM users WHERE deleted_at < $1)
+	`, before)
+	if err == nil {
+		posts, err = res.RowsAffected()
+	}
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM user_sessions WHERE user_id IN (SELECT id FROM users WHERE deleted_at < $1)`, before)
+	}
+	if err == nil {
+		res, err = tx.Exec(`DELETE FROM users WHERE deleted_at < $1`, before)
+	}
+	if err == nil {
+		users, err = res.RowsAffected()
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, err
+	}
+
+	return posts, users, tx.Commit()
+}
+
+func trashAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotInTrash
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+func TestTrash(t *testing.T) {
+	clearPosts(t)
+	u := makeTestUser(t)
+
+	create := func(title string) string {
+		t.Helper()
+		p := models.Post{Title: title, Body: "Body", Author: *u}
+		if err := db.CreatePost(&p); err != nil {
+			t.Fatal(err)
+		}
+		return strconv.Itoa(p.Id)
+	}
+
+	earlier, kept := create("Deleted first"), create("Kept")
+	if err := db.DeletePost(earlier); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Deleted posts are listed in the trash only", func(t *testing.T) {
+		posts, err := db.AllPosts(PostQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != 1 || strconv.Itoa(posts[0].Id) != kept {
+			t.Errorf("Expected only the kept post, got %+v", posts)
+		}
+
+		trashed, err := db.TrashedPosts(u.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(trashed) != 1 || strconv.Itoa(trashed[0].Id) != earlier || trashed[0].DeletedAt == nil {
+			t.Errorf("Expected the deleted post, got %+v", trashed)
+		}
+	})
+
+	t.Run("Deleting a user hides them and their posts", func(t *testing.T) {
+		if err := db.DeleteUser(u.Id); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.GetUserById(u.Id); err == nil {
+			t.Error("Expected the user to be hidden")
+		}
+
+		if p, err := db.GetPostById(kept); err != nil || p.Id != 0 {
+			t.Errorf("Expected the post to be hidden, got %+v, %v", p, err)
+		}
+
+		if err := db.RestorePost(kept); !errors.Is(err, ErrNotInTrash) {
+			t.Errorf("Expected posts of deleted users not to be restored, got %v", err)
+		}
+	})
+
+	t.Run("Restoring a user restores the posts deleted with them", func(t *testing.T) {
+		if err := db.RestoreUser(u.Id); err != nil {
+			t.Fatal(err)
+		}
+
+		if p, err := db.GetPostById(kept); err != nil || p.Id == 0 {
+			t.Errorf("Expected the post to be restored, got %+v, %v", p, err)
+		}
+
+		if p, err := db.GetPostById(earlier); err != nil || p.Id != 0 {
+			t.Errorf("Expected the earlier post to stay in the trash, got %+v, %v", p, err)
+		}
+
+		if err := db.RestoreUser(u.Id); !errors.Is(err, ErrNotInTrash) {
+			t.Errorf("Expected ErrNotInTrash, got %v", err)
+		}
+	})
+
+	t.Run("Purging deletes what was trashed before the cutoff", func(t *testing.T) {
+		posts, users, err := db.PurgeTrash(time.Now().Add(-time.Hour))
+		if err != nil || posts != 0 || users != 0 {
+			t.Errorf("Expected nothing to be purged, got %d, %d, %v", posts, users, err)
+		}
+
+		posts, users, err = db.PurgeTrash(time.Now().Add(time.Hour))
+		if err != nil || posts != 1 || users != 0 {
+			t.Errorf("Expected the deleted post to be purged, got %d, %d, %v", posts, users, err)
+		}
+
+		if p, err := db.GetTrashedPost(earlier); err != nil || p.Id != 0 {
+			t.Errorf("Expected the post to be gone, got %+v, %v", p, err)
+		}
+	})
+}
+
+func TestTrashPostsVersion(t *testing.T) {
+	clearPosts(t)
+	u := makeTestUser(t)
+
+	var ids []string
+	for _, title := range []string{"Restored", "Deleted", "Newest"} {
+		p := models.Post{Title: title, Body: "Body", Author: *u}
+		if err := db.CreatePost(&p); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, strconv.Itoa(p.Id))
+	}
+	restored, deleted := ids[0], ids[1]
+
+	if err := db.DeletePost(restored); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := db.PostsVersion(PostQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the list has as many posts, and the same newest one, after swapping a post for another
+	if err := db.DeletePost(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RestorePost(restored); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := db.PostsVersion(PostQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.Count != before.Count || after.MaxId != before.MaxId {
+		t.Fatalf("Expected the same number of posts and newest post, got %+v and %+v", before, after)
+	}
+
+	if !after.LastModified.After(before.LastModified) {
+		t.Errorf("Expected the version to change, got %+v and %+v", before, after)
+	}
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TwoFactorStore is the interface for storing TOTP secrets and recovery codes
+type TwoFactorStore interface {
+	SetTOTPSecret(userId int, secret string) error
+	EnableTOTP(userId int, recoveryCodes []string) error
+	DisableTOTP(userId int) error
+	UseRecoveryCode(userId int, code string) (bool, error)
+	UseTOTPStep(userId int, step int64) (bool, error)
+}
+
+// SetTOTPSecret stores a secret that is pending confirmation, two factor stays disabled until EnableTOTP is called
+func (db *DB) SetTOTPSecret(userId int, secret string) error {
+	db = db.op("SetTOTPSecret")
+
+	_, err := db.Exec(`
+		UPDATE users SET totp_secret = $2, totp_enabled = FALSE WHERE id = $1
+	`, userId, secret)
+
+	return err
+}
+
+// EnableTOTP turns on two factor for the user, replacing any previous recovery codes with digests of the new ones
+func (db *DB) EnableTOTP(userId int, recoveryCodes []string) error {
+	db = db.op("EnableTOTP")
+
+	digests := make([]string, len(recoveryCodes))
+	for i, c := range recoveryCodes {
+		d, err := bcrypt.GenerateFromPassword([]byte(c), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		digests[i] = string(d)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET totp_enabled = TRUE WHERE id = $1`, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, d := range digests {
+		if _, err := tx.Exec(`
+			INSERT INTO recovery_codes (user_id, code_digest) VALUES ($1, $2)
+		`, userId, d); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two factor, removing the secret and all recovery codes
+func (db *DB) DisableTOTP(userId int) error {
+	db = db.op("DisableTOTP")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE users SET totp_secret = '', totp_enabled = FALSE WHERE id = $1
+	`, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode checks the code against the user's unused recovery codes, and marks it as used if it matches
+func (db *DB) UseRecoveryCode(userId int, code string) (bool, error) {
+	db = db.op("UseRecoveryCode")
+
+	rows, err := db.Query(`
+		SELECT id, code_digest FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL
+	`, userId)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer rows.Close()
+
+	var matchId int
+	for rows.Next() {
+		var id int
+		var digest string
+		if err := rows.Scan(&id, &digest); err != nil {
+			return false, err
+		}
+
+		if bcrypt.CompareHashAndPassword([]byte(digest), []byte(code)) == nil {
+			matchId = id
+			break
+		}
+	}
+
+	if matchId == 0 {
+		return false, nil
+	}
+
+	res, err := db.Exec(`
+		UPDATE recovery_codes SET used_at = $2 WHERE id = $1 AND used_at IS NULL
+	`, matchId, time.Now().UTC())
+
+	if err != nil {
+		return false, err
+	}
+
+	// a concurrent request may have used the same code first
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// UseTOTPStep records the time step of a code the user authenticated with. It returns false when a code from the same
+// or a later step was already used, so every code is only accepted once
+func (db *DB) UseTOTPStep(userId int, step int64) (bool, error) {
+	db = db.op("UseTOTPStep")
+
+	res, err := db.Exec(`
+		UPDATE users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2
+	`, userId, step)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
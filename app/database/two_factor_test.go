@@ -0,0 +1,97 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+func TestTwoFactor(t *testing.T) {
+	clearUsers(t)
+
+	u := models.User{Email: "twofactor@fake.com", PasswordDigest: "testDigest"}
+	u.Id = createTestUser(&u, t)
+
+	t.Run("Setting a secret leaves two factor disabled", func(t *testing.T) {
+		if err := db.SetTOTPSecret(u.Id, "JBSWY3DPEHPK3PXP"); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := db.GetUserById(u.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found.TOTPSecret != "JBSWY3DPEHPK3PXP" || found.TOTPEnabled {
+			t.Errorf("Expected a pending secret, got %v", found)
+		}
+	})
+
+	t.Run("Enabling stores recovery codes that can be used once", func(t *testing.T) {
+		if err := db.EnableTOTP(u.Id, []string{"aaaaa-bbbbb", "ccccc-ddddd"}); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := db.GetUserById(u.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !found.TOTPEnabled {
+			t.Error("Expected two factor to be enabled")
+		}
+
+		if ok, err := db.UseRecoveryCode(u.Id, "aaaaa-bbbbb"); err != nil || !ok {
+			t.Errorf("Expected the recovery code to be accepted, got %t, %v", ok, err)
+		}
+
+		if ok, err := db.UseRecoveryCode(u.Id, "aaaaa-bbbbb"); err != nil || ok {
+			t.Errorf("Expected a used recovery code to be rejected, got %t, %v", ok, err)
+		}
+
+		if ok, err := db.UseRecoveryCode(u.Id, "wrong-code"); err != nil || ok {
+			t.Errorf("Expected an unknown recovery code to be rejected, got %t, %v", ok, err)
+		}
+	})
+
+	t.Run("Codes are only accepted once", func(t *testing.T) {
+		if ok, err := db.UseTOTPStep(u.Id, 100); err != nil || !ok {
+			t.Errorf("Expected the step to be accepted, got %t, %v", ok, err)
+		}
+
+		for _, step := range []int64{100, 99} {
+			if ok, err := db.UseTOTPStep(u.Id, step); err != nil || ok {
+				t.Errorf("Expected step %d to be rejected, got %t, %v", step, ok, err)
+			}
+		}
+
+		if ok, err := db.UseTOTPStep(u.Id, 101); err != nil || !ok {
+			t.Errorf("Expected a later step to be accepted, got %t, %v", ok, err)
+		}
+	})
+
+	t.Run("Disabling removes the secret and codes", func(t *testing.T) {
+		if err := db.DisableTOTP(u.Id); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := db.GetUserById(u.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found.TOTPSecret != "" || found.TOTPEnabled {
+			t.Errorf("Expected two factor to be removed, got %v", found)
+		}
+
+		if ok, _ := db.UseRecoveryCode(u.Id, "ccccc-ddddd"); ok {
+			t.Error("Expected recovery codes to be removed")
+		}
+	})
+
+	t.Run("Unknown users return an error", func(t *testing.T) {
+		if _, err := db.GetUserById(u.Id + 1000); err == nil {
+			t.Error("Expected an error for a missing user")
+		}
+	})
+}
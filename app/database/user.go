@@ -1,20 +1,39 @@
 package database
 
-import "github.com/alexandersmanning/simcha/app/models"
+import (
+	"database/sql"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//dummyDigest is compared against when an email is unknown, so the response takes as long as for a wrong password
+var dummyDigest, _ = bcrypt.GenerateFromPassword([]byte("simcha-dummy-password"), bcrypt.DefaultCost)
 
 //UserStore is the interface for all User functions that interact with the database
 type UserStore interface {
 	GetUserByEmailAndPassword(email, password string) (models.User, error)
+	GetUserById(id int) (models.User, error)
 	UpdatePassword(u models.UserAction, previousPassword, password, confirmationPassword string) error
 	UserExists(email string) (bool, error)
+	EmailTaken(email string) (bool, error)
 	CreateUser(u models.UserAction) error
+	GetUserByEmail(email string) (models.User, error)
+	ListUsers() ([]models.User, error)
+	SetUserRole(id int, role string) error
+	SetUserEmail(id int, email string) error
+	ResetPassword(id int, password string) error
+	DeleteUser(id int) error
 }
 
 //GetUserByEmailAndPassword checks if the user is in the database, and if it is verifies if the password matches
 func (db *DB) GetUserByEmailAndPassword(email, password string) (models.User, error) {
+	db = db.op("GetUserByEmailAndPassword")
+
 	u := models.User{}
 	rows, err := db.Query(
-		`SELECT id, email, password_digest FROM users WHERE email = $1`,
+		`SELECT id, email, password_digest, totp_enabled FROM users WHERE email = $1 AND deleted_at IS NULL`,
 		email,
 	)
 
@@ -25,11 +44,15 @@ func (db *DB) GetUserByEmailAndPassword(email, password string) (models.User, er
 	defer rows.Close()
 
 	for rows.Next() {
-		if err := rows.Scan(&u.Id, &u.Email, &u.PasswordDigest); err != nil {
+		if err := rows.Scan(&u.Id, &u.Email, &u.PasswordDigest, &u.TOTPEnabled); err != nil {
 			return models.User{}, err
 		}
 	}
 
+	if u.Email == "" {
+		u.PasswordDigest = string(dummyDigest)
+	}
+
 	err = u.ComparePassword(password)
 
 	if u.Email == "" || err != nil {
@@ -39,7 +62,39 @@ func (db *DB) GetUserByEmailAndPassword(email, password string) (models.User, er
 	return u, nil
 }
 
+//GetUserById returns the user with their two factor settings, or a ModelError if they do not exist
+func (db *DB) GetUserById(id int) (models.User, error) {
+	db = db.op("GetUserById")
+
+	var u models.User
+	rows, err := db.Query(`
+		SELECT id, email, totp_secret, totp_enabled, role, created_at, modified_at
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id)
+
+	if err != nil {
+		return u, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := rows.Scan(&u.Id, &u.Email, &u.TOTPSecret, &u.TOTPEnabled, &u.Role, &u.CreatedAt, &u.ModifiedAt); err != nil {
+			return models.User{}, err
+		}
+	}
+
+	if u.Id == 0 {
+		return u, &models.ModelError{FieldName: "User", ErrorText: "was not found"}
+	}
+
+	return u, nil
+}
+
 func (db *DB) UpdatePassword(ua models.UserAction, previousPassword, password, confirmationPassword string) error {
+	db = db.op("UpdatePassword")
+
 	//Verify password for the new user
 	if err := ua.ComparePassword(previousPassword); err != nil {
 		return &models.ModelError{"Previous Password", "Does not match current password"}
@@ -71,10 +126,24 @@ func (db *DB) UpdatePassword(ua models.UserAction, previousPassword, password, c
 	return nil
 }
 
-//UserExists checks the existence of an email
+//UserExists checks the existence of an email. Users in the trash do not count
 func (db *DB) UserExists(email string) (bool, error) {
+	db = db.op("UserExists")
+
+	return db.countEmail(`SELECT COUNT(*) FROM users WHERE email = $1 AND deleted_at IS NULL`, email)
+}
+
+//EmailTaken checks whether any user has the email, including the users in the trash who keep it until they are
+//purged. It is the check CreateUser and SetUserEmail make
+func (db *DB) EmailTaken(email string) (bool, error) {
+	db = db.op("EmailTaken")
+
+	return db.countEmail(`SELECT COUNT(*) FROM users WHERE email = $1`, email)
+}
+
+func (db *DB) countEmail(query, email string) (bool, error) {
 	var count int
-	rows, err := db.Query("SELECT COUNT(*) FROM users WHERE email = $1", email)
+	rows, err := db.Query(query, email)
 
 	if err != nil {
 		return false, err
@@ -96,7 +165,9 @@ func (db *DB) UserExists(email string) (bool, error) {
 
 //CreateUser adds user to system if they do not already exist, and have an appropriate email/password
 func (db *DB) CreateUser(ua models.UserAction) error {
-	if exists, err := db.UserExists(ua.User().Email); err != nil {
+	db = db.op("CreateUser")
+
+	if exists, err := db.EmailTaken(ua.User().Email); err != nil {
 		return err
 	} else if exists {
 		return &models.ModelError{"Email", "already exists in the system"}
@@ -136,3 +207,172 @@ func (db *DB) CreateUser(ua models.UserAction) error {
 
 	return nil
 }
+
+//GetUserByEmail returns the user, or a ModelError if they do not exist
+func (db *DB) GetUserByEmail(email string) (models.User, error) {
+	db = db.op("GetUserByEmail")
+
+	var u models.User
+	rows, err := db.Query(`
+		SELECT id, email, totp_enabled, role, created_at, modified_at
+		FROM users
+		WHERE email = $1 AND deleted_at IS NULL
+	`, email)
+
+	if err != nil {
+		return u, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := rows.Scan(&u.Id, &u.Email, &u.TOTPEnabled, &u.Role, &u.CreatedAt, &u.ModifiedAt); err != nil {
+			return models.User{}, err
+		}
+	}
+
+	if u.Id == 0 {
+		return u, &models.ModelError{FieldName: "User", ErrorText: "was not found"}
+	}
+
+	return u, nil
+}
+
+//ListUsers returns every user who is not in the trash, oldest first
+func (db *DB) ListUsers() ([]models.User, error) {
+	db = db.op("ListUsers")
+
+	rows, err := db.Query(`
+		SELECT id, email, totp_enabled, role, created_at, modified_at
+		FROM users
+		WHERE deleted_at IS NULL
+		ORDER BY id
+	`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.Id, &u.Email, &u.TOTPEnabled, &u.Role, &u.CreatedAt, &u.ModifiedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+//SetUserRole changes the role of the user
+func (db *DB) SetUserRole(id int, role string) error {
+	db = db.op("SetUserRole")
+
+	if !models.ValidRole(role) {
+		return &models.ModelError{FieldName: "Role", ErrorText: "must be " + models.RoleUser + " or " + models.RoleAdmin}
+	}
+
+	res, err := db.Exec(`UPDATE users SET role = $1, modified_at = $2 WHERE id = $3`, role, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return userAffected(res)
+}
+
+//SetUserEmail changes the email of the user, which must be valid and not used by another user
+func (db *DB) SetUserEmail(id int, email string) error {
+	db = db.op("SetUserEmail")
+
+	if !models.ValidEmail(email) {
+		return &models.ModelError{FieldName: "Email", ErrorText: "is not a valid address"}
+	}
+
+	if exists, err := db.EmailTaken(email); err != nil {
+		return err
+	} else if exists {
+		return &models.ModelError{FieldName: "Email", ErrorText: "already exists in the system"}
+	}
+
+	res, err := db.Exec(`UPDATE users SET email = $1, modified_at = $2 WHERE id = $3`, email, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return userAffected(res)
+}
+
+//ResetPassword sets a new password without the previous one, and logs the user out everywhere
+func (db *DB) ResetPassword(id int, password string) error {
+	db = db.op("ResetPassword")
+
+	u := &models.User{Password: password, ConfirmationPassword: password}
+	digest, err := u.CreateDigest()
+	if err != nil {
+		return err
+	}
+
+	res, err := db.Exec(`UPDATE users SET password_digest = $1, modified_at = $2 WHERE id = $3`, digest, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := userAffected(res); err != nil {
+		return err
+	}
+
+	return db.RemoveAllUserSessions(id)
+}
+
+//DeleteUser moves the user to the trash along with their posts, and ends their sessions. The posts are moved at the
+//same time as the user, so RestoreUser restores them without the posts which were already in the trash
+func (db *DB) DeleteUser(id int) error {
+	db = db.op("DeleteUser")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	deletedAt := time.Now().UTC()
+	res, err := tx.Exec(`UPDATE users SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`, id, deletedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := userAffected(res); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_sessions WHERE user_id = $1`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE posts SET deleted_at = $2, modified_at = $2 WHERE user_id = $1 AND deleted_at IS NULL`, id, deletedAt,
+	); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func userAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return &models.ModelError{FieldName: "User", ErrorText: "was not found"}
+	}
+
+	return nil
+}
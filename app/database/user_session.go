@@ -10,9 +10,13 @@ type UserSessionStore interface {
 	GetUserBySessionToken(userId int, token string) (models.User, error)
 	RemoveSessionToken(userId int, token string) error
 	RemoveAllUserSessions(userId int) error
+	CountUserSessions() (int, error)
+	PurgeSessions() (int64, error)
 }
 
 func (db *DB) CreateUserSession(u *models.User) (models.UserSession, error) {
+	db = db.op("CreateUserSession")
+
 	var us models.UserSession
 
 	token, err := CreateSessionToken()
@@ -43,13 +47,15 @@ func (db *DB) CreateUserSession(u *models.User) (models.UserSession, error) {
 }
 
 func (db *DB) GetUserBySessionToken(userId int, token string) (models.User, error) {
+	db = db.op("GetUserBySessionToken")
+
 	var u models.User
 
 	rows, err := db.Query(`
-		SELECT DISTINCT users.id, users.email
+		SELECT DISTINCT users.id, users.email, users.role
 		FROM users
 		JOIN user_sessions ON (user_sessions.user_id = users.id)
-		WHERE user_sessions.user_id = $1 AND user_sessions.session_token = $2
+		WHERE user_sessions.user_id = $1 AND user_sessions.session_token = $2 AND users.deleted_at IS NULL
 	`, userId, token)
 
 	defer rows.Close()
@@ -59,7 +65,7 @@ func (db *DB) GetUserBySessionToken(userId int, token string) (models.User, erro
 	}
 
 	for rows.Next() {
-		if err := rows.Scan(&u.Id, &u.Email); err != nil {
+		if err := rows.Scan(&u.Id, &u.Email, &u.Role); err != nil {
 			return u, err
 		}
 	}
@@ -68,6 +74,8 @@ func (db *DB) GetUserBySessionToken(userId int, token string) (models.User, erro
 }
 
 func (db *DB) RemoveSessionToken(userId int, token string) error {
+	db = db.op("RemoveSessionToken")
+
 	rows, err := db.Query(`
 		DELETE FROM user_sessions WHERE user_id = $1 AND session_token = $2
 	`, userId, token)
@@ -82,6 +90,8 @@ func (db *DB) RemoveSessionToken(userId int, token string) error {
 }
 
 func (db *DB) RemoveAllUserSessions(userId int) error {
+	db = db.op("RemoveAllUserSessions")
+
 	rows, err := db.Query(`
 		DELETE FROM user_sessions WHERE user_id = $1
 	`, userId)
@@ -95,6 +105,27 @@ func (db *DB) RemoveAllUserSessions(userId int) error {
 	return nil
 }
 
+//CountUserSessions returns the number of sessions which have not been logged out
+func (db *DB) CountUserSessions() (int, error) {
+	db = db.op("CountUserSessions")
+
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM user_sessions`).Scan(&n)
+	return n, err
+}
+
+//PurgeSessions logs every user out, and returns how many sessions were removed
+func (db *DB) PurgeSessions() (int64, error) {
+	db = db.op("PurgeSessions")
+
+	res, err := db.Exec(`DELETE FROM user_sessions`)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
 func CreateSessionToken() (string, error) {
 	token, err := webapputil.GenerateSecureRandom()
 	if err != nil {
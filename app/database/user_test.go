@@ -1,6 +1,7 @@
 package database
 
 import (
+	"fmt"
 	"github.com/alexandersmanning/simcha/app/mocks/model"
 	"github.com/alexandersmanning/simcha/app/models"
 	"github.com/golang/mock/gomock"
@@ -60,6 +61,25 @@ func TestUserExists(t *testing.T) {
 		}
 
 	})
+
+	t.Run("Users in the trash", func(t *testing.T) {
+		clearUsers(t)
+		u := makeTestUser(t)
+		if err := db.DeleteUser(u.Id); err != nil {
+			t.Fatal(err)
+		}
+
+		existsTest(u.Email, false, t)
+
+		if taken, err := db.EmailTaken(u.Email); err != nil || !taken {
+			t.Errorf("Expected the email of a user in the trash to be taken, got %t, %v", taken, err)
+		}
+
+		taken := models.User{Email: u.Email, Password: "goodpassword", ConfirmationPassword: "goodpassword"}
+		if err := db.CreateUser(&taken); err == nil {
+			t.Error("Expected the email of a user in the trash to stay taken")
+		}
+	})
 }
 
 func TestCreateUser(t *testing.T) {
@@ -306,3 +326,37 @@ func TestRemoveAllUserSessions(t *testing.T) {
 		helperFunc(0, t)
 	})
 }
+
+func TestSetUserEmail(t *testing.T) {
+	u := makeTestUser(t)
+	other := makeTestUser(t)
+
+	t.Run("It changes the email", func(t *testing.T) {
+		email := fmt.Sprintf("changed%d@example.com", u.Id)
+		if err := db.SetUserEmail(u.Id, email); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := db.GetUserById(u.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found.Email != email {
+			t.Errorf("Expected %s, got %s", email, found.Email)
+		}
+	})
+
+	t.Run("It refuses invalid and taken emails", func(t *testing.T) {
+		taken := fmt.Sprintf("taken%d@example.com", other.Id)
+		if err := db.SetUserEmail(other.Id, taken); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, email := range []string{"not an email", "Name <name@example.com>", taken} {
+			if err := db.SetUserEmail(u.Id, email); err == nil {
+				t.Errorf("Expected %q to be refused", email)
+			}
+		}
+	})
+}
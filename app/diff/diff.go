@@ -0,0 +1,281 @@
+/*
+Package diff compares texts line by line, as unified diffs, or word by word
+*/
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Op is what an Edit does to the text
+type Op string
+
+// Edit operations
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Edit is a run of text which is kept, inserted or deleted
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// DefaultContext is the number of unchanged lines shown around each change of a unified diff
+const DefaultContext = 3
+
+// Words compares a and b word by word, with whitespace compared like words. Consecutive edits with the same Op are
+// merged, so the edits alternate between the runs of text kept and the runs changed
+func Words(a, b string) []Edit {
+	var edits []Edit
+	for _, e := range compare(words(a), words(b)) {
+		if n := len(edits); n > 0 && edits[n-1].Op == e.Op {
+			edits[n-1].Text += e.Text
+		} else {
+			edits = append(edits, e)
+		}
+	}
+
+	return edits
+}
+
+// Unified compares a and b line by line, and returns the changes in the unified format, with context unchanged lines
+// around them, or an empty string when the texts are equal
+func Unified(fromName, toName, a, b string, context int) string {
+	edits := compare(lines(a), lines(b))
+
+	var out strings.Builder
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+
+		// a hunk extends over the unchanged lines between changes, unless they are too many to show as context
+		end := i
+		for end < len(edits) {
+			if edits[end].Op != Equal {
+				end++
+				continue
+			}
+
+			run := end
+			for run < len(edits) && edits[run].Op == Equal {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+
+		start, stop := max(i-context, 0), min(end+context, len(edits))
+		writeHunk(&out, edits, start, stop)
+		i = stop
+	}
+
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, edits []Edit, start, stop int) {
+	var fromLine, toLine int
+	for _, e := range edits[:start] {
+		if e.Op != Insert {
+			fromLine++
+		}
+		if e.Op != Delete {
+			toLine++
+		}
+	}
+
+	var fromCount, toCount int
+	for _, e := range edits[start:stop] {
+		if e.Op != Insert {
+			fromCount++
+		}
+		if e.Op != Delete {
+			toCount++
+		}
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+
+	prefix := map[Op]string{Equal: " ", Delete: "-", Insert: "+"}
+	for _, e := range edits[start:stop] {
+		out.WriteString(prefix[e.Op])
+		out.WriteString(e.Text)
+		if !strings.HasSuffix(e.Text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the lines of a hunk. Empty ranges start at the line before them, and ranges of one line have no
+// count, as in GNU diff
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	}
+
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// lines splits s after each newline, so a missing newline at the end is a difference
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	tokens := strings.SplitAfter(s, "\n")
+	if tokens[len(tokens)-1] == "" {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	return tokens
+}
+
+// words splits s into runs of letters and digits, runs of whitespace, and single punctuation characters
+func words(s string) []string {
+	var tokens []string
+	start := 0
+	kind := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 0
+	}
+
+	prev := -1
+	for i, r := range s {
+		k := kind(r)
+		if i > start && (k != prev || k == 0) {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		prev = k
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+
+	return tokens
+}
+
+// compare returns the edits turning a into b, with one edit per token, using Myers' algorithm on the tokens left once
+// the common prefix and suffix are set aside
+func compare(a, b []string) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]Edit, 0, len(a)+len(b))
+	for _, t := range a[:prefix] {
+		edits = append(edits, Edit{Equal, t})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, t := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Equal, t})
+	}
+
+	return edits
+}
+
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	limit := n + m
+	offset := limit + 1
+
+	// v[offset+k] is the furthest x reached on diagonal k. trace keeps v, for the diagonals used, before each step d,
+	// to walk the path back once b is reached
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+
+	return nil
+}
+
+func backtrack(a, b []string, trace [][]int) []Edit {
+	var edits []Edit
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, Edit{Equal, a[x]})
+		}
+
+		if x == prevX {
+			edits = append(edits, Edit{Insert, b[prevY]})
+		} else {
+			edits = append(edits, Edit{Delete, a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+
+	for x > 0 && y > 0 {
+		x--
+		y--
+		edits = append(edits, Edit{Equal, a[x]})
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+
+	return edits
+}
@@ -0,0 +1,112 @@
+package diff
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// apply rebuilds both texts from the edits
+func apply(edits []Edit) (string, string) {
+	var a, b strings.Builder
+	for _, e := range edits {
+		if e.Op != Insert {
+			a.WriteString(e.Text)
+		}
+		if e.Op != Delete {
+			b.WriteString(e.Text)
+		}
+	}
+
+	return a.String(), b.String()
+}
+
+func TestWords(t *testing.T) {
+	t.Run("It keeps the unchanged words", func(t *testing.T) {
+		got := Words("the quick brown fox", "the slow brown fox!")
+		expected := []Edit{
+			{Equal, "the "},
+			{Delete, "quick"},
+			{Insert, "slow"},
+			{Equal, " brown fox"},
+			{Insert, "!"},
+		}
+
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("Equal and empty texts", func(t *testing.T) {
+		if got := Words("same text", "same text"); !reflect.DeepEqual(got, []Edit{{Equal, "same text"}}) {
+			t.Errorf("Expected a single equal edit, got %v", got)
+		}
+
+		if got := Words("", ""); len(got) != 0 {
+			t.Errorf("Expected no edits, got %v", got)
+		}
+
+		if got := Words("", "new"); !reflect.DeepEqual(got, []Edit{{Insert, "new"}}) {
+			t.Errorf("Expected an insert, got %v", got)
+		}
+	})
+
+	t.Run("The edits rebuild both texts", func(t *testing.T) {
+		vocabulary := []string{"a", "b", "c", " ", "\n", ".", "héllo"}
+		text := func(r *rand.Rand) string {
+			var s strings.Builder
+			for i := r.Intn(30); i > 0; i-- {
+				s.WriteString(vocabulary[r.Intn(len(vocabulary))])
+			}
+			return s.String()
+		}
+
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 500; i++ {
+			a, b := text(r), text(r)
+			if gotA, gotB := apply(Words(a, b)); gotA != a || gotB != b {
+				t.Fatalf("Edits of %q to %q rebuild %q and %q", a, b, gotA, gotB)
+			}
+		}
+	})
+}
+
+func TestUnified(t *testing.T) {
+	t.Run("Equal texts have no diff", func(t *testing.T) {
+		if got := Unified("a", "b", "one\ntwo\n", "one\ntwo\n", DefaultContext); got != "" {
+			t.Errorf("Expected no diff, got %q", got)
+		}
+	})
+
+	t.Run("Changes are shown with their context", func(t *testing.T) {
+		a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+		b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+
+		expected := "--- a\n+++ b\n" +
+			"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+			"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n"
+
+		if got := Unified("a", "b", a, b, DefaultContext); got != expected {
+			t.Errorf("Expected\n%s\ngot\n%s", expected, got)
+		}
+	})
+
+	t.Run("Nearby changes share a hunk", func(t *testing.T) {
+		got := Unified("a", "b", "1\n2\n3\n4\n5\n", "x\n2\n3\n4\ny\n", 2)
+		expected := "--- a\n+++ b\n@@ -1,5 +1,5 @@\n-1\n+x\n 2\n 3\n 4\n-5\n+y\n"
+
+		if got != expected {
+			t.Errorf("Expected\n%s\ngot\n%s", expected, got)
+		}
+	})
+
+	t.Run("Missing newlines at the end are marked", func(t *testing.T) {
+		got := Unified("a", "b", "", "only", DefaultContext)
+		expected := "--- a\n+++ b\n@@ -0,0 +1 @@\n+only\n\\ No newline at end of file\n"
+
+		if got != expected {
+			t.Errorf("Expected\n%s\ngot\n%s", expected, got)
+		}
+	})
+}
@@ -0,0 +1,164 @@
+/*
+Package health serves the liveness and readiness probes used by load
+balancers and orchestrators
+*/
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/logging"
+)
+
+// Check returns an error when the dependency it checks can not be used
+type Check func(ctx context.Context) error
+
+// Result is the outcome of a single check. The error is logged rather than served, as probes need no login and errors
+// such as those dialing the database describe the infrastructure
+type Result struct {
+	Status  string  `json:"status"`
+	Latency float64 `json:"latencyMs"`
+	Error   string  `json:"-"`
+}
+
+// Report is the body of a readiness response
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+const (
+	StatusOK          = "ok"
+	StatusFailed      = "failed"
+	StatusUnavailable = "unavailable"
+)
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the registered checks for readiness. It starts out not ready, so the server can report it is still
+// starting, and should be marked not ready again when shutting down
+type Checker struct {
+	// Timeout bounds each round of checks
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	checks []namedCheck
+	ready  int32
+}
+
+// NewChecker creates a Checker which is not ready yet
+func NewChecker() *Checker {
+	return &Checker{Timeout: 2 * time.Second}
+}
+
+// Register adds a check run on every readiness probe
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	c.checks = append(c.checks, namedCheck{name, check})
+	c.mu.Unlock()
+}
+
+// SetReady marks the server as ready, once started, or not ready, while shutting down
+func (c *Checker) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&c.ready, v)
+}
+
+// Ready reports whether SetReady(true) was the last call to SetReady
+func (c *Checker) Ready() bool {
+	return atomic.LoadInt32(&c.ready) == 1
+}
+
+// Run runs every check concurrently, and reports whether the server is ready
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.Unlock()
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check(ctx)
+			results[i] = Result{Status: StatusOK, Latency: float64(time.Since(start)) / float64(time.Millisecond)}
+			if err != nil {
+				results[i].Status, results[i].Error = StatusFailed, err.Error()
+			}
+		}(i, nc.check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	if !c.Ready() {
+		report.Status = StatusUnavailable
+	}
+
+	for i, nc := range checks {
+		report.Checks[nc.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+
+	return report
+}
+
+// LiveHandler responds 200 as long as the process can serve requests
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+	})
+}
+
+// ReadyHandler responds 200 with the Report when the server is ready, and 503 otherwise
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		for name, res := range report.Checks {
+			if res.Error != "" {
+				logging.FromContext(r.Context()).Warn("readiness check failed", "check", name, "error", res.Error)
+			}
+		}
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, status, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,102 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyHandler(t *testing.T) {
+	c := NewChecker()
+	c.Register("database", func(ctx context.Context) error { return nil })
+
+	ready := func() (int, Report) {
+		rec := httptest.NewRecorder()
+		c.ReadyHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+		var report Report
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Expected a JSON report, got %s", rec.Body.String())
+		}
+		return rec.Code, report
+	}
+
+	t.Run("It is not ready while starting", func(t *testing.T) {
+		if code, report := ready(); code != http.StatusServiceUnavailable || report.Status != StatusUnavailable {
+			t.Errorf("Expected 503 before SetReady, got %d %+v", code, report)
+		}
+	})
+
+	t.Run("It is ready once every check passes", func(t *testing.T) {
+		c.SetReady(true)
+		code, report := ready()
+		if code != http.StatusOK || report.Checks["database"].Status != StatusOK {
+			t.Errorf("Expected 200, got %d %+v", code, report)
+		}
+	})
+
+	t.Run("A failing check is reported without its error", func(t *testing.T) {
+		c.Register("migrations", func(ctx context.Context) error { return errors.New("schema is at version 1, expected 2") })
+
+		rec := httptest.NewRecorder()
+		c.ReadyHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+		if strings.Contains(rec.Body.String(), "schema") {
+			t.Errorf("Expected the error to be left out, got %s", rec.Body.String())
+		}
+
+		code, report := ready()
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503, got %d", code)
+		}
+
+		if r := report.Checks["migrations"]; r.Status != StatusFailed {
+			t.Errorf("Unexpected result %+v", r)
+		}
+
+		if r := c.Run(context.Background()).Checks["migrations"]; r.Error != "schema is at version 1, expected 2" {
+			t.Errorf("Expected the error to be kept for logging, got %+v", r)
+		}
+
+		if report.Checks["database"].Status != StatusOK {
+			t.Errorf("Expected the other checks to still pass, got %+v", report.Checks)
+		}
+	})
+
+	t.Run("Checks are bounded by the timeout", func(t *testing.T) {
+		slow := NewChecker()
+		slow.Timeout = 10 * time.Millisecond
+		slow.SetReady(true)
+		slow.Register("slow", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		if report := slow.Run(context.Background()); report.Checks["slow"].Status != StatusFailed {
+			t.Errorf("Expected the slow check to time out, got %+v", report)
+		}
+	})
+
+	t.Run("It is not ready while shutting down", func(t *testing.T) {
+		shutdown := NewChecker()
+		shutdown.SetReady(true)
+		shutdown.SetReady(false)
+
+		if shutdown.Run(context.Background()).Status != StatusUnavailable {
+			t.Error("Expected the checker to be unavailable")
+		}
+	})
+}
+
+func TestLiveHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewChecker().LiveHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"status":"ok"}` {
+		t.Errorf("Unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,195 @@
+/*
+Package lockout tracks failed login attempts and slows down or blocks
+repeated guessing, per account and per client address
+*/
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// Entry is the failure history of a single key
+type Entry struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store keeps failure counters. MemoryStore is the default, other stores allow counters to be shared between servers
+type Store interface {
+	Get(key string, now time.Time) (Entry, error)
+	Fail(key string, now time.Time) (Entry, error)
+	Reset(key string) error
+}
+
+// MemoryStore is a Store kept in process memory. Entries are forgotten once they have been idle for the TTL
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	TTL     time.Duration
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry), TTL: ttl}
+}
+
+// Get returns the entry for the key, or an empty entry if there is none or it has expired
+func (m *MemoryStore) Get(key string, now time.Time) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if ok && m.TTL > 0 && now.Sub(e.LastFailure) > m.TTL {
+		delete(m.entries, key)
+		return Entry{}, nil
+	}
+
+	return e, nil
+}
+
+// Fail records a failure for the key
+func (m *MemoryStore) Fail(key string, now time.Time) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.entries[key]
+	if m.TTL > 0 && now.Sub(e.LastFailure) > m.TTL {
+		e = Entry{}
+	}
+
+	e.Failures++
+	e.LastFailure = now
+	m.entries[key] = e
+
+	return e, nil
+}
+
+// Reset forgets the key
+func (m *MemoryStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// Sweep removes every entry that has been idle for longer than the TTL
+func (m *MemoryStore) Sweep(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, e := range m.entries {
+		if now.Sub(e.LastFailure) > m.TTL {
+			delete(m.entries, k)
+		}
+	}
+}
+
+// Guard decides how long a key has to wait before its next attempt.
+// The first FreeAttempts failures have no delay, after that the delay doubles from BaseDelay up to MaxDelay,
+// and once MaxFailures is reached the key is locked out for LockoutDuration.
+// A nil Guard allows every attempt
+type Guard struct {
+	Store           Store
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	MaxFailures     int
+	LockoutDuration time.Duration
+	Now             func() time.Time
+}
+
+// NewGuard creates a Guard with the default limits
+func NewGuard(s Store) *Guard {
+	return &Guard{
+		Store:           s,
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		MaxFailures:     10,
+		LockoutDuration: 15 * time.Minute,
+		Now:             time.Now,
+	}
+}
+
+// Delay returns how long after its last failure a key with the entry must wait
+func (g *Guard) Delay(e Entry) time.Duration {
+	if e.Failures >= g.MaxFailures {
+		return g.LockoutDuration
+	}
+
+	if e.Failures < g.FreeAttempts {
+		return 0
+	}
+
+	d := g.BaseDelay
+	for i := g.FreeAttempts; i < e.Failures && d < g.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if d > g.MaxDelay {
+		d = g.MaxDelay
+	}
+
+	return d
+}
+
+// Wait returns the longest time any of the keys still has to wait before trying again, or 0 if all may proceed
+func (g *Guard) Wait(keys ...string) (time.Duration, error) {
+	if g == nil {
+		return 0, nil
+	}
+
+	var wait time.Duration
+	now := g.Now()
+	for _, k := range keys {
+		e, err := g.Store.Get(k, now)
+		if err != nil {
+			return 0, err
+		}
+
+		if remaining := e.LastFailure.Add(g.Delay(e)).Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	return wait, nil
+}
+
+// Fail records a failed attempt for every key, returning the keys that have just been locked out
+func (g *Guard) Fail(keys ...string) ([]string, error) {
+	if g == nil {
+		return nil, nil
+	}
+
+	var locked []string
+	now := g.Now()
+	for _, k := range keys {
+		e, err := g.Store.Fail(k, now)
+		if err != nil {
+			return locked, err
+		}
+
+		if e.Failures == g.MaxFailures {
+			locked = append(locked, k)
+		}
+	}
+
+	return locked, nil
+}
+
+// Succeed clears the failures of every key after a successful attempt
+func (g *Guard) Succeed(keys ...string) error {
+	if g == nil {
+		return nil
+	}
+
+	for _, k := range keys {
+		if err := g.Store.Reset(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
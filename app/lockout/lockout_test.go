@@ -0,0 +1,123 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestGuard(now *time.Time) *Guard {
+	g := NewGuard(NewMemoryStore(time.Hour))
+	g.Now = func() time.Time { return *now }
+	return g
+}
+
+func TestDelay(t *testing.T) {
+	g := NewGuard(nil)
+
+	cases := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{9, time.Minute},
+		{10, 15 * time.Minute},
+	}
+
+	for _, c := range cases {
+		if d := g.Delay(Entry{Failures: c.failures}); d != c.expected {
+			t.Errorf("Expected a delay of %s after %d failures, got %s", c.expected, c.failures, d)
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	t.Run("Free attempts do not wait", func(t *testing.T) {
+		g := newTestGuard(&now)
+		g.Fail("email:a")
+		g.Fail("email:a")
+
+		if wait, _ := g.Wait("email:a"); wait != 0 {
+			t.Errorf("Expected no wait, got %s", wait)
+		}
+	})
+
+	t.Run("Delays apply to the slowest key", func(t *testing.T) {
+		g := newTestGuard(&now)
+		for i := 0; i < 4; i++ {
+			g.Fail("email:a")
+		}
+		g.Fail("ip:1")
+
+		if wait, _ := g.Wait("email:a", "ip:1"); wait != 2*time.Second {
+			t.Errorf("Expected to wait 2s, got %s", wait)
+		}
+	})
+
+	t.Run("Lockout is reported once and expires", func(t *testing.T) {
+		current := now
+		g := newTestGuard(&current)
+
+		var lockedCount int
+		for i := 0; i < 12; i++ {
+			locked, err := g.Fail("email:a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			lockedCount += len(locked)
+		}
+
+		if lockedCount != 1 {
+			t.Errorf("Expected a single lockout, got %d", lockedCount)
+		}
+
+		if wait, _ := g.Wait("email:a"); wait != g.LockoutDuration {
+			t.Errorf("Expected to be locked out for %s, got %s", g.LockoutDuration, wait)
+		}
+
+		current = current.Add(g.LockoutDuration)
+		if wait, _ := g.Wait("email:a"); wait != 0 {
+			t.Errorf("Expected the lockout to expire, got %s", wait)
+		}
+	})
+
+	t.Run("Success resets the counter", func(t *testing.T) {
+		g := newTestGuard(&now)
+		for i := 0; i < 5; i++ {
+			g.Fail("email:a")
+		}
+
+		g.Succeed("email:a")
+		if wait, _ := g.Wait("email:a"); wait != 0 {
+			t.Errorf("Expected no wait after success, got %s", wait)
+		}
+	})
+
+	t.Run("A nil guard allows everything", func(t *testing.T) {
+		var g *Guard
+		if wait, err := g.Wait("email:a"); wait != 0 || err != nil {
+			t.Errorf("Expected no wait, got %s, %v", wait, err)
+		}
+	})
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	s := NewMemoryStore(time.Minute)
+	old := time.Now().Add(-2 * time.Minute)
+
+	s.Fail("key", old)
+	if e, _ := s.Get("key", time.Now()); e.Failures != 0 {
+		t.Errorf("Expected an expired entry to be forgotten, got %d failures", e.Failures)
+	}
+
+	s.Fail("key", old)
+	s.Sweep(time.Now())
+	if len(s.entries) != 0 {
+		t.Errorf("Expected sweep to remove idle entries, got %d", len(s.entries))
+	}
+}
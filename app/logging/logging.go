@@ -0,0 +1,148 @@
+/*
+Package logging provides leveled, structured logs, and a request scoped
+logger carrying the request ID, which is available to any code holding
+the request context
+*/
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// RequestIDHeader is read from incoming requests, and set on every response
+const RequestIDHeader = "X-Request-ID"
+
+// New creates a logger writing to w in either the "json" or "text" format
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch strings.ToLower(format) {
+	case "json", "":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// ParseLevel converts debug, info, warn or error to a level
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(s))
+	return l, err
+}
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	infoKey
+)
+
+// RequestInfo is filled in while a request is handled, and logged once it completes
+type RequestInfo struct {
+	mu     sync.Mutex
+	ID     string
+	Route  string
+	UserID int
+}
+
+// WithLogger returns a context carrying the logger
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the request scoped logger, or the default logger outside of a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+			return l
+		}
+	}
+
+	return slog.Default()
+}
+
+func withInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, infoKey, info)
+}
+
+func infoFrom(ctx context.Context) *RequestInfo {
+	if ctx == nil {
+		return nil
+	}
+
+	info, _ := ctx.Value(infoKey).(*RequestInfo)
+	return info
+}
+
+// RequestID returns the ID of the request handling the context, or an empty string
+func RequestID(ctx context.Context) string {
+	if info := infoFrom(ctx); info != nil {
+		return info.ID
+	}
+
+	return ""
+}
+
+// Route returns the route pattern that matched the request, or an empty string
+func Route(ctx context.Context) string {
+	if info := infoFrom(ctx); info != nil {
+		info.mu.Lock()
+		defer info.mu.Unlock()
+		return info.Route
+	}
+
+	return ""
+}
+
+// SetRoute records the route pattern that matched the request
+func SetRoute(ctx context.Context, route string) {
+	if info := infoFrom(ctx); info != nil {
+		info.mu.Lock()
+		info.Route = route
+		info.mu.Unlock()
+	}
+}
+
+// SetUserID records the user making the request
+func SetUserID(ctx context.Context, id int) {
+	if info := infoFrom(ctx); info != nil {
+		info.mu.Lock()
+		info.UserID = id
+		info.mu.Unlock()
+	}
+}
+
+// NewRequestID generates a random ID for requests that do not provide one
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// validRequestID only accepts short IDs of printable characters, so a client can not inject into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexandersmanning/simcha/app/tracing"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+
+	t.Run("JSON format", func(t *testing.T) {
+		buf.Reset()
+		l, err := New(&buf, "json", slog.LevelInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l.Debug("hidden")
+		l.Info("shown", "key", "value")
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("Expected a single JSON entry, got %s", buf.String())
+		}
+
+		if entry["msg"] != "shown" || entry["key"] != "value" {
+			t.Errorf("Unexpected entry %v", entry)
+		}
+	})
+
+	t.Run("Text format", func(t *testing.T) {
+		buf.Reset()
+		l, err := New(&buf, "text", slog.LevelInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l.Info("shown")
+		if !strings.Contains(buf.String(), "msg=shown") {
+			t.Errorf("Expected a text entry, got %s", buf.String())
+		}
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		if _, err := New(&buf, "xml", slog.LevelInfo); err == nil {
+			t.Error("Expected an error for an unknown format")
+		}
+	})
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := New(&buf, "json", slog.LevelInfo)
+
+	var seenID string
+	h := Handler(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenID = RequestID(r.Context())
+		SetRoute(r.Context(), "/posts/:postId")
+		SetUserID(r.Context(), 7)
+		FromContext(r.Context()).Info("inside")
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+
+	t.Run("It propagates a valid request ID", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest("GET", "/posts/2", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if seenID != "abc-123" || rec.Header().Get(RequestIDHeader) != "abc-123" {
+			t.Errorf("Expected request id abc-123, got %s and %s", seenID, rec.Header().Get(RequestIDHeader))
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("Expected two log lines, got %d: %s", len(lines), buf.String())
+		}
+
+		var inside, access map[string]interface{}
+		json.Unmarshal([]byte(lines[0]), &inside)
+		json.Unmarshal([]byte(lines[1]), &access)
+
+		if inside["request_id"] != "abc-123" {
+			t.Errorf("Expected the request scoped logger to carry the id, got %v", inside)
+		}
+
+		expected := map[string]interface{}{
+			"request_id": "abc-123",
+			"method":     "GET",
+			"route":      "/posts/:postId",
+			"status":     float64(201),
+			"bytes":      float64(5),
+			"user_id":    float64(7),
+		}
+		for k, v := range expected {
+			if access[k] != v {
+				t.Errorf("Expected %s to be %v, got %v", k, v, access[k])
+			}
+		}
+	})
+
+	t.Run("It replaces invalid request IDs", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if seenID == "" || strings.Contains(seenID, " ") {
+			t.Errorf("Expected a generated id, got %q", seenID)
+		}
+	})
+}
+
+func TestHandlerTraceID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := New(&buf, "json", slog.LevelInfo)
+
+	h := tracing.Handler(tracing.NewTracer(nil), Handler(logger, http.NotFoundHandler()))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	json.Unmarshal(buf.Bytes(), &entry)
+	if entry["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the trace id to be logged, got %v", entry)
+	}
+}
+
+func TestFromContextDefault(t *testing.T) {
+	if FromContext(nil) != slog.Default() {
+		t.Error("Expected the default logger outside of a request")
+	}
+}
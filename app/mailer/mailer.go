@@ -0,0 +1,42 @@
+/*
+Package mailer sends notification emails to users
+*/
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is the interface used by the application to send email, so the transport can be swapped out
+type Mailer interface {
+	Send(m Message) error
+}
+
+// LogMailer writes messages to a writer instead of sending them, and is used in development
+type LogMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogMailer creates a LogMailer writing to w
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{w: w}
+}
+
+// Send writes the message to the underlying writer
+func (l *LogMailer) Send(m Message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := fmt.Fprintf(l.w, "To: %s\nSubject: %s\n\n%s\n\n", m.To, m.Subject, m.Body)
+	return err
+}
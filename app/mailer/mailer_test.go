@@ -0,0 +1,23 @@
+package mailer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(&buf)
+
+	if err := m.Send(Message{To: "email@fake.com", Subject: "Hello", Body: "Body text"}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, expected := range []string{"To: email@fake.com", "Subject: Hello", "Body text"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected output to contain %q, got %q", expected, out)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/logging"
+)
+
+// statusRecorder captures the status of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Instrument registers the HTTP metrics on the registry, and returns a handler recording them for every request.
+// Requests are labelled with the route pattern recorded through the logging package, so it must run inside
+// logging.Handler. Requests which matched no route share the "unmatched" label, so paths can not grow the series
+func Instrument(reg *Registry, next http.Handler) http.Handler {
+	requests := reg.Counter("simcha_http_requests_total", "Number of HTTP requests handled.", "method", "route", "status")
+	duration := reg.Histogram("simcha_http_request_duration_seconds", "Latency of HTTP requests.", DefBuckets, "method", "route")
+	inFlight := reg.Gauge("simcha_http_requests_in_flight", "Number of HTTP requests being handled.")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		route := logging.Route(r.Context())
+		if route == "" {
+			route = "unmatched"
+		}
+
+		requests.Inc(r.Method, route, strconv.Itoa(rec.status))
+		duration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// DBStats registers gauges for the connection pool, read from stats, such as sql.DB.Stats, on every scrape
+func DBStats(reg *Registry, stats func() sql.DBStats) {
+	gauges := []struct {
+		name  string
+		help  string
+		value func(s sql.DBStats) float64
+	}{
+		{"simcha_db_open_connections", "Number of established database connections.", func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"simcha_db_in_use_connections", "Number of database connections in use.", func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"simcha_db_idle_connections", "Number of idle database connections.", func(s sql.DBStats) float64 { return float64(s.Idle) }},
+		{"simcha_db_max_open_connections", "Maximum number of open database connections.", func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"simcha_db_wait_count", "Total number of connections waited for.", func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"simcha_db_wait_duration_seconds", "Total time spent waiting for a connection.", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+	}
+
+	for _, g := range gauges {
+		value := g.value
+		reg.GaugeFunc(g.name, g.help, func() (float64, error) {
+			return value(stats()), nil
+		})
+	}
+}
+
+// Handler serves the registry. When token is set, requests must send it as a bearer token
+func Handler(reg *Registry, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			sent := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(sent, []byte("Bearer "+token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.Write(w)
+	})
+}
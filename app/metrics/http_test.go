@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexandersmanning/simcha/app/logging"
+)
+
+func TestInstrument(t *testing.T) {
+	reg := NewRegistry()
+	logger, _ := logging.New(&bytes.Buffer{}, "json", slog.LevelInfo)
+
+	h := logging.Handler(logger, Instrument(reg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/posts/") {
+			logging.SetRoute(r.Context(), "/posts/:postId")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		http.NotFound(w, r)
+	})))
+
+	for _, path := range []string{"/posts/2", "/posts/3", "/missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var buf bytes.Buffer
+	reg.Write(&buf)
+	out := buf.String()
+
+	expected := []string{
+		`simcha_http_requests_total{method="GET",route="/posts/:postId",status="201"} 2`,
+		`simcha_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`simcha_http_request_duration_seconds_count{method="GET",route="/posts/:postId"} 2`,
+		`simcha_http_requests_in_flight 0`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected %s in the output:\n%s", line, out)
+		}
+	}
+}
+
+func TestDBStats(t *testing.T) {
+	reg := NewRegistry()
+	DBStats(reg, func() sql.DBStats {
+		return sql.DBStats{OpenConnections: 5, InUse: 2, Idle: 3, MaxOpenConnections: 10}
+	})
+
+	var buf bytes.Buffer
+	reg.Write(&buf)
+
+	for _, line := range []string{"simcha_db_open_connections 5", "simcha_db_in_use_connections 2", "simcha_db_idle_connections 3"} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Expected %s in the output:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.Gauge("up", "Whether the server is up.").Set(1)
+
+	t.Run("It serves the text format", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		Handler(reg, "").ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+		if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+			t.Errorf("Unexpected content type %s", rec.Header().Get("Content-Type"))
+		}
+
+		if !strings.Contains(rec.Body.String(), "up 1\n") {
+			t.Errorf("Unexpected body %s", rec.Body.String())
+		}
+	})
+
+	t.Run("It requires the token when one is set", func(t *testing.T) {
+		h := Handler(reg, "secret")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 without a token, got %d", rec.Code)
+		}
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200 with the token, got %d", rec.Code)
+		}
+	})
+}
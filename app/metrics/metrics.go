@@ -0,0 +1,300 @@
+/*
+Package metrics collects counters, gauges and histograms, and writes them in
+the Prometheus text exposition format, without depending on the Prometheus
+client libraries
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds, suited to request latencies
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry served by the application's /metrics endpoint
+var Default = NewRegistry()
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics in the order they were registered
+type Registry struct {
+	mu      sync.Mutex
+	names   map[string]bool
+	metrics []metric
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		panic("metrics: " + name + " is already registered")
+	}
+
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes every metric in the text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// desc is the name, help text and label names shared by every kind of metric
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// vec stores one value per combination of label values
+type vec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values  []string
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func newVec(d desc) *vec {
+	return &vec{desc: d, series: map[string]*series{}}
+}
+
+// with returns the series for the label values, creating it if needed. The caller must hold the lock
+func (v *vec) with(values []string) *series {
+	k := v.key(values)
+	s, ok := v.series[k]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[k] = s
+	}
+
+	return s
+}
+
+// sorted returns the series ordered by their label values, so the output is stable. The caller must hold the lock
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]*series, len(keys))
+	for i, k := range keys {
+		out[i] = v.series[k]
+	}
+
+	return out
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.header(w)
+	for _, s := range v.sorted() {
+		sample(w, v.name, v.labels, s.values, s.value)
+	}
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	*vec
+}
+
+// Counter registers a counter with the label names
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{newVec(desc{name: name, help: help, kind: "counter", labels: labels})}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to the series with the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds a positive amount to the series with the label values
+func (c *Counter) Add(n float64, values ...string) {
+	if n < 0 {
+		panic("metrics: counters can not decrease")
+	}
+
+	c.mu.Lock()
+	c.with(values).value += n
+	c.mu.Unlock()
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	*vec
+}
+
+// Gauge registers a gauge with the label names
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newVec(desc{name: name, help: help, kind: "gauge", labels: labels})}
+	r.register(name, g)
+	return g
+}
+
+// Set sets the series with the label values
+func (g *Gauge) Set(n float64, values ...string) {
+	g.mu.Lock()
+	g.with(values).value = n
+	g.mu.Unlock()
+}
+
+// Add adds n, which may be negative, to the series with the label values
+func (g *Gauge) Add(n float64, values ...string) {
+	g.mu.Lock()
+	g.with(values).value += n
+	g.mu.Unlock()
+}
+
+// GaugeFunc is a gauge sampled each time the metrics are written
+type GaugeFunc struct {
+	desc
+	f func() (float64, error)
+}
+
+// GaugeFunc registers a gauge whose value is read from f. When f fails the sample is left out
+func (r *Registry) GaugeFunc(name, help string, f func() (float64, error)) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help, kind: "gauge"}, f: f}
+	r.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.header(w)
+	if v, err := g.f(); err == nil {
+		sample(w, g.name, nil, nil, v)
+	}
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	*vec
+	buckets []float64
+}
+
+// Histogram registers a histogram with the upper bounds of its buckets, and the label names
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	h := &Histogram{vec: newVec(desc{name: name, help: help, kind: "histogram", labels: labels}), buckets: b}
+	r.register(name, h)
+	return h
+}
+
+// Observe records a value in the series with the label values
+func (h *Histogram) Observe(n float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.with(values)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.buckets))
+	}
+
+	for i, upper := range h.buckets {
+		if n <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.sum += n
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	labels := append(append([]string(nil), h.labels...), "le")
+	for _, s := range h.sorted() {
+		for i, upper := range h.buckets {
+			sample(w, h.name+"_bucket", labels, append(append([]string(nil), s.values...), formatFloat(upper)), float64(s.buckets[i]))
+		}
+		sample(w, h.name+"_bucket", labels, append(append([]string(nil), s.values...), "+Inf"), float64(s.count))
+		sample(w, h.name+"_sum", h.labels, s.values, s.sum)
+		sample(w, h.name+"_count", h.labels, s.values, float64(s.count))
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func sample(w *bufio.Writer, name string, labels, values []string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, l, labelEscaper.Replace(values[i]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	reg := NewRegistry()
+
+	logins := reg.Counter("logins_total", "Number of logins.", "result")
+	logins.Inc("success")
+	logins.Inc("success")
+	logins.Inc("failure")
+
+	inFlight := reg.Gauge("in_flight", "Requests in flight.")
+	inFlight.Add(3)
+	inFlight.Add(-1)
+
+	latency := reg.Histogram("latency_seconds", "Request latency.", []float64{0.5, 0.1}, "route")
+	latency.Observe(0.05, "/posts")
+	latency.Observe(0.3, "/posts")
+	latency.Observe(2, "/posts")
+
+	reg.GaugeFunc("sessions", "Active sessions.", func() (float64, error) { return 4, nil })
+	reg.GaugeFunc("broken", "Fails to sample.", func() (float64, error) { return 0, errors.New("db down") })
+
+	reg.Counter("escaped_total", "Label \\ escaping.", "path").Inc("a\"b\\c\nd")
+
+	var buf bytes.Buffer
+	if err := reg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP logins_total Number of logins.
+# TYPE logins_total counter
+logins_total{result="failure"} 1
+logins_total{result="success"} 2
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 2
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/posts",le="0.1"} 1
+latency_seconds_bucket{route="/posts",le="0.5"} 2
+latency_seconds_bucket{route="/posts",le="+Inf"} 3
+latency_seconds_sum{route="/posts"} 2.35
+latency_seconds_count{route="/posts"} 3
+# HELP sessions Active sessions.
+# TYPE sessions gauge
+sessions 4
+# HELP broken Fails to sample.
+# TYPE broken gauge
+# HELP escaped_total Label \\ escaping.
+# TYPE escaped_total counter
+escaped_total{path="a\"b\\c\nd"} 1
+`
+
+	if buf.String() != expected {
+		t.Errorf("Unexpected output\nexpected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	t.Run("Duplicate names", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected registering a name twice to panic")
+			}
+		}()
+
+		reg := NewRegistry()
+		reg.Counter("requests_total", "")
+		reg.Gauge("requests_total", "")
+	})
+
+	t.Run("Wrong number of label values", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected missing label values to panic")
+			}
+		}()
+
+		NewRegistry().Counter("requests_total", "", "route").Inc()
+	})
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import "github.com/julienschmidt/httprouter"
+
+// Pipeline is an ordered list of Middleware. The first middleware is the outermost, so it runs first
+type Pipeline []Middleware
+
+// Chain creates a Pipeline from the middleware
+func Chain(mws ...Middleware) Pipeline {
+	return Pipeline(mws)
+}
+
+// Append returns a new Pipeline running the middleware after the existing ones
+func (p Pipeline) Append(mws ...Middleware) Pipeline {
+	chain := make(Pipeline, 0, len(p)+len(mws))
+	chain = append(chain, p...)
+	return append(chain, mws...)
+}
+
+// Then wraps the handle in every middleware of the Pipeline
+func (p Pipeline) Then(h httprouter.Handle) httprouter.Handle {
+	for i := len(p) - 1; i >= 0; i-- {
+		h = p[i](h)
+	}
+
+	return h
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			*calls = append(*calls, name)
+			next(w, r, p)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	handle := func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		calls = append(calls, "handle")
+	}
+
+	t.Run("Middleware runs in order before the handle", func(t *testing.T) {
+		calls = nil
+		chain := Chain(recordingMiddleware("first", &calls), recordingMiddleware("second", &calls))
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		chain.Then(handle)(httptest.NewRecorder(), req, nil)
+
+		if expected := []string{"first", "second", "handle"}; !reflect.DeepEqual(calls, expected) {
+			t.Errorf("Expected %v, got %v", expected, calls)
+		}
+	})
+
+	t.Run("Append does not change the original chain", func(t *testing.T) {
+		calls = nil
+		base := Chain(recordingMiddleware("base", &calls))
+		base.Append(recordingMiddleware("one", &calls))
+		extended := base.Append(recordingMiddleware("two", &calls))
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		extended.Then(handle)(httptest.NewRecorder(), req, nil)
+
+		if expected := []string{"base", "two", "handle"}; !reflect.DeepEqual(calls, expected) {
+			t.Errorf("Expected %v, got %v", expected, calls)
+		}
+	})
+
+	t.Run("An empty chain returns the handle", func(t *testing.T) {
+		calls = nil
+		req, _ := http.NewRequest("GET", "/", nil)
+		Chain().Then(handle)(httptest.NewRecorder(), req, nil)
+
+		if len(calls) != 1 {
+			t.Errorf("Expected only the handle to run, got %v", calls)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/alexandersmanning/simcha/app/logging"
+)
+
+// errorResponse has the same shape as the controllers' JSON errors, with the request ID added so a user can report it
+type errorResponse struct {
+	Result    string `json:"result"`
+	Error     string `json:"error"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// jsonError responds with the error in the controllers' JSON shape, logging it like they do when the server failed
+func jsonError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error("request failed", "error", err, "status", status)
+	}
+
+	writeError(w, r, err.Error(), status)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, msg string, status int) {
+	body, _ := json.Marshal(errorResponse{Error: msg, RequestID: logging.RequestID(r.Context())})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -1,30 +1,61 @@
 package middleware
 
 import (
+	"errors"
 	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/logging"
+	"github.com/alexandersmanning/simcha/app/policy"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
 
-func PostPermission(env *config.Env, next httprouter.Handle) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		postId := p.ByName("postId")
-		post, err := env.DB.GetPostById(postId)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+// postActions maps the request method to the policy action checked by PostPermission
+var postActions = map[string]string{
+	http.MethodGet:    policy.PostRead,
+	http.MethodPut:    policy.PostUpdate,
+	http.MethodPatch:  policy.PostUpdate,
+	http.MethodDelete: policy.PostDelete,
+}
 
-		user, err := env.Store.CurrentUser(env.DB, r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+// PostPermission runs next only when the current user may act on the post in the URL with the request's method. The
+// decision is logged at debug level, so a refused request can be explained. Missing posts are answered with 404, and
+// posts the user may not act on with 403
+func PostPermission(env *config.Env) Middleware {
+	return func(next httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			db := env.DB.WithContext(r.Context())
+
+			postId := p.ByName("postId")
+			post, err := db.GetPostById(postId)
+			if err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+
+			if post.Id == 0 {
+				jsonError(w, r, errors.New("post not found"), http.StatusNotFound)
+				return
+			}
+
+			user, err := env.Store.CurrentUser(db, r)
+			if err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+
+			action, ok := postActions[r.Method]
+			if !ok {
+				action = policy.PostUpdate
+			}
+
+			d := policy.Authorize(r.Context(), user, action, post)
+			logging.FromContext(r.Context()).Debug("post permission", "post", post.Id, "decision", d.String())
+			if !d.Allowed {
+				jsonError(w, r, errors.New("you may only change your own posts"), http.StatusForbidden)
+				return
+			}
 
-		if user.Id != post.Author.Id || user.Email != post.Author.Email {
-			http.Error(w, "User does not match", http.StatusBadRequest)
-			return
+			next(w, r, p)
 		}
-		next(w, r, p)
 	}
 }
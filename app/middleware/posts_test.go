@@ -5,19 +5,23 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/logging"
 	"github.com/alexandersmanning/simcha/app/mocks/database"
 	"github.com/alexandersmanning/simcha/app/mocks/sessions"
 	"github.com/alexandersmanning/simcha/app/models"
 	"github.com/golang/mock/gomock"
 	"github.com/julienschmidt/httprouter"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
 func TestPostPermission(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	mockDB := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDB.EXPECT().WithContext(gomock.Any()).Return(mockDB).AnyTimes()
 	mockStore := mocksession.NewMockSessionStore(mockCtrl)
 
 	env := config.Env{DB: mockDB, Store: mockStore}
@@ -43,7 +47,7 @@ func TestPostPermission(t *testing.T) {
 	t.Run("It calls an error if the DB cannot be called", func (t *testing.T) {
 		res := httptest.NewRecorder()
 		mockDB.EXPECT().GetPostById("2").Return(nil, errors.New("failure"))
-		PostPermission(&env, mockFunc)(res, req, params)
+		PostPermission(&env)(mockFunc)(res, req, params)
 		if res.Code != 500 {
 			t.Errorf("Expected to receive 500, got %d", res.Code)
 		}
@@ -58,7 +62,7 @@ func TestPostPermission(t *testing.T) {
 		mockDB.EXPECT().GetPostById("2").Return(&post, nil)
 		mockStore.EXPECT().CurrentUser(env.DB, req).Return(nil, errors.New("failure"))
 
-		PostPermission(&env, mockFunc)(res, req, params)
+		PostPermission(&env)(mockFunc)(res, req, params)
 		if res.Code != 500 {
 			t.Errorf("Expected to receive a code of 500, got %d", res.Code)
 		}
@@ -75,10 +79,10 @@ func TestPostPermission(t *testing.T) {
 		mockStore.EXPECT().CurrentUser(env.DB, req).Return(&otherUser,nil)
 		mockDB.EXPECT().GetPostById("2").Return(&post, nil)
 
-		PostPermission(&env, mockFunc)(res, req, params)
+		PostPermission(&env)(mockFunc)(res, req, params)
 
-		if res.Code != 400 {
-			t.Errorf("Expected to get a 400 code, got %d", res.Code)
+		if res.Code != 403 {
+			t.Errorf("Expected to get a 403 code, got %d", res.Code)
 		}
 
 		if calledMockFunc == true {
@@ -86,6 +90,38 @@ func TestPostPermission(t *testing.T) {
 		}
 	})
 
+	t.Run("A missing post is not found", func(t *testing.T) {
+		res := httptest.NewRecorder()
+
+		calledMockFunc = false
+		mockDB.EXPECT().GetPostById("2").Return(&models.Post{}, nil)
+
+		PostPermission(&env)(mockFunc)(res, req, params)
+
+		if res.Code != 404 {
+			t.Errorf("Expected to get a 404 code, got %d", res.Code)
+		}
+
+		if calledMockFunc == true {
+			t.Error("Expected next not to have been called")
+		}
+	})
+
+	t.Run("The decision is logged", func(t *testing.T) {
+		var logs bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		logReq := req.WithContext(logging.WithLogger(req.Context(), logger))
+
+		mockStore.EXPECT().CurrentUser(env.DB, logReq).Return(&otherUser, nil)
+		mockDB.EXPECT().GetPostById("2").Return(&post, nil)
+
+		PostPermission(&env)(mockFunc)(httptest.NewRecorder(), logReq, params)
+
+		if !strings.Contains(logs.String(), `subject is not the author`) {
+			t.Errorf("Expected the rules which denied the request to be logged, got %s", logs.String())
+		}
+	})
+
 	t.Run("Current user matches ", func(t *testing.T) {
 		res := httptest.NewRecorder()
 
@@ -93,10 +129,29 @@ func TestPostPermission(t *testing.T) {
 		mockStore.EXPECT().CurrentUser(env.DB, req).Return(&user,nil)
 		mockDB.EXPECT().GetPostById("2").Return(&post, nil)
 
-		PostPermission(&env, mockFunc)(res, req, params)
+		PostPermission(&env)(mockFunc)(res, req, params)
 
 		if calledMockFunc != true {
 			t.Error("Expected next to have been called")
 		}
 	})
+
+	t.Run("Deleting checks the delete policy", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		deleteReq, _ := http.NewRequest("DELETE", "/posts/2", nil)
+
+		calledMockFunc = false
+		mockStore.EXPECT().CurrentUser(env.DB, deleteReq).Return(&otherUser, nil)
+		mockDB.EXPECT().GetPostById("2").Return(&post, nil)
+
+		PostPermission(&env)(mockFunc)(res, deleteReq, params)
+
+		if res.Code != 403 {
+			t.Errorf("Expected to get a 403 code, got %d", res.Code)
+		}
+
+		if calledMockFunc == true {
+			t.Error("Expected next not to have been called")
+		}
+	})
 }
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/ratelimit"
+	"github.com/alexandersmanning/simcha/app/sessions"
+)
+
+// RateLimit refuses requests with a 429 once the limiter's bucket for the request is empty
+func RateLimit(env *config.Env, l *ratelimit.Limiter) Middleware {
+	return func(next httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			res, err := l.Allow(r)
+			if err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+
+			// the headers include Retry-After when the request is refused
+			ratelimit.SetHeaders(w.Header(), res)
+			if !res.Allowed {
+				jsonError(w, r, errors.New("too many requests"), http.StatusTooManyRequests)
+				return
+			}
+
+			next(w, r, p)
+		}
+	}
+}
+
+// LoadUser looks up the logged in user once, and stores it on the request for ByUser and the handle to reuse
+func LoadUser(env *config.Env) Middleware {
+	return func(next httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			u, err := env.Store.CurrentUser(env.DB.WithContext(r.Context()), r)
+			if err != nil {
+				jsonError(w, r, err, http.StatusInternalServerError)
+				return
+			}
+
+			next(w, sessions.WithUser(r, u), p)
+		}
+	}
+}
+
+// ByUser counts requests against the logged in user, falling back to the client address for anonymous requests. The
+// user stored by LoadUser is used when there is one
+func ByUser(env *config.Env) ratelimit.KeyFunc {
+	return func(r *http.Request) (string, error) {
+		u, ok := sessions.UserFromContext(r.Context())
+		if !ok {
+			var err error
+			if u, err = env.Store.CurrentUser(env.DB.WithContext(r.Context()), r); err != nil {
+				return "", err
+			}
+		}
+
+		if u.Id == 0 {
+			return ratelimit.ByIP(r)
+		}
+
+		return "user:" + strconv.Itoa(u.Id), nil
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/mocks/database"
+	"github.com/alexandersmanning/simcha/app/mocks/sessions"
+	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/ratelimit"
+	"github.com/alexandersmanning/simcha/app/sessions"
+)
+
+func TestRateLimit(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDB.EXPECT().WithContext(gomock.Any()).Return(mockDB).AnyTimes()
+
+	mockStore := mocksession.NewMockSessionStore(mockCtrl)
+	env := config.Env{DB: mockDB, Store: mockStore}
+
+	calls := 0
+	next := func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		calls++
+	}
+
+	t.Run("Requests over the limit are refused", func(t *testing.T) {
+		l := ratelimit.NewLimiter("test", ratelimit.PerMinute(2), ratelimit.NewMemoryStore(), ratelimit.ByIP)
+		handle := RateLimit(&env, l)(next)
+		calls = 0
+
+		var res *httptest.ResponseRecorder
+		for i := 0; i < 3; i++ {
+			res = httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/posts", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			handle(res, req, nil)
+		}
+
+		if calls != 2 {
+			t.Errorf("Expected next to be called twice, got %d", calls)
+		}
+
+		if res.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected a 429, got %d", res.Code)
+		}
+
+		if res.Header().Get("Retry-After") == "" || res.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("Expected rate limit headers, got %v", res.Header())
+		}
+
+		var body errorResponse
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil || body.Error == "" ||
+			res.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON error, got %q, %v", res.Body.String(), err)
+		}
+	})
+
+	t.Run("Logged in users are limited separately from their address", func(t *testing.T) {
+		l := ratelimit.NewLimiter("test", ratelimit.PerMinute(1), ratelimit.NewMemoryStore(), ByUser(&env))
+		handle := RateLimit(&env, l)(next)
+		calls = 0
+
+		for _, u := range []models.User{{Id: 1}, {Id: 2}, {}} {
+			user := u
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/posts", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+
+			mockStore.EXPECT().CurrentUser(env.DB, req).Return(&user, nil)
+			handle(res, req, nil)
+		}
+
+		if calls != 3 {
+			t.Errorf("Expected every user to have their own bucket, got %d calls", calls)
+		}
+	})
+
+	t.Run("The user loaded for the request is looked up once", func(t *testing.T) {
+		l := ratelimit.NewLimiter("test", ratelimit.PerMinute(1), ratelimit.NewMemoryStore(), ByUser(&env))
+
+		var loaded *models.User
+		handle := LoadUser(&env)(RateLimit(&env, l)(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			loaded, _ = sessions.UserFromContext(r.Context())
+		}))
+
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/posts", nil)
+		mockStore.EXPECT().CurrentUser(env.DB, req).Return(&models.User{Id: 4}, nil).Times(1)
+		handle(res, req, nil)
+
+		if res.Code != http.StatusOK || loaded == nil || loaded.Id != 4 {
+			t.Errorf("Expected the handle to get the loaded user, got %d, %v", res.Code, loaded)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/logging"
+)
+
+// Recover catches a panic in the handle, logs it with its stack trace and responds with a JSON 500
+func Recover(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		defer func() {
+			if v := recover(); v != nil {
+				PanicHandler(w, r, v)
+			}
+		}()
+
+		next(w, r, p)
+	}
+}
+
+// PanicHandler is used as httprouter.Router.PanicHandler, so panics in any route are handled the same way as Recover
+func PanicHandler(w http.ResponseWriter, r *http.Request, v interface{}) {
+	// net/http uses ErrAbortHandler to abort a response on purpose, which should not be reported as a failure
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+
+	logging.FromContext(r.Context()).Error("panic",
+		"panic", fmt.Sprint(v),
+		"method", r.Method,
+		"path", r.URL.Path,
+		"stack", string(debug.Stack()),
+	)
+
+	writeError(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/logging"
+)
+
+func TestRecover(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := logging.New(&buf, "json", slog.LevelInfo)
+
+	panics := Recover(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		var rows *strings.Reader
+		rows.Len()
+	})
+
+	h := logging.Handler(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panics(w, r, nil)
+	}))
+
+	t.Run("It responds with a JSON 500 and logs the stack", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/posts", nil)
+		req.Header.Set(logging.RequestIDHeader, "abc-123")
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status 500, got %d", rec.Code)
+		}
+
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Expected a JSON response, got %s", ct)
+		}
+
+		var body errorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Expected a JSON body, got %s", rec.Body.String())
+		}
+
+		if body.Error != "Internal Server Error" || body.RequestID != "abc-123" {
+			t.Errorf("Unexpected body %+v", body)
+		}
+
+		log := buf.String()
+		if !strings.Contains(log, `"msg":"panic"`) || !strings.Contains(log, "recover_test.go") {
+			t.Errorf("Expected the panic to be logged with a stack trace, got %s", log)
+		}
+
+		if !strings.Contains(log, `"request_id":"abc-123"`) {
+			t.Errorf("Expected the panic to be logged with the request id, got %s", log)
+		}
+	})
+
+	t.Run("It passes through handles that do not panic", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		Recover(func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			w.WriteHeader(http.StatusNoContent)
+		})(rec, httptest.NewRequest("GET", "/", nil), nil)
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("Expected status 204, got %d", rec.Code)
+		}
+	})
+}
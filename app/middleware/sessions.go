@@ -8,16 +8,18 @@ import (
 
 type Middleware func(next httprouter.Handle) httprouter.Handle
 
-func LoggedIn(env *config.Env, next httprouter.Handle) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, param httprouter.Params) {
-		if loggedIn, err := env.Store.IsLoggedIn(env.DB, r); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		} else if !loggedIn {
-			http.Error(w, "You must be logged in", http.StatusInternalServerError)
-			return
-		}
+func LoggedIn(env *config.Env) Middleware {
+	return func(next httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, param httprouter.Params) {
+			if loggedIn, err := env.Store.IsLoggedIn(env.DB.WithContext(r.Context()), r); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			} else if !loggedIn {
+				http.Error(w, "You must be logged in", http.StatusInternalServerError)
+				return
+			}
 
-		next(w, r, param)
+			next(w, r, param)
+		}
 	}
 }
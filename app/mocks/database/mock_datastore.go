@@ -5,9 +5,12 @@
 package mockdatabase
 
 import (
+	context "context"
+	database "github.com/alexandersmanning/simcha/app/database"
 	models "github.com/alexandersmanning/simcha/app/models"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
+	time "time"
 )
 
 // MockDatastore is a mock of Datastore interface
@@ -34,18 +37,33 @@ func (m *MockDatastore) EXPECT() *MockDatastoreMockRecorder {
 }
 
 // AllPosts mocks base method
-func (m *MockDatastore) AllPosts() ([]*models.Post, error) {
+func (m *MockDatastore) AllPosts(arg0 database.PostQuery) ([]*models.Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AllPosts")
+	ret := m.ctrl.Call(m, "AllPosts", arg0)
 	ret0, _ := ret[0].([]*models.Post)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AllPosts indicates an expected call of AllPosts
-func (mr *MockDatastoreMockRecorder) AllPosts() *gomock.Call {
+func (mr *MockDatastoreMockRecorder) AllPosts(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllPosts", reflect.TypeOf((*MockDatastore)(nil).AllPosts))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllPosts", reflect.TypeOf((*MockDatastore)(nil).AllPosts), arg0)
+}
+
+// CountUserSessions mocks base method
+func (m *MockDatastore) CountUserSessions() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountUserSessions")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountUserSessions indicates an expected call of CountUserSessions
+func (mr *MockDatastoreMockRecorder) CountUserSessions() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountUserSessions", reflect.TypeOf((*MockDatastore)(nil).CountUserSessions))
 }
 
 // CreatePost mocks base method
@@ -105,6 +123,49 @@ func (mr *MockDatastoreMockRecorder) DeletePost(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePost", reflect.TypeOf((*MockDatastore)(nil).DeletePost), arg0)
 }
 
+// DeleteUser mocks base method
+func (m *MockDatastore) DeleteUser(arg0 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser
+func (mr *MockDatastoreMockRecorder) DeleteUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockDatastore)(nil).DeleteUser), arg0)
+}
+
+// DeletedUsers mocks base method
+func (m *MockDatastore) DeletedUsers() ([]models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletedUsers")
+	ret0, _ := ret[0].([]models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletedUsers indicates an expected call of DeletedUsers
+func (mr *MockDatastoreMockRecorder) DeletedUsers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletedUsers", reflect.TypeOf((*MockDatastore)(nil).DeletedUsers))
+}
+
+// DisableTOTP mocks base method
+func (m *MockDatastore) DisableTOTP(arg0 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableTOTP", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableTOTP indicates an expected call of DisableTOTP
+func (mr *MockDatastoreMockRecorder) DisableTOTP(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableTOTP", reflect.TypeOf((*MockDatastore)(nil).DisableTOTP), arg0)
+}
+
 // EditPost mocks base method
 func (m *MockDatastore) EditPost(arg0 models.PostAction) error {
 	m.ctrl.T.Helper()
@@ -119,6 +180,35 @@ func (mr *MockDatastoreMockRecorder) EditPost(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditPost", reflect.TypeOf((*MockDatastore)(nil).EditPost), arg0)
 }
 
+// EmailTaken mocks base method
+func (m *MockDatastore) EmailTaken(arg0 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EmailTaken", arg0)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EmailTaken indicates an expected call of EmailTaken
+func (mr *MockDatastoreMockRecorder) EmailTaken(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EmailTaken", reflect.TypeOf((*MockDatastore)(nil).EmailTaken), arg0)
+}
+
+// EnableTOTP mocks base method
+func (m *MockDatastore) EnableTOTP(arg0 int, arg1 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableTOTP", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableTOTP indicates an expected call of EnableTOTP
+func (mr *MockDatastoreMockRecorder) EnableTOTP(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableTOTP", reflect.TypeOf((*MockDatastore)(nil).EnableTOTP), arg0, arg1)
+}
+
 // GetPostById mocks base method
 func (m *MockDatastore) GetPostById(arg0 string) (*models.Post, error) {
 	m.ctrl.T.Helper()
@@ -134,6 +224,66 @@ func (mr *MockDatastoreMockRecorder) GetPostById(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostById", reflect.TypeOf((*MockDatastore)(nil).GetPostById), arg0)
 }
 
+// GetPostBySlug mocks base method
+func (m *MockDatastore) GetPostBySlug(arg0 string) (*models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostBySlug", arg0)
+	ret0, _ := ret[0].(*models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostBySlug indicates an expected call of GetPostBySlug
+func (mr *MockDatastoreMockRecorder) GetPostBySlug(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostBySlug", reflect.TypeOf((*MockDatastore)(nil).GetPostBySlug), arg0)
+}
+
+// GetRevision mocks base method
+func (m *MockDatastore) GetRevision(arg0 string, arg1 int) (*models.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRevision", arg0, arg1)
+	ret0, _ := ret[0].(*models.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRevision indicates an expected call of GetRevision
+func (mr *MockDatastoreMockRecorder) GetRevision(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRevision", reflect.TypeOf((*MockDatastore)(nil).GetRevision), arg0, arg1)
+}
+
+// GetTrashedPost mocks base method
+func (m *MockDatastore) GetTrashedPost(arg0 string) (*models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrashedPost", arg0)
+	ret0, _ := ret[0].(*models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTrashedPost indicates an expected call of GetTrashedPost
+func (mr *MockDatastoreMockRecorder) GetTrashedPost(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrashedPost", reflect.TypeOf((*MockDatastore)(nil).GetTrashedPost), arg0)
+}
+
+// GetUserByEmail mocks base method
+func (m *MockDatastore) GetUserByEmail(arg0 string) (models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", arg0)
+	ret0, _ := ret[0].(models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail
+func (mr *MockDatastoreMockRecorder) GetUserByEmail(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockDatastore)(nil).GetUserByEmail), arg0)
+}
+
 // GetUserByEmailAndPassword mocks base method
 func (m *MockDatastore) GetUserByEmailAndPassword(arg0, arg1 string) (models.User, error) {
 	m.ctrl.T.Helper()
@@ -149,6 +299,21 @@ func (mr *MockDatastoreMockRecorder) GetUserByEmailAndPassword(arg0, arg1 interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmailAndPassword", reflect.TypeOf((*MockDatastore)(nil).GetUserByEmailAndPassword), arg0, arg1)
 }
 
+// GetUserById mocks base method
+func (m *MockDatastore) GetUserById(arg0 int) (models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserById", arg0)
+	ret0, _ := ret[0].(models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserById indicates an expected call of GetUserById
+func (mr *MockDatastoreMockRecorder) GetUserById(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserById", reflect.TypeOf((*MockDatastore)(nil).GetUserById), arg0)
+}
+
 // GetUserBySessionToken mocks base method
 func (m *MockDatastore) GetUserBySessionToken(arg0 int, arg1 string) (models.User, error) {
 	m.ctrl.T.Helper()
@@ -164,6 +329,112 @@ func (mr *MockDatastoreMockRecorder) GetUserBySessionToken(arg0, arg1 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserBySessionToken", reflect.TypeOf((*MockDatastore)(nil).GetUserBySessionToken), arg0, arg1)
 }
 
+// ListUsers mocks base method
+func (m *MockDatastore) ListUsers() ([]models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers")
+	ret0, _ := ret[0].([]models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers
+func (mr *MockDatastoreMockRecorder) ListUsers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockDatastore)(nil).ListUsers))
+}
+
+// PostRevisions mocks base method
+func (m *MockDatastore) PostRevisions(arg0 string) ([]*models.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PostRevisions", arg0)
+	ret0, _ := ret[0].([]*models.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PostRevisions indicates an expected call of PostRevisions
+func (mr *MockDatastoreMockRecorder) PostRevisions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostRevisions", reflect.TypeOf((*MockDatastore)(nil).PostRevisions), arg0)
+}
+
+// PostsVersion mocks base method
+func (m *MockDatastore) PostsVersion(arg0 database.PostQuery) (models.PostsVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PostsVersion", arg0)
+	ret0, _ := ret[0].(models.PostsVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PostsVersion indicates an expected call of PostsVersion
+func (mr *MockDatastoreMockRecorder) PostsVersion(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostsVersion", reflect.TypeOf((*MockDatastore)(nil).PostsVersion), arg0)
+}
+
+// PruneRevisions mocks base method
+func (m *MockDatastore) PruneRevisions(arg0 database.RetentionPolicy, arg1 time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PruneRevisions", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PruneRevisions indicates an expected call of PruneRevisions
+func (mr *MockDatastoreMockRecorder) PruneRevisions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PruneRevisions", reflect.TypeOf((*MockDatastore)(nil).PruneRevisions), arg0, arg1)
+}
+
+// PublishDue mocks base method
+func (m *MockDatastore) PublishDue(arg0 time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishDue", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PublishDue indicates an expected call of PublishDue
+func (mr *MockDatastoreMockRecorder) PublishDue(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishDue", reflect.TypeOf((*MockDatastore)(nil).PublishDue), arg0)
+}
+
+// PurgeSessions mocks base method
+func (m *MockDatastore) PurgeSessions() (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeSessions")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeSessions indicates an expected call of PurgeSessions
+func (mr *MockDatastoreMockRecorder) PurgeSessions() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeSessions", reflect.TypeOf((*MockDatastore)(nil).PurgeSessions))
+}
+
+// PurgeTrash mocks base method
+func (m *MockDatastore) PurgeTrash(arg0 time.Time) (int64, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeTrash", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// PurgeTrash indicates an expected call of PurgeTrash
+func (mr *MockDatastoreMockRecorder) PurgeTrash(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeTrash", reflect.TypeOf((*MockDatastore)(nil).PurgeTrash), arg0)
+}
+
 // RemoveAllUserSessions mocks base method
 func (m *MockDatastore) RemoveAllUserSessions(arg0 int) error {
 	m.ctrl.T.Helper()
@@ -192,6 +463,134 @@ func (mr *MockDatastoreMockRecorder) RemoveSessionToken(arg0, arg1 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveSessionToken", reflect.TypeOf((*MockDatastore)(nil).RemoveSessionToken), arg0, arg1)
 }
 
+// ResetPassword mocks base method
+func (m *MockDatastore) ResetPassword(arg0 int, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetPassword indicates an expected call of ResetPassword
+func (mr *MockDatastoreMockRecorder) ResetPassword(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockDatastore)(nil).ResetPassword), arg0, arg1)
+}
+
+// RestorePost mocks base method
+func (m *MockDatastore) RestorePost(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestorePost", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestorePost indicates an expected call of RestorePost
+func (mr *MockDatastoreMockRecorder) RestorePost(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestorePost", reflect.TypeOf((*MockDatastore)(nil).RestorePost), arg0)
+}
+
+// RestoreUser mocks base method
+func (m *MockDatastore) RestoreUser(arg0 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreUser", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreUser indicates an expected call of RestoreUser
+func (mr *MockDatastoreMockRecorder) RestoreUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreUser", reflect.TypeOf((*MockDatastore)(nil).RestoreUser), arg0)
+}
+
+// SetPostStatus mocks base method
+func (m *MockDatastore) SetPostStatus(arg0 models.PostAction) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPostStatus", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPostStatus indicates an expected call of SetPostStatus
+func (mr *MockDatastoreMockRecorder) SetPostStatus(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPostStatus", reflect.TypeOf((*MockDatastore)(nil).SetPostStatus), arg0)
+}
+
+// SetTOTPSecret mocks base method
+func (m *MockDatastore) SetTOTPSecret(arg0 int, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTOTPSecret", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTOTPSecret indicates an expected call of SetTOTPSecret
+func (mr *MockDatastoreMockRecorder) SetTOTPSecret(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTOTPSecret", reflect.TypeOf((*MockDatastore)(nil).SetTOTPSecret), arg0, arg1)
+}
+
+// SetUserEmail mocks base method
+func (m *MockDatastore) SetUserEmail(arg0 int, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserEmail", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserEmail indicates an expected call of SetUserEmail
+func (mr *MockDatastoreMockRecorder) SetUserEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserEmail", reflect.TypeOf((*MockDatastore)(nil).SetUserEmail), arg0, arg1)
+}
+
+// SetUserRole mocks base method
+func (m *MockDatastore) SetUserRole(arg0 int, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRole", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRole indicates an expected call of SetUserRole
+func (mr *MockDatastoreMockRecorder) SetUserRole(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRole", reflect.TypeOf((*MockDatastore)(nil).SetUserRole), arg0, arg1)
+}
+
+// Tags mocks base method
+func (m *MockDatastore) Tags(arg0 database.PostQuery) ([]models.TagCount, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Tags", arg0)
+	ret0, _ := ret[0].([]models.TagCount)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Tags indicates an expected call of Tags
+func (mr *MockDatastoreMockRecorder) Tags(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Tags", reflect.TypeOf((*MockDatastore)(nil).Tags), arg0)
+}
+
+// TrashedPosts mocks base method
+func (m *MockDatastore) TrashedPosts(arg0 int) ([]*models.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrashedPosts", arg0)
+	ret0, _ := ret[0].([]*models.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TrashedPosts indicates an expected call of TrashedPosts
+func (mr *MockDatastoreMockRecorder) TrashedPosts(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrashedPosts", reflect.TypeOf((*MockDatastore)(nil).TrashedPosts), arg0)
+}
+
 // UpdatePassword mocks base method
 func (m *MockDatastore) UpdatePassword(arg0 models.UserAction, arg1, arg2, arg3 string) error {
 	m.ctrl.T.Helper()
@@ -206,6 +605,36 @@ func (mr *MockDatastoreMockRecorder) UpdatePassword(arg0, arg1, arg2, arg3 inter
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockDatastore)(nil).UpdatePassword), arg0, arg1, arg2, arg3)
 }
 
+// UseRecoveryCode mocks base method
+func (m *MockDatastore) UseRecoveryCode(arg0 int, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode
+func (mr *MockDatastoreMockRecorder) UseRecoveryCode(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockDatastore)(nil).UseRecoveryCode), arg0, arg1)
+}
+
+// UseTOTPStep mocks base method
+func (m *MockDatastore) UseTOTPStep(arg0 int, arg1 int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep
+func (mr *MockDatastoreMockRecorder) UseTOTPStep(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockDatastore)(nil).UseTOTPStep), arg0, arg1)
+}
+
 // UserExists mocks base method
 func (m *MockDatastore) UserExists(arg0 string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -220,3 +649,17 @@ func (mr *MockDatastoreMockRecorder) UserExists(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserExists", reflect.TypeOf((*MockDatastore)(nil).UserExists), arg0)
 }
+
+// WithContext mocks base method
+func (m *MockDatastore) WithContext(arg0 context.Context) database.Datastore {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WithContext", arg0)
+	ret0, _ := ret[0].(database.Datastore)
+	return ret0
+}
+
+// WithContext indicates an expected call of WithContext
+func (mr *MockDatastoreMockRecorder) WithContext(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithContext", reflect.TypeOf((*MockDatastore)(nil).WithContext), arg0)
+}
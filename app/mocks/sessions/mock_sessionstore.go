@@ -35,6 +35,18 @@ func (m *MockSessionStore) EXPECT() *MockSessionStoreMockRecorder {
 	return m.recorder
 }
 
+// BeginTwoFactor mocks base method
+func (m *MockSessionStore) BeginTwoFactor(arg0 *models.User, arg1 http.ResponseWriter, arg2 *http.Request) error {
+	ret := m.ctrl.Call(m, "BeginTwoFactor", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// BeginTwoFactor indicates an expected call of BeginTwoFactor
+func (mr *MockSessionStoreMockRecorder) BeginTwoFactor(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginTwoFactor", reflect.TypeOf((*MockSessionStore)(nil).BeginTwoFactor), arg0, arg1, arg2)
+}
+
 // CurrentUser mocks base method
 func (m *MockSessionStore) CurrentUser(arg0 database.Datastore, arg1 *http.Request) (*models.User, error) {
 	ret := m.ctrl.Call(m, "CurrentUser", arg0, arg1)
@@ -84,3 +96,16 @@ func (m *MockSessionStore) Logout(arg0 database.Datastore, arg1 http.ResponseWri
 func (mr *MockSessionStoreMockRecorder) Logout(arg0, arg1, arg2 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockSessionStore)(nil).Logout), arg0, arg1, arg2)
 }
+
+// PendingTwoFactor mocks base method
+func (m *MockSessionStore) PendingTwoFactor(arg0 *http.Request) (int, error) {
+	ret := m.ctrl.Call(m, "PendingTwoFactor", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PendingTwoFactor indicates an expected call of PendingTwoFactor
+func (mr *MockSessionStoreMockRecorder) PendingTwoFactor(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PendingTwoFactor", reflect.TypeOf((*MockSessionStore)(nil).PendingTwoFactor), arg0)
+}
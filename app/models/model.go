@@ -3,6 +3,8 @@ package models
 import (
 	"fmt"
 	"encoding/gob"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -21,6 +23,33 @@ func (m *ModelError) Error() string {
 	return fmt.Sprintf("%s %s", m.FieldName, m.ErrorText)
 }
 
+//ValidationErrors maps the JSON name of each invalid field to what is wrong with it
+type ValidationErrors map[string]string
+
+func (v ValidationErrors) Error() string {
+	fields := make([]string, 0, len(v))
+	for f := range v {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	problems := make([]string, len(fields))
+	for i, f := range fields {
+		problems[i] = f + " " + v[f]
+	}
+
+	return strings.Join(problems, ", ")
+}
+
+//Err returns the errors, or nil when there are none
+func (v ValidationErrors) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+
+	return v
+}
+
 func init() {
 	gob.Register(&User{})
 }
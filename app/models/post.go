@@ -1,6 +1,13 @@
 package models
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 //Post is a struct for creating a simple blog post
 type Post struct {
@@ -10,6 +17,106 @@ type Post struct {
 	Title      string    `json:"title"`
 	CreatedAt  time.Time `json:"createdAt,omitempty"`
 	ModifiedAt time.Time `json:"updatedAt,omitempty"`
+	//Tags and Category are slugs, see Slug. A post has any number of tags, up to MaxTags, and at most one category
+	Tags     []string `json:"tags,omitempty"`
+	Category string   `json:"category,omitempty"`
+	//Slug names the post in its permalink. It is made from the title by the store, and changes with it
+	Slug string `json:"slug,omitempty"`
+	//Version is incremented by every edit, so edits based on an older copy can be refused
+	Version int `json:"version"`
+	//Status is where the post is in the publishing workflow, and PublishedAt when it was or will be published
+	Status      string     `json:"status"`
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+	//DeletedAt is when the post was moved to the trash, from which it can be restored until it is purged
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	//EditedBy is the id of the user making an edit, recorded as the author of its revision. The author of the post is
+	//recorded when it is zero
+	EditedBy int `json:"-"`
+}
+
+//Limits on the fields of a post
+const (
+	MaxTitleLength = 200
+	MaxBodyLength  = 100000
+)
+
+//Validate checks the fields clients may edit. Tags are checked as they are, so normalize them first
+func (p *Post) Validate() error {
+	errs := ValidationErrors{}
+
+	if strings.TrimSpace(p.Title) == "" {
+		errs["title"] = "must not be empty"
+	} else if utf8.RuneCountInString(p.Title) > MaxTitleLength {
+		errs["title"] = fmt.Sprintf("must be at most %d characters", MaxTitleLength)
+	}
+
+	if utf8.RuneCountInString(p.Body) > MaxBodyLength {
+		errs["body"] = fmt.Sprintf("must be at most %d characters", MaxBodyLength)
+	}
+
+	if err := p.ValidateTags(); err != nil {
+		for field, problem := range err.(ValidationErrors) {
+			errs[field] = problem
+		}
+	}
+
+	return errs.Err()
+}
+
+//Statuses of a post. Only published posts are public, drafts, scheduled and archived posts are only seen by their
+//author and admins
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+//Statuses lists every status a post can have
+var Statuses = []string{StatusDraft, StatusScheduled, StatusPublished, StatusArchived}
+
+//SetStatus moves the post to the status. Posts published now are published at now, scheduled posts at the time they
+//are scheduled for, and drafts are unpublished. Archived posts, and posts which were already published, keep the time
+//they were published at
+func (p *Post) SetStatus(status string, scheduledFor *time.Time, now time.Time) {
+	switch status {
+	case StatusDraft:
+		p.PublishedAt = nil
+	case StatusScheduled:
+		p.PublishedAt = scheduledFor
+	case StatusPublished:
+		if (p.Status != StatusPublished && p.Status != StatusArchived) || p.PublishedAt == nil {
+			p.PublishedAt = &now
+		}
+	}
+
+	p.Status = status
+}
+
+//ValidateStatus checks the status, and that scheduled posts are scheduled after now
+func (p *Post) ValidateStatus(now time.Time) error {
+	errs := ValidationErrors{}
+
+	valid := false
+	for _, s := range Statuses {
+		valid = valid || p.Status == s
+	}
+
+	switch {
+	case !valid:
+		errs["status"] = "must be one of " + strings.Join(Statuses, ", ")
+	case p.Status == StatusScheduled && p.PublishedAt == nil:
+		errs["publishedAt"] = "is required to schedule a post"
+	case p.Status == StatusScheduled && !p.PublishedAt.After(now):
+		errs["publishedAt"] = "must be in the future"
+	}
+
+	return errs.Err()
+}
+
+//Published reports whether the post is public
+func (p *Post) Published() bool {
+	return p.Status == StatusPublished
 }
 
 type PostAction interface {
@@ -36,3 +143,51 @@ func (p *Post) SetTimestamps() {
 func (p *Post) Timestamps() (time.Time, time.Time) {
 	return p.CreatedAt, p.ModifiedAt
 }
+
+//ETag is a strong validator of this version of the post
+func (p *Post) ETag() string {
+	return fmt.Sprintf(`"%d-%d"`, p.Id, p.Version)
+}
+
+//PostsVersion summarizes the post list, and changes whenever a post is created, edited or deleted, or one of their
+//authors is modified, as the list embeds their emails
+type PostsVersion struct {
+	Count        int
+	MaxId        int
+	LastModified time.Time
+}
+
+//VersionOf computes the version of a loaded list, the same way the database computes it without loading the posts
+func VersionOf(posts []*Post) PostsVersion {
+	v := PostsVersion{Count: len(posts)}
+	for _, p := range posts {
+		if p.Id > v.MaxId {
+			v.MaxId = p.Id
+		}
+		if p.ModifiedAt.After(v.LastModified) {
+			v.LastModified = p.ModifiedAt
+		}
+		if p.Author.ModifiedAt.After(v.LastModified) {
+			v.LastModified = p.Author.ModifiedAt
+		}
+	}
+
+	return v
+}
+
+//ETag is a strong validator of the list with this version
+func (v PostsVersion) ETag() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%d:%d", v.Count, v.MaxId, v.LastModified.UnixMicro())))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+//Revision is a snapshot of a post, saved each time it is created, edited or its status changes. Its number is the
+//version of the post it holds, and its author is the user who made the change
+type Revision struct {
+	PostId    int       `json:"postId"`
+	Number    int       `json:"revision"`
+	Author    User      `json:"author"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
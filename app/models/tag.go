@@ -0,0 +1,76 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alexandersmanning/simcha/app/slug"
+)
+
+// Limits on the tags and category of a post
+const (
+	MaxTags      = 10
+	MaxTagLength = 40
+)
+
+// NoSlug is the problem with a tag or category which has no slug
+const NoSlug = "must contain a letter or digit which can be written in latin letters"
+
+// TagCount is a tag with the number of posts it is on
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Posts int    `json:"posts"`
+}
+
+// NormalizeTags replaces the tags and category with their slugs, made like those of posts so "Go Lang!" and "go-lang"
+// are the same tag, dropping empty and repeated tags. Tags which are not empty but have no slug, as they have no
+// letter or digit the slug package transliterates, are not dropped but refused
+func (p *Post) NormalizeTags() error {
+	errs := ValidationErrors{}
+
+	category := p.Category
+	if p.Category = slug.Make(category); p.Category == "" && strings.TrimSpace(category) != "" {
+		errs["category"] = NoSlug
+	}
+
+	if p.Tags != nil {
+		seen := make(map[string]bool, len(p.Tags))
+		tags := p.Tags[:0]
+		for _, t := range p.Tags {
+			s := slug.Make(t)
+			if s == "" && strings.TrimSpace(t) != "" {
+				errs["tags"] = "each " + NoSlug
+			}
+			if s == "" || seen[s] {
+				continue
+			}
+			seen[s] = true
+			tags = append(tags, s)
+		}
+
+		p.Tags = tags
+	}
+
+	return errs.Err()
+}
+
+// ValidateTags checks the number and length of the tags and the length of the category, once they are normalized
+func (p *Post) ValidateTags() error {
+	errs := ValidationErrors{}
+
+	if len(p.Tags) > MaxTags {
+		errs["tags"] = fmt.Sprintf("must be at most %d", MaxTags)
+	}
+	for _, t := range p.Tags {
+		if utf8.RuneCountInString(t) > MaxTagLength {
+			errs["tags"] = fmt.Sprintf("must each be at most %d characters", MaxTagLength)
+		}
+	}
+
+	if utf8.RuneCountInString(p.Category) > MaxTagLength {
+		errs["category"] = fmt.Sprintf("must be at most %d characters", MaxTagLength)
+	}
+
+	return errs.Err()
+}
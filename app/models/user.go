@@ -1,6 +1,7 @@
 package models
 
 import (
+	"net/mail"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -15,6 +16,28 @@ type User struct {
 	PasswordDigest       string	`json:"-"`
 	CreatedAt            time.Time `json:"createdAt,omitempty"`
 	ModifiedAt           time.Time `json:"modifiedAt,omitempty"`
+	TOTPSecret           string    `json:"-"`
+	TOTPEnabled          bool      `json:"totpEnabled"`
+	Role                 string    `json:"role"`
+	// DeletedAt is when the account was moved to the trash, from which it can be restored until it is purged
+	DeletedAt            *time.Time `json:"deletedAt,omitempty"`
+}
+
+// Roles a user can have. Admins may manage any post
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// ValidRole checks the role is one of the known roles
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
+// ValidEmail checks the email is a bare address, such as name@example.com
+func ValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
 }
 
 // Idea from https://stackoverflow.com/questions/26027350/go-interface-fields
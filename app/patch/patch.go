@@ -0,0 +1,438 @@
+/*
+Package patch applies JSON Merge Patch (RFC 7386) and JSON Patch (RFC 6902)
+documents to the JSON representation of a resource
+*/
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of the supported patch formats
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrUnsupportedType is returned by Apply for a media type which is not a supported patch format
+var ErrUnsupportedType = errors.New("patch: the content type must be " + MergePatchType + " or " + JSONPatchType)
+
+// ErrTestFailed is returned when a test operation of a JSON Patch does not match the document
+var ErrTestFailed = errors.New("patch: test operation failed")
+
+// Error is a patch which is well formed, but cannot be applied to the document
+type Error struct {
+	// Op is the index of the failing JSON Patch operation, or -1 for a merge patch
+	Op      int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Op < 0 {
+		return "patch: " + e.Message
+	}
+	return fmt.Sprintf("patch: operation %d: %s", e.Op, e.Message)
+}
+
+// Apply applies the patch to the JSON document, in the format named by contentType. Plain application/json is read
+// as a merge patch, which it is a subset of
+func Apply(contentType string, doc, patch []byte) ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+
+	switch mediaType {
+	case MergePatchType, "application/json":
+		return MergePatch(doc, patch)
+	case JSONPatchType:
+		return JSONPatch(doc, patch)
+	}
+
+	return nil, ErrUnsupportedType
+}
+
+// decode parses JSON keeping numbers as written, so documents round trip unchanged
+func decode(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+
+	return v, nil
+}
+
+// MergePatch applies a JSON Merge Patch: members of the patch replace those of the document, null removes them, and
+// objects are merged recursively
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := decode(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = merge(t[k], v)
+		}
+	}
+
+	return t
+}
+
+// Operation is a single JSON Patch operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch applies the operations of a JSON Patch in order. The document is left unchanged when any of them fails
+func JSONPatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		if target, err = apply(target, op); err != nil {
+			if errors.Is(err, ErrTestFailed) {
+				return nil, fmt.Errorf("%w: operation %d", ErrTestFailed, i)
+			}
+			return nil, &Error{Op: i, Message: err.Error()}
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func apply(doc interface{}, op Operation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (interface{}, error) {
+		if op.Value == nil {
+			return nil, errors.New("value is required")
+		}
+		return decode(op.Value)
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return v, nil
+		}
+		doc, _, err := remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		var v interface{}
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, errors.New("cannot move a value into itself")
+			}
+			if doc, v, err = remove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			if v, err = get(doc, from); err != nil {
+				return nil, err
+			}
+			// copies must not share maps or slices with the source
+			b, _ := json.Marshal(v)
+			v, _ = decode(b)
+		}
+		return add(doc, path, v)
+
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(current, v) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped tokens
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("path %q must start with /", p)
+	}
+
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func pointer(tokens []string) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	return "/" + strings.Join(tokens, "/")
+}
+
+// index parses an array index. With end, "-" and the index after the last element are allowed too, for add to append
+func index(token string, length int, end bool) (int, error) {
+	if end && token == "-" {
+		return length, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	max := length - 1
+	if end {
+		max = length
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of bounds", i)
+	}
+
+	return i, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for i, t := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[t]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", pointer(path[:i+1]))
+			}
+			doc = v
+		case []interface{}:
+			n, err := index(t, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[n]
+		default:
+			return nil, fmt.Errorf("path %s does not exist", pointer(path[:i+1]))
+		}
+	}
+
+	return doc, nil
+}
+
+// add sets the value at path, inserting it into arrays, and returns the document, which is replaced when path is empty
+func add(doc interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = v
+		return doc, nil
+	case []interface{}:
+		n, err := index(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node[:n:n], append([]interface{}{v}, node[n:]...)...)
+		return set(doc, path[:len(path)-1], node)
+	}
+
+	return nil, fmt.Errorf("path %s does not exist", pointer(path[:len(path)-1]))
+}
+
+// set replaces the value at path, which must exist, such as an array resized by add or remove
+func set(doc interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = v
+		return doc, nil
+	case []interface{}:
+		n, err := index(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[n] = v
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("path %s does not exist", pointer(path))
+}
+
+// remove deletes the value at path, returning the document and the removed value
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		v, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %s does not exist", pointer(path))
+		}
+		delete(node, last)
+		return doc, v, nil
+	case []interface{}:
+		n, err := index(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := node[n]
+		node = append(node[:n:n], node[n+1:]...)
+		doc, err := set(doc, path[:len(path)-1], node)
+		return doc, v, err
+	}
+
+	return nil, nil, fmt.Errorf("path %s does not exist", pointer(path))
+}
+
+// equal compares JSON values, with numbers compared by value rather than by how they were written
+func equal(a, b interface{}) bool {
+	if na, ok := a.(json.Number); ok {
+		nb, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, errA := na.Float64()
+		fb, errB := nb.Float64()
+		return errA == nil && errB == nil && fa == fb
+	}
+
+	switch va := a.(type) {
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for k, v := range va {
+			if w, ok := vb[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !equal(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,153 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// sameJSON compares documents regardless of the order of their members
+func sameJSON(t *testing.T, got []byte, expected string) {
+	t.Helper()
+
+	var g, e interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(expected), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	gb, _ := json.Marshal(g)
+	eb, _ := json.Marshal(e)
+	if string(gb) != string(eb) {
+		t.Errorf("Expected %s, got %s", eb, gb)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// the examples of RFC 7386, appendix A
+	cases := []struct {
+		doc, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, c := range cases {
+		got, err := MergePatch([]byte(c.doc), []byte(c.patch))
+		if err != nil {
+			t.Errorf("%s + %s: %v", c.doc, c.patch, err)
+			continue
+		}
+		sameJSON(t, got, c.expected)
+	}
+
+	if _, err := MergePatch([]byte(`{}`), []byte(`{"a":`)); err == nil {
+		t.Error("Expected an error for a malformed patch")
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	// mostly the examples of RFC 6902, appendix A
+	cases := []struct {
+		name, doc, patch, expected string
+	}{
+		{"add a member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add an element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append an element", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"foo":["bar","qux"]}`},
+		{"remove a member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove an element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace a value", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move a value", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"move an element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`},
+		{"copy a value", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			`{"a":{"b":1},"c":{"b":2}}`},
+		{"test then add", `{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0},{"op":"add","path":"/x","value":1}]`,
+			`{"baz":"qux","foo":["a",2,"c"],"x":1}`},
+		{"nested arrays", `{"a":[[1,2],[3]]}`, `[{"op":"add","path":"/a/0/1","value":9}]`, `{"a":[[1,9,2],[3]]}`},
+		{"escaped pointers", `{"a/b":{"m~n":1}}`, `[{"op":"replace","path":"/a~1b/m~0n","value":2}]`, `{"a/b":{"m~n":2}}`},
+		{"replace the document", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+		{"add null", `{}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := JSONPatch([]byte(c.doc), []byte(c.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sameJSON(t, got, c.expected)
+		})
+	}
+
+	t.Run("A failed test is reported", func(t *testing.T) {
+		_, err := JSONPatch([]byte(`{"baz":"qux"}`), []byte(`[{"op":"test","path":"/baz","value":"bar"}]`))
+		if !errors.Is(err, ErrTestFailed) {
+			t.Errorf("Expected ErrTestFailed, got %v", err)
+		}
+	})
+
+	failures := []struct {
+		name, doc, patch string
+	}{
+		{"missing member", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`},
+		{"missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`},
+		{"index out of bounds", `{"foo":[1]}`, `[{"op":"add","path":"/foo/3","value":2}]`},
+		{"leading zero index", `{"foo":[1,2]}`, `[{"op":"remove","path":"/foo/01"}]`},
+		{"unknown op", `{}`, `[{"op":"merge","path":"/a","value":1}]`},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`},
+		{"relative path", `{}`, `[{"op":"add","path":"a","value":1}]`},
+		{"move into a child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`},
+	}
+
+	for _, c := range failures {
+		t.Run("It fails on a "+c.name, func(t *testing.T) {
+			_, err := JSONPatch([]byte(c.doc), []byte(c.patch))
+
+			var pe *Error
+			if !errors.As(err, &pe) || pe.Op != 0 {
+				t.Errorf("Expected an error for operation 0, got %v", err)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	doc := []byte(`{"title":"a","body":"b"}`)
+
+	got, err := Apply(MergePatchType+"; charset=utf-8", doc, []byte(`{"title":"c"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameJSON(t, got, `{"title":"c","body":"b"}`)
+
+	got, err = Apply(JSONPatchType, doc, []byte(`[{"op":"replace","path":"/body","value":"d"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameJSON(t, got, `{"title":"a","body":"d"}`)
+
+	for _, ct := range []string{"text/plain", "", "application/xml"} {
+		if _, err := Apply(ct, doc, []byte(`{}`)); err != ErrUnsupportedType {
+			t.Errorf("Expected %q to be unsupported, got %v", ct, err)
+		}
+	}
+}
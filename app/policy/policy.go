@@ -0,0 +1,129 @@
+/*
+Package policy decides whether a user may perform an action on a resource.
+
+Rules are registered per action, for example "post.update", and are plain Go
+predicates over the subject, the resource and the request context. Every
+decision records which rule allowed or denied it, so a refused request can be
+explained when debugging.
+*/
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+// Rule is a predicate deciding a single action. It returns whether the action is allowed, and a short reason
+type Rule func(ctx context.Context, subject *models.User, resource interface{}) (bool, string)
+
+// Decision is the explainable result of an authorization check
+type Decision struct {
+	Allowed bool
+	Action  string
+	Rule    string
+	Reason  string
+}
+
+func (d Decision) String() string {
+	verdict := "deny"
+	if d.Allowed {
+		verdict = "allow"
+	}
+
+	return fmt.Sprintf("%s %s (rule %q): %s", verdict, d.Action, d.Rule, d.Reason)
+}
+
+// Error returns an error describing a denied decision, or nil if it was allowed
+func (d Decision) Error() error {
+	if d.Allowed {
+		return nil
+	}
+
+	return &DeniedError{d}
+}
+
+// DeniedError is returned when a decision does not allow an action
+type DeniedError struct {
+	Decision Decision
+}
+
+func (e *DeniedError) Error() string {
+	return e.Decision.String()
+}
+
+type namedRule struct {
+	name string
+	rule Rule
+}
+
+// Engine holds the rules for every registered action. The zero value is not usable, use NewEngine
+type Engine struct {
+	mu    sync.RWMutex
+	rules map[string][]namedRule
+}
+
+// NewEngine creates an empty Engine
+func NewEngine() *Engine {
+	return &Engine{rules: make(map[string][]namedRule)}
+}
+
+// Register adds a named rule to an action. Rules for an action are evaluated in registration order,
+// and the first rule that allows the action wins
+func (e *Engine) Register(action, name string, rule Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules[action] = append(e.rules[action], namedRule{name: name, rule: rule})
+}
+
+// Actions returns every action with at least one registered rule
+func (e *Engine) Actions() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	actions := make([]string, 0, len(e.rules))
+	for action := range e.rules {
+		actions = append(actions, action)
+	}
+
+	return actions
+}
+
+// Authorize evaluates the rules of an action. Actions without rules are denied
+func (e *Engine) Authorize(ctx context.Context, subject *models.User, action string, resource interface{}) Decision {
+	e.mu.RLock()
+	rules := e.rules[action]
+	e.mu.RUnlock()
+
+	if len(rules) == 0 {
+		return Decision{Action: action, Reason: "no rules registered"}
+	}
+
+	var reasons []string
+	for _, r := range rules {
+		allowed, reason := r.rule(ctx, subject, resource)
+		if allowed {
+			return Decision{Allowed: true, Action: action, Rule: r.name, Reason: reason}
+		}
+		reasons = append(reasons, r.name+": "+reason)
+	}
+
+	return Decision{Action: action, Rule: rules[len(rules)-1].name, Reason: strings.Join(reasons, "; ")}
+}
+
+// DefaultEngine is the engine used by the package level functions, and holds the application rules
+var DefaultEngine = NewEngine()
+
+// Register adds a rule to the DefaultEngine
+func Register(action, name string, rule Rule) {
+	DefaultEngine.Register(action, name, rule)
+}
+
+// Authorize checks an action against the DefaultEngine
+func Authorize(ctx context.Context, subject *models.User, action string, resource interface{}) Decision {
+	return DefaultEngine.Authorize(ctx, subject, action, resource)
+}
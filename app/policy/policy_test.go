@@ -0,0 +1,114 @@
+package policy_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/policy"
+	"github.com/alexandersmanning/simcha/app/policy/policytest"
+)
+
+func TestDefaultRules(t *testing.T) {
+	author := &models.User{Id: 1, Email: "author@fake.com"}
+	other := &models.User{Id: 2, Email: "other@fake.com"}
+	anonymous := &models.User{}
+	admin := &models.User{Id: 3, Email: "admin@fake.com", Role: models.RoleAdmin}
+	post := &models.Post{Id: 10, Author: *author, Status: models.StatusPublished}
+	draft := &models.Post{Id: 11, Author: *author, Status: models.StatusDraft}
+
+	policytest.AssertTable(t, policy.DefaultEngine, []policytest.Case{
+		{Name: "Anyone can read published posts", Subject: anonymous, Action: policy.PostRead, Resource: post, Allowed: true},
+		{Name: "Anonymous users cannot read drafts", Subject: anonymous, Action: policy.PostRead, Resource: draft, Allowed: false},
+		{Name: "Other user cannot read drafts", Subject: other, Action: policy.PostRead, Resource: draft, Allowed: false},
+		{Name: "Author can read drafts", Subject: author, Action: policy.PostRead, Resource: draft, Allowed: true},
+		{Name: "Admin can read drafts", Subject: admin, Action: policy.PostRead, Resource: draft, Allowed: true},
+		{Name: "Admin can list every post", Subject: admin, Action: policy.PostReadAll, Resource: nil, Allowed: true},
+		{Name: "Author cannot list every post", Subject: author, Action: policy.PostReadAll, Resource: nil, Allowed: false},
+		{Name: "Anonymous users cannot create posts", Subject: anonymous, Action: policy.PostCreate, Resource: post, Allowed: false},
+		{Name: "Logged in users can create posts", Subject: other, Action: policy.PostCreate, Resource: post, Allowed: true},
+		{Name: "Author can update", Subject: author, Action: policy.PostUpdate, Resource: post, Allowed: true},
+		{Name: "Other user cannot update", Subject: other, Action: policy.PostUpdate, Resource: post, Allowed: false},
+		{Name: "Anonymous user cannot update", Subject: anonymous, Action: policy.PostUpdate, Resource: post, Allowed: false},
+		{Name: "Nil subject cannot delete", Subject: nil, Action: policy.PostDelete, Resource: post, Allowed: false},
+		{Name: "Author can delete", Subject: author, Action: policy.PostDelete, Resource: post, Allowed: true},
+		{Name: "Other user cannot delete", Subject: other, Action: policy.PostDelete, Resource: post, Allowed: false},
+		{Name: "Admin can update any post", Subject: admin, Action: policy.PostUpdate, Resource: post, Allowed: true},
+		{Name: "Admin can delete any post", Subject: admin, Action: policy.PostDelete, Resource: post, Allowed: true},
+		{Name: "Author can restore", Subject: author, Action: policy.PostRestore, Resource: post, Allowed: true},
+		{Name: "Other user cannot restore", Subject: other, Action: policy.PostRestore, Resource: post, Allowed: false},
+		{Name: "Admin can restore any post", Subject: admin, Action: policy.PostRestore, Resource: post, Allowed: true},
+		{Name: "Anonymous admin role is ignored", Subject: &models.User{Role: models.RoleAdmin}, Action: policy.PostDelete, Resource: post, Allowed: false},
+		{Name: "Update requires a post", Subject: author, Action: policy.PostUpdate, Resource: author, Allowed: false},
+		{Name: "User can read self", Subject: author, Action: policy.UserRead, Resource: author, Allowed: true},
+		{Name: "User cannot read others", Subject: author, Action: policy.UserRead, Resource: other, Allowed: false},
+		{Name: "User can update self", Subject: author, Action: policy.UserUpdate, Resource: author, Allowed: true},
+		{Name: "User cannot update others", Subject: author, Action: policy.UserUpdate, Resource: other, Allowed: false},
+		{Name: "Admin can update any user", Subject: admin, Action: policy.UserUpdate, Resource: other, Allowed: true},
+		{Name: "User cannot change their own role", Subject: author, Action: policy.UserSetRole, Resource: author, Allowed: false},
+		{Name: "Admin can change roles", Subject: admin, Action: policy.UserSetRole, Resource: other, Allowed: true},
+		{Name: "User can delete self", Subject: author, Action: policy.UserDelete, Resource: author, Allowed: true},
+		{Name: "User cannot delete others", Subject: author, Action: policy.UserDelete, Resource: other, Allowed: false},
+		{Name: "Admin can delete any user", Subject: admin, Action: policy.UserDelete, Resource: other, Allowed: true},
+		{Name: "User cannot restore users", Subject: author, Action: policy.UserRestore, Resource: author, Allowed: false},
+		{Name: "Admin can restore users", Subject: admin, Action: policy.UserRestore, Resource: other, Allowed: true},
+		{Name: "Unknown actions are denied", Subject: author, Action: "post.unknown", Resource: post, Allowed: false},
+	})
+}
+
+func TestEngine(t *testing.T) {
+	deny := func(ctx context.Context, subject *models.User, resource interface{}) (bool, string) {
+		return false, "never"
+	}
+	allow := func(ctx context.Context, subject *models.User, resource interface{}) (bool, string) {
+		return true, "always"
+	}
+
+	t.Run("First allowing rule wins", func(t *testing.T) {
+		e := policy.NewEngine()
+		e.Register("thing.do", "deny", deny)
+		e.Register("thing.do", "allow", allow)
+
+		d := e.Authorize(context.Background(), nil, "thing.do", nil)
+		if !d.Allowed || d.Rule != "allow" {
+			t.Errorf("Expected the allow rule to decide, got %s", d)
+		}
+
+		if d.Error() != nil {
+			t.Errorf("Expected no error for an allowed decision, got %v", d.Error())
+		}
+	})
+
+	t.Run("Denials explain every rule", func(t *testing.T) {
+		e := policy.NewEngine()
+		e.Register("thing.do", "first", deny)
+		e.Register("thing.do", "second", deny)
+
+		d := e.Authorize(context.Background(), nil, "thing.do", nil)
+		if d.Allowed {
+			t.Fatal("Expected the action to be denied")
+		}
+
+		if !strings.Contains(d.Reason, "first: never") || !strings.Contains(d.Reason, "second: never") {
+			t.Errorf("Expected both rules in the reason, got %s", d.Reason)
+		}
+
+		if _, ok := d.Error().(*policy.DeniedError); !ok {
+			t.Errorf("Expected a DeniedError, got %v", d.Error())
+		}
+	})
+
+	t.Run("Rules receive the context", func(t *testing.T) {
+		type key struct{}
+		e := policy.NewEngine()
+		e.Register("thing.do", "context", func(ctx context.Context, subject *models.User, resource interface{}) (bool, string) {
+			return ctx.Value(key{}) == "yes", "checked context"
+		})
+
+		ctx := context.WithValue(context.Background(), key{}, "yes")
+		if d := e.Authorize(ctx, nil, "thing.do", nil); !d.Allowed {
+			t.Errorf("Expected the context rule to allow, got %s", d)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+/*
+Package policytest contains helpers for asserting policy tables in tests
+*/
+package policytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alexandersmanning/simcha/app/models"
+	"github.com/alexandersmanning/simcha/app/policy"
+)
+
+// Case is a single row of a policy table
+type Case struct {
+	Name     string
+	Subject  *models.User
+	Action   string
+	Resource interface{}
+	Allowed  bool
+}
+
+// AssertTable runs every case against the engine as a subtest, reporting the decision on mismatch
+func AssertTable(t *testing.T, e *policy.Engine, cases []Case) {
+	t.Helper()
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			t.Helper()
+
+			d := e.Authorize(context.Background(), c.Subject, c.Action, c.Resource)
+			if d.Allowed != c.Allowed {
+				t.Errorf("Expected allowed to be %t, got %s", c.Allowed, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package policy
+
+import (
+	"context"
+
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+// Actions known to the application
+const (
+	PostRead    = "post.read"
+	PostReadAll = "post.read_all"
+	PostCreate  = "post.create"
+	PostUpdate  = "post.update"
+	PostDelete  = "post.delete"
+	PostRestore = "post.restore"
+	UserRead    = "user.read"
+	UserUpdate  = "user.update"
+	UserSetRole = "user.set_role"
+	UserDelete  = "user.delete"
+	UserRestore = "user.restore"
+)
+
+func init() {
+	Register(PostRead, "published", IsPublished)
+	Register(PostRead, "author", IsAuthor)
+	Register(PostRead, "admin", IsAdmin)
+	Register(PostReadAll, "admin", IsAdmin)
+	Register(PostCreate, "logged in", LoggedIn)
+	Register(PostUpdate, "author", IsAuthor)
+	Register(PostUpdate, "admin", IsAdmin)
+	Register(PostDelete, "author", IsAuthor)
+	Register(PostDelete, "admin", IsAdmin)
+	Register(PostRestore, "author", IsAuthor)
+	Register(PostRestore, "admin", IsAdmin)
+	Register(UserRead, "self", IsSelf)
+	Register(UserUpdate, "self", IsSelf)
+	Register(UserUpdate, "admin", IsAdmin)
+	Register(UserSetRole, "admin", IsAdmin)
+	Register(UserDelete, "self", IsSelf)
+	Register(UserDelete, "admin", IsAdmin)
+	Register(UserRestore, "admin", IsAdmin)
+}
+
+// LoggedIn allows any subject with an id
+func LoggedIn(ctx context.Context, subject *models.User, resource interface{}) (bool, string) {
+	if subject == nil || subject.Id == 0 {
+		return false, "subject is not logged in"
+	}
+
+	return true, "subject is logged in"
+}
+
+// IsAuthor allows the subject to act on posts they wrote
+func IsAuthor(ctx context.Context, subject *models.User, resource interface{}) (bool, string) {
+	if ok, reason := LoggedIn(ctx, subject, resource); !ok {
+		return ok, reason
+	}
+
+	post, ok := resource.(*models.Post)
+	if !ok || post == nil {
+		return false, "resource is not a post"
+	}
+
+	if subject.Id != post.Author.Id || subject.Email != post.Author.Email {
+		return false, "subject is not the author"
+	}
+
+	return true, "subject is the author"
+}
+
+// IsPublished allows any subject, including anonymous ones, to act on published posts
+func IsPublished(ctx context.Context, subject *models.User, resource interface{}) (bool, string) {
+	post, ok := resource.(*models.Post)
+	if !ok || post == nil {
+		return false, "resource is not a post"
+	}
+
+	if !post.Published() {
+		return false, "post is not published"
+	}
+
+	return true, "post is published"
+}
+
+// IsAdmin allows subjects with the admin role, whatever the resource
+func IsAdmin(ctx context.Context, subject *models.User, resource interface{}) (bool, string) {
+	if ok, reason := LoggedIn(ctx, subject, resource); !ok {
+		return ok, reason
+	}
+
+	if subject.Role != models.RoleAdmin {
+		return false, "subject is not an admin"
+	}
+
+	return true, "subject is an admin"
+}
+
+// IsSelf allows the subject to act on their own user
+func IsSelf(ctx context.Context, subject *models.User, resource interface{}) (bool, string) {
+	if ok, reason := LoggedIn(ctx, subject, resource); !ok {
+		return ok, reason
+	}
+
+	u, ok := resource.(*models.User)
+	if !ok || u == nil {
+		return false, "resource is not a user"
+	}
+
+	if subject.Id != u.Id {
+		return false, "subject is a different user"
+	}
+
+	return true, "subject is the user"
+}
@@ -0,0 +1,165 @@
+/*
+Package ratelimit throttles requests with token buckets. Buckets are kept in a
+Store, MemoryStore is used by default and a shared store can be plugged in
+when running more than one server
+*/
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limit allows Burst requests at once, refilling at Rate requests per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute creates a Limit of n requests a minute, all of which can be used at once
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// PerHour creates a Limit of n requests an hour, all of which can be used at once
+func PerHour(n int) Limit {
+	return Limit{Rate: float64(n) / 3600, Burst: n}
+}
+
+// window is the time it takes an empty bucket to refill
+func (l Limit) window() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Limit      Limit
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store holds the buckets
+type Store interface {
+	Take(key string, l Limit, now time.Time) (Result, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryStore keeps buckets in process memory
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take refills the bucket for the time since it was last used, then takes a token if one is available
+func (m *MemoryStore) Take(key string, l Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	res := Result{Limit: l}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / l.Rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(l.Burst) - b.tokens) / l.Rate)
+
+	return res, nil
+}
+
+// Sweep removes buckets that have been idle for longer than idle. As long as idle is at least the longest
+// refill window of the limits in use, the removed buckets are full and the same as a new bucket
+func (m *MemoryStore) Sweep(now time.Time, idle time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, b := range m.buckets {
+		if now.Sub(b.last) > idle {
+			delete(m.buckets, k)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// KeyFunc returns the key a request is counted against
+type KeyFunc func(r *http.Request) (string, error)
+
+// ByIP counts requests against the client address
+func ByIP(r *http.Request) (string, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host, nil
+}
+
+// Limiter applies a Limit to a named group of routes
+type Limiter struct {
+	Name  string
+	Limit Limit
+	Store Store
+	Key   KeyFunc
+	Now   func() time.Time
+}
+
+// NewLimiter creates a Limiter for a group of routes
+func NewLimiter(name string, l Limit, s Store, key KeyFunc) *Limiter {
+	return &Limiter{Name: name, Limit: l, Store: s, Key: key, Now: time.Now}
+}
+
+// Allow takes a token for the request
+func (l *Limiter) Allow(r *http.Request) (Result, error) {
+	key, err := l.Key(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return l.Store.Take(l.Name+":"+key, l.Limit, l.Now())
+}
+
+// SetHeaders writes the RateLimit headers describing the result, and Retry-After if the request was refused
+func SetHeaders(h http.Header, res Result) {
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit.Burst))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", res.Limit.Burst, ceilSeconds(res.Limit.window())))
+
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
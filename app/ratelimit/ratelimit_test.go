@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	l := PerMinute(3)
+
+	t.Run("Burst is allowed then refused", func(t *testing.T) {
+		s := NewMemoryStore()
+		for i := 2; i >= 0; i-- {
+			res, _ := s.Take("key", l, now)
+			if !res.Allowed || res.Remaining != i {
+				t.Errorf("Expected an allowed request with %d remaining, got %+v", i, res)
+			}
+		}
+
+		res, _ := s.Take("key", l, now)
+		if res.Allowed {
+			t.Error("Expected the request to be refused")
+		}
+
+		if res.RetryAfter != 20*time.Second {
+			t.Errorf("Expected to retry after 20s, got %s", res.RetryAfter)
+		}
+
+		if res.Reset != time.Minute {
+			t.Errorf("Expected a full reset after a minute, got %s", res.Reset)
+		}
+	})
+
+	t.Run("Tokens refill over time", func(t *testing.T) {
+		s := NewMemoryStore()
+		for i := 0; i < 3; i++ {
+			s.Take("key", l, now)
+		}
+
+		if res, _ := s.Take("key", l, now.Add(20*time.Second)); !res.Allowed {
+			t.Errorf("Expected a token to have refilled, got %+v", res)
+		}
+	})
+
+	t.Run("Keys have separate buckets", func(t *testing.T) {
+		s := NewMemoryStore()
+		for i := 0; i < 3; i++ {
+			s.Take("one", l, now)
+		}
+
+		if res, _ := s.Take("two", l, now); !res.Allowed {
+			t.Error("Expected a different key to be allowed")
+		}
+	})
+
+	t.Run("Sweep removes full buckets", func(t *testing.T) {
+		s := NewMemoryStore()
+		s.Take("key", l, now)
+		s.Sweep(now.Add(2*time.Minute), time.Minute)
+
+		if len(s.buckets) != 0 {
+			t.Errorf("Expected idle buckets to be removed, got %d", len(s.buckets))
+		}
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter("login", PerMinute(1), NewMemoryStore(), ByIP)
+
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	res, err := l.Allow(req)
+	if err != nil || !res.Allowed {
+		t.Fatalf("Expected the first request to be allowed, got %+v, %v", res, err)
+	}
+
+	res, _ = l.Allow(req)
+	if res.Allowed {
+		t.Fatal("Expected the second request to be refused")
+	}
+
+	h := http.Header{}
+	SetHeaders(h, res)
+
+	expected := map[string]string{
+		"RateLimit-Limit":     "1",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"RateLimit-Policy":    "1;w=60",
+		"Retry-After":         "60",
+	}
+
+	for k, v := range expected {
+		if h.Get(k) != v {
+			t.Errorf("Expected header %s to be %s, got %s", k, v, h.Get(k))
+		}
+	}
+}
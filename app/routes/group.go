@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/logging"
+	"github.com/alexandersmanning/simcha/app/middleware"
+	"github.com/alexandersmanning/simcha/app/tracing"
+)
+
+// Group registers routes under a shared path prefix and middleware
+type Group struct {
+	router *httprouter.Router
+	prefix string
+	chain  middleware.Pipeline
+}
+
+// NewGroup creates a root Group on the router
+func NewGroup(r *httprouter.Router, prefix string, mws ...middleware.Middleware) *Group {
+	return &Group{router: r, prefix: prefix, chain: middleware.Chain(mws...)}
+}
+
+// Group creates a sub group, whose routes run this group's middleware before its own
+func (g *Group) Group(prefix string, mws ...middleware.Middleware) *Group {
+	return &Group{router: g.router, prefix: g.prefix + prefix, chain: g.chain.Append(mws...)}
+}
+
+// Handle registers the handle for the method and path, wrapped in the group's middleware. The route pattern is
+// recorded on the request before any middleware runs, so it appears in the request log and names its span
+func (g *Group) Handle(method, path string, h httprouter.Handle) {
+	route := g.prefix + path
+	next := g.chain.Then(h)
+
+	g.router.Handle(method, route, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		logging.SetRoute(r.Context(), route)
+		tracing.SetRoute(r, route)
+		next(w, r, p)
+	})
+}
+
+func (g *Group) GET(path string, h httprouter.Handle) {
+	g.Handle(http.MethodGet, path, h)
+}
+
+func (g *Group) POST(path string, h httprouter.Handle) {
+	g.Handle(http.MethodPost, path, h)
+}
+
+func (g *Group) PUT(path string, h httprouter.Handle) {
+	g.Handle(http.MethodPut, path, h)
+}
+
+func (g *Group) PATCH(path string, h httprouter.Handle) {
+	g.Handle(http.MethodPatch, path, h)
+}
+
+func (g *Group) DELETE(path string, h httprouter.Handle) {
+	g.Handle(http.MethodDelete, path, h)
+}
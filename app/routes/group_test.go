@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/alexandersmanning/simcha/app/middleware"
+)
+
+func TestGroup(t *testing.T) {
+	var calls []string
+	record := func(name string) middleware.Middleware {
+		return func(next httprouter.Handle) httprouter.Handle {
+			return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+				calls = append(calls, name)
+				next(w, r, p)
+			}
+		}
+	}
+
+	r := httprouter.New()
+	root := NewGroup(r, "", record("root"))
+	posts := root.Group("/posts", record("posts"))
+	posts.GET("/:postId", func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		calls = append(calls, "handle "+p.ByName("postId"))
+	})
+	root.GET("/other", func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		calls = append(calls, "other")
+	})
+
+	t.Run("Sub groups add their prefix and middleware", func(t *testing.T) {
+		calls = nil
+		req, _ := http.NewRequest("GET", "/posts/2", nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		if expected := []string{"root", "posts", "handle 2"}; !reflect.DeepEqual(calls, expected) {
+			t.Errorf("Expected %v, got %v", expected, calls)
+		}
+	})
+
+	t.Run("Parent groups do not run sub group middleware", func(t *testing.T) {
+		calls = nil
+		req, _ := http.NewRequest("GET", "/other", nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		if expected := []string{"root", "other"}; !reflect.DeepEqual(calls, expected) {
+			t.Errorf("Expected %v, got %v", expected, calls)
+		}
+	})
+}
@@ -1,34 +1,84 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/julienschmidt/httprouter"
 
 	"github.com/alexandersmanning/simcha/app/config"
 	"github.com/alexandersmanning/simcha/app/controllers"
 	"github.com/alexandersmanning/simcha/app/middleware"
+	"github.com/alexandersmanning/simcha/app/ratelimit"
+	"github.com/alexandersmanning/simcha/app/secure"
 )
 
+// Limits are the rate limits applied to each group of routes
+var Limits = map[string]ratelimit.Limit{
+	"login":   ratelimit.PerMinute(10),
+	"signup":  ratelimit.PerHour(20),
+	"writes":  ratelimit.PerMinute(30),
+	"reads":   ratelimit.PerMinute(120),
+	"reports": ratelimit.PerMinute(10),
+}
+
 func Router(env *config.Env) *httprouter.Router {
+	store := env.RateLimits
+	if store == nil {
+		store = ratelimit.NewMemoryStore()
+	}
+
+	limit := func(name string, key ratelimit.KeyFunc) middleware.Middleware {
+		return middleware.RateLimit(env, ratelimit.NewLimiter(name, Limits[name], store, key))
+	}
+
 	r := httprouter.New()
-	r.GET("/posts", controllers.PostIndex(env))
-	r.GET("/posts/:postId", controllers.PostIndex(env))
-	r.POST("/posts", middleware.LoggedIn(
-		env, controllers.PostCreate(env)),
-	)
-	r.PUT("/posts/:postId", middleware.LoggedIn(env,
-		middleware.PostPermission(
-			env, controllers.PostUpdate(env),
-		),
-	))
-	r.DELETE("/posts/:postId", middleware.LoggedIn(env,
-		middleware.PostPermission(
-			env, controllers.PostDelete(env),
-		),
-	))
-
-	r.GET("/currentUser", controllers.CurrentUser(env))
-	r.POST("/users", controllers.UserCreate(env))
-	r.POST("/login", controllers.Login(env))
-	r.GET("/logout", controllers.Logout(env))
+	r.PanicHandler = middleware.PanicHandler
+	root := NewGroup(r, "")
+
+	// the user is loaded once for the limiter and the handle
+	reads := root.Group("", middleware.LoadUser(env), limit("reads", middleware.ByUser(env)))
+	reads.GET("/posts", controllers.PostIndex(env))
+	reads.GET("/posts/:postId", controllers.PostShow(env))
+	reads.GET("/posts/:postId/revisions", controllers.RevisionIndex(env))
+	reads.GET("/posts/:postId/revisions/:rev", controllers.RevisionShow(env))
+	reads.GET("/posts/:postId/revisions/:rev/diff", controllers.RevisionDiff(env))
+	// permalinks are not routed under /posts, where a slug such as "revisions" or "status" would match a post route
+	reads.GET("/p/:slug", controllers.PostBySlug(env))
+	reads.GET("/tags", controllers.TagIndex(env))
+	reads.GET("/currentUser", controllers.CurrentUser(env))
+	reads.Group("", middleware.LoggedIn(env)).GET("/trash", controllers.TrashIndex(env))
+
+	writes := root.Group("", middleware.LoadUser(env), limit("writes", middleware.ByUser(env)), middleware.LoggedIn(env))
+	writes.POST("/posts", controllers.PostCreate(env))
+	writes.POST("/users/2fa/enroll", controllers.TwoFactorEnroll(env))
+	writes.POST("/users/2fa/confirm", controllers.TwoFactorConfirm(env))
+	writes.POST("/users/2fa/disable", controllers.TwoFactorDisable(env))
+	writes.PATCH("/users/:userId", controllers.UserPatch(env))
+	writes.DELETE("/users/:userId", controllers.UserDelete(env))
+	writes.POST("/trash/posts/:postId/restore", controllers.TrashRestorePost(env))
+	writes.POST("/trash/users/:userId/restore", controllers.TrashRestoreUser(env))
+
+	ownPost := writes.Group("/posts/:postId", middleware.PostPermission(env))
+	ownPost.PUT("", controllers.PostUpdate(env))
+	ownPost.PATCH("", controllers.PostPatch(env))
+	ownPost.PUT("/status", controllers.PostStatus(env))
+	ownPost.DELETE("", controllers.PostDelete(env))
+	ownPost.POST("/revisions/:rev/restore", controllers.RevisionRestore(env))
+
+	root.Group("", limit("signup", ratelimit.ByIP)).POST("/users", controllers.UserCreate(env))
+
+	login := root.Group("/login", limit("login", ratelimit.ByIP))
+	login.POST("", controllers.Login(env))
+	login.POST("/2fa", controllers.TwoFactorVerify(env))
+
+	root.GET("/logout", controllers.Logout(env))
+
+	// browsers send violation reports without a login, so they are limited by address
+	reports := secure.ReportHandler()
+	root.Group("", limit("reports", ratelimit.ByIP)).POST(secure.ReportPath,
+		func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			reports.ServeHTTP(w, r)
+		})
+
 	return r
 }
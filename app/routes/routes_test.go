@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/mocks/database"
+	"github.com/alexandersmanning/simcha/app/mocks/sessions"
+	"github.com/alexandersmanning/simcha/app/models"
+)
+
+func TestRouter(t *testing.T) {
+	r := Router(&config.Env{})
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{"GET", "/posts"},
+		{"GET", "/posts/2"},
+		{"POST", "/posts"},
+		{"PUT", "/posts/2"},
+		{"PATCH", "/posts/2"},
+		{"PUT", "/posts/2/status"},
+		{"DELETE", "/posts/2"},
+		{"GET", "/posts/2/revisions"},
+		{"GET", "/posts/2/revisions/3"},
+		{"GET", "/posts/2/revisions/3/diff"},
+		{"GET", "/p/hello-world"},
+		{"POST", "/posts/2/revisions/3/restore"},
+		{"GET", "/tags"},
+		{"GET", "/currentUser"},
+		{"POST", "/users"},
+		{"PATCH", "/users/3"},
+		{"DELETE", "/users/3"},
+		{"GET", "/trash"},
+		{"POST", "/trash/posts/2/restore"},
+		{"POST", "/trash/users/3/restore"},
+		{"POST", "/login"},
+		{"POST", "/login/2fa"},
+		{"POST", "/users/2fa/enroll"},
+		{"GET", "/logout"},
+		{"POST", "/csp-report"},
+	}
+
+	for _, route := range routes {
+		if h, _, _ := r.Lookup(route.method, route.path); h == nil {
+			t.Errorf("Expected a handle for %s %s", route.method, route.path)
+		}
+	}
+}
+
+func TestRouterReports(t *testing.T) {
+	r := Router(&config.Env{})
+
+	report := func() int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/csp-report", strings.NewReader(`{"csp-report":{"violated-directive":"img-src"}}`))
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < Limits["reports"].Burst; i++ {
+		if code := report(); code != http.StatusNoContent {
+			t.Fatalf("Expected report %d to be accepted, got %d", i+1, code)
+		}
+	}
+
+	if code := report(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected reports to be rate limited, got %d", code)
+	}
+}
+
+func TestRouterPermalinks(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mockdatabase.NewMockDatastore(mockCtrl)
+	mockDB.EXPECT().WithContext(gomock.Any()).Return(mockDB).AnyTimes()
+
+	mockStore := mocksession.NewMockSessionStore(mockCtrl)
+	mockStore.EXPECT().CurrentUser(gomock.Any(), gomock.Any()).Return(&models.User{}, nil).AnyTimes()
+
+	r := Router(&config.Env{DB: mockDB, Store: mockStore})
+
+	// slugs are made from titles, so they can be any word a post route uses
+	for _, slug := range []string{"hello-world", "revisions", "status"} {
+		t.Run("The permalink of "+slug+" serves the post", func(t *testing.T) {
+			post := &models.Post{Id: 2, Slug: slug, Status: models.StatusPublished}
+			mockDB.EXPECT().GetPostBySlug(slug).Return(post, nil)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/p/"+slug, nil)
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected the post, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestRouterPanicHandler(t *testing.T) {
+	if Router(&config.Env{}).PanicHandler == nil {
+		t.Error("Expected the router to recover from panics")
+	}
+}
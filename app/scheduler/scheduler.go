@@ -0,0 +1,63 @@
+/*
+Package scheduler publishes scheduled posts once their publication time arrives
+*/
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/clock"
+)
+
+// DefaultInterval is how often scheduled posts are checked for, and the most a post is published late by
+const DefaultInterval = time.Minute
+
+// PublishStore publishes the scheduled posts whose publication time is before now, and returns how many there were
+type PublishStore interface {
+	PublishDue(now time.Time) (int64, error)
+}
+
+// Publisher checks for scheduled posts which are due at every interval of its clock
+type Publisher struct {
+	store    PublishStore
+	clock    clock.Clock
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+// NewPublisher creates a Publisher, checking every DefaultInterval when interval is not positive
+func NewPublisher(store PublishStore, c clock.Clock, interval time.Duration, logger *slog.Logger) *Publisher {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	return &Publisher{store: store, clock: c, interval: interval, logger: logger}
+}
+
+// Run publishes the posts which are due, then checks again at every interval until ctx is cancelled
+func (p *Publisher) Run(ctx context.Context) {
+	for {
+		p.PublishDue()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.clock.After(p.interval):
+		}
+	}
+}
+
+// PublishDue publishes the posts which are due now. Failures are logged, and the posts are published at the next check
+func (p *Publisher) PublishDue() {
+	n, err := p.store.PublishDue(p.clock.Now())
+	if err != nil {
+		p.logger.Error("publishing scheduled posts failed", "error", err)
+		return
+	}
+
+	if n > 0 {
+		p.logger.Info("published scheduled posts", "count", n)
+	}
+}
@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/clock/clocktest"
+)
+
+// fakeStore records the times posts were published at, and publishes one post for each
+type fakeStore struct {
+	mu    sync.Mutex
+	calls []time.Time
+	err   error
+	done  chan struct{}
+}
+
+func (s *fakeStore) PublishDue(now time.Time) (int64, error) {
+	s.mu.Lock()
+	s.calls = append(s.calls, now)
+	s.mu.Unlock()
+
+	s.done <- struct{}{}
+	return 1, s.err
+}
+
+func TestPublisher(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("It publishes at start and at every interval", func(t *testing.T) {
+		clock := clocktest.NewFake(start)
+		store := &fakeStore{done: make(chan struct{}, 1)}
+		ctx, cancel := context.WithCancel(context.Background())
+
+		stopped := make(chan struct{})
+		go func() {
+			NewPublisher(store, clock, time.Minute, logger).Run(ctx)
+			close(stopped)
+		}()
+
+		<-store.done
+		clock.BlockUntil(1)
+		clock.Advance(30 * time.Second)
+		clock.Advance(30 * time.Second)
+
+		<-store.done
+		clock.BlockUntil(1)
+		cancel()
+		<-stopped
+
+		expected := []time.Time{start, start.Add(time.Minute)}
+		if len(store.calls) != len(expected) {
+			t.Fatalf("Expected %d checks, got %v", len(expected), store.calls)
+		}
+		for i := range expected {
+			if !store.calls[i].Equal(expected[i]) {
+				t.Errorf("Expected a check at %v, got %v", expected[i], store.calls[i])
+			}
+		}
+	})
+
+	t.Run("Failures do not stop it", func(t *testing.T) {
+		clock := clocktest.NewFake(start)
+		store := &fakeStore{done: make(chan struct{}, 1), err: errors.New("database is down")}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go NewPublisher(store, clock, 0, logger).Run(ctx)
+
+		<-store.done
+		clock.BlockUntil(1)
+		clock.Advance(DefaultInterval)
+		<-store.done
+	})
+}
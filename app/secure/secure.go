@@ -0,0 +1,253 @@
+/*
+Package secure sets the security headers of every response, including a
+Content-Security-Policy with a per-request nonce, and receives the reports
+browsers send when the policy is violated
+*/
+package secure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/logging"
+)
+
+// NoncePlaceholder is replaced in the CSP by the nonce of the request
+const NoncePlaceholder = "{nonce}"
+
+// ReportPath is where browsers send CSP violation reports
+const ReportPath = "/csp-report"
+
+// DefaultCSP only allows resources from the application, and the Google fonts used by the pages in public/
+var DefaultCSP = strings.Join([]string{
+	"default-src 'self'",
+	"script-src 'self' 'nonce-" + NoncePlaceholder + "'",
+	"style-src 'self' https://fonts.googleapis.com",
+	"font-src 'self' https://fonts.gstatic.com",
+	"img-src 'self' data:",
+	"object-src 'none'",
+	"base-uri 'self'",
+	"form-action 'self'",
+	"frame-ancestors 'none'",
+}, "; ")
+
+// Options configures the headers. The zero value of a field leaves its header out, use Defaults for sane values
+type Options struct {
+	// CSP is the Content-Security-Policy, in which NoncePlaceholder is replaced by the request's nonce
+	CSP string
+	// ReportOnly sends the CSP as Content-Security-Policy-Report-Only, so violations are reported but not blocked
+	ReportOnly bool
+	// ReportURI is added to the CSP as its report-uri
+	ReportURI string
+
+	// HSTSMaxAge is sent as Strict-Transport-Security on requests made over TLS
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+
+	FrameOptions      string
+	ReferrerPolicy    string
+	PermissionsPolicy string
+	NoSniff           bool
+}
+
+// Defaults returns the options applied when nothing is configured
+func Defaults() Options {
+	return Options{
+		CSP:                   DefaultCSP,
+		ReportURI:             ReportPath,
+		HSTSMaxAge:            180 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+		PermissionsPolicy:     "camera=(), microphone=(), geolocation=()",
+		NoSniff:               true,
+	}
+}
+
+type contextKey int
+
+const nonceKey contextKey = 0
+
+// Nonce returns the CSP nonce of the request, to be set on the inline scripts of server rendered HTML
+func Nonce(ctx context.Context) string {
+	n, _ := ctx.Value(nonceKey).(string)
+	return n
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// Headers sets the security headers of every response
+func Headers(o Options, next http.Handler) http.Handler {
+	csp := o.CSP
+	if csp != "" && o.ReportURI != "" {
+		csp += "; report-uri " + o.ReportURI
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if o.ReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	hsts := ""
+	if o.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(o.HSTSMaxAge.Seconds()))
+		if o.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+
+		if csp != "" {
+			nonce := newNonce()
+			h.Set(cspHeader, strings.ReplaceAll(csp, NoncePlaceholder, nonce))
+			r = r.WithContext(context.WithValue(r.Context(), nonceKey, nonce))
+		}
+
+		// browsers ignore HSTS over plain HTTP, and sending it there would make local development awkward
+		if hsts != "" && r.TLS != nil {
+			h.Set("Strict-Transport-Security", hsts)
+		}
+
+		if o.NoSniff {
+			h.Set("X-Content-Type-Options", "nosniff")
+		}
+		if o.FrameOptions != "" {
+			h.Set("X-Frame-Options", o.FrameOptions)
+		}
+		if o.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", o.ReferrerPolicy)
+		}
+		if o.PermissionsPolicy != "" {
+			h.Set("Permissions-Policy", o.PermissionsPolicy)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Limits on the reports read and logged by ReportHandler. Reports are sent without a login, so only a few fields of
+// each are logged, cut to MaxReportField bytes, and at most MaxReportsLogged of the reports batched in one request
+const (
+	MaxReportSize    = 16 << 10
+	MaxReportField   = 256
+	MaxReportsLogged = 5
+)
+
+// violation is the part of a report which is logged
+type violation struct {
+	Document  string
+	Directive string
+	Blocked   string
+}
+
+// cspReport is the report-uri format
+type cspReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+	} `json:"csp-report"`
+}
+
+// apiReport is the Reporting API format, in which browsers batch reports in an array
+type apiReport struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedURL         string `json:"blockedURL"`
+	} `json:"body"`
+}
+
+func parseReport(body []byte) ([]violation, error) {
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		var reports []apiReport
+		if err := json.Unmarshal(body, &reports); err != nil {
+			return nil, err
+		}
+
+		var vs []violation
+		for _, r := range reports {
+			if r.Type == "csp-violation" {
+				vs = append(vs, violation{r.Body.DocumentURL, r.Body.EffectiveDirective, r.Body.BlockedURL})
+			}
+		}
+		return vs, nil
+	}
+
+	var r cspReport
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, err
+	}
+
+	directive := r.Report.EffectiveDirective
+	if directive == "" {
+		directive = r.Report.ViolatedDirective
+	}
+
+	return []violation{{r.Report.DocumentURI, directive, r.Report.BlockedURI}}, nil
+}
+
+func truncate(s string) string {
+	if len(s) > MaxReportField {
+		return s[:MaxReportField]
+	}
+
+	return s
+}
+
+// ReportHandler logs the CSP violation reports sent by browsers, in either the report-uri or the Reporting API format
+func ReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxReportSize+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(body) > MaxReportSize {
+			http.Error(w, "report too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		violations, err := parseReport(body)
+		if err != nil {
+			http.Error(w, "invalid report", http.StatusBadRequest)
+			return
+		}
+
+		logger := logging.FromContext(r.Context())
+		for i, v := range violations {
+			if i == MaxReportsLogged {
+				logger.Warn("csp violations not logged", "count", len(violations)-i)
+				break
+			}
+
+			logger.Warn("csp violation",
+				"document", truncate(v.Document),
+				"directive", truncate(v.Directive),
+				"blocked", truncate(v.Blocked),
+				"user_agent", truncate(r.UserAgent()),
+			)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
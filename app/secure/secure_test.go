@@ -0,0 +1,158 @@
+package secure
+
+import (
+	"bytes"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexandersmanning/simcha/app/logging"
+)
+
+func TestHeaders(t *testing.T) {
+	var nonce string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = Nonce(r.Context())
+	})
+
+	t.Run("The defaults set every header, with a fresh nonce in the CSP", func(t *testing.T) {
+		h := Headers(Defaults(), next)
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+		if nonce == "" {
+			t.Fatal("Expected a nonce in the request context")
+		}
+
+		csp := rr.Header().Get("Content-Security-Policy")
+		if !strings.Contains(csp, "'nonce-"+nonce+"'") || strings.Contains(csp, NoncePlaceholder) {
+			t.Errorf("Expected the nonce in the CSP, got %q", csp)
+		}
+		if !strings.Contains(csp, "report-uri "+ReportPath) {
+			t.Errorf("Expected the report uri in the CSP, got %q", csp)
+		}
+		if !strings.Contains(csp, "https://fonts.gstatic.com") {
+			t.Errorf("Expected the Google fonts to be allowed, got %q", csp)
+		}
+
+		expected := map[string]string{
+			"X-Content-Type-Options": "nosniff",
+			"X-Frame-Options":        "DENY",
+			"Referrer-Policy":        "strict-origin-when-cross-origin",
+		}
+		for name, value := range expected {
+			if got := rr.Header().Get(name); got != value {
+				t.Errorf("Expected %s to be %q, got %q", name, value, got)
+			}
+		}
+
+		if got := rr.Header().Get("Strict-Transport-Security"); got != "" {
+			t.Errorf("Expected no HSTS over plain HTTP, got %q", got)
+		}
+
+		first := nonce
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		if nonce == first {
+			t.Error("Expected each request to get its own nonce")
+		}
+	})
+
+	t.Run("HSTS is sent over TLS", func(t *testing.T) {
+		o := Defaults()
+		o.HSTSMaxAge = time.Hour
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.TLS = &tls.ConnectionState{}
+
+		rr := httptest.NewRecorder()
+		Headers(o, next).ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Strict-Transport-Security"); got != "max-age=3600; includeSubDomains" {
+			t.Errorf("Unexpected HSTS header %q", got)
+		}
+	})
+
+	t.Run("Report only mode does not enforce the policy", func(t *testing.T) {
+		o := Defaults()
+		o.ReportOnly = true
+
+		rr := httptest.NewRecorder()
+		Headers(o, next).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+		if rr.Header().Get("Content-Security-Policy") != "" {
+			t.Error("Expected no enforced CSP")
+		}
+		if rr.Header().Get("Content-Security-Policy-Report-Only") == "" {
+			t.Error("Expected a report only CSP")
+		}
+	})
+
+	t.Run("Without a CSP there is no nonce", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		Headers(Options{}, next).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+		if nonce != "" || rr.Header().Get("Content-Security-Policy") != "" {
+			t.Errorf("Expected no CSP, got nonce %q", nonce)
+		}
+	})
+}
+
+func TestReportHandler(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", ReportPath, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/csp-report")
+		req = req.WithContext(logging.WithLogger(req.Context(), logger))
+
+		rr := httptest.NewRecorder()
+		ReportHandler().ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Reports are logged", func(t *testing.T) {
+		rr := serve(`{"csp-report":{"document-uri":"https://simcha.dev/","violated-directive":"script-src"}}`)
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+		}
+		if !strings.Contains(logs.String(), "csp violation") || !strings.Contains(logs.String(), "script-src") {
+			t.Errorf("Expected the violation to be logged, got %s", logs.String())
+		}
+	})
+
+	t.Run("Only a few fields of a few reports are logged", func(t *testing.T) {
+		logs.Reset()
+		long := strings.Repeat("a", 2*MaxReportField)
+		report := `{"type":"csp-violation","body":{"documentURL":"https://simcha.dev/` + long + `","effectiveDirective":"img-src","sample":"secret"}}`
+		rr := serve("[" + strings.Repeat(report+",", MaxReportsLogged) + report + "]")
+
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status %d, got %d", http.StatusNoContent, rr.Code)
+		}
+		if n := strings.Count(logs.String(), `"msg":"csp violation"`); n != MaxReportsLogged {
+			t.Errorf("Expected %d reports to be logged, got %d", MaxReportsLogged, n)
+		}
+		if strings.Contains(logs.String(), "secret") || strings.Contains(logs.String(), long) {
+			t.Errorf("Expected the reports to be cut down, got %s", logs.String())
+		}
+	})
+
+	t.Run("Large reports are rejected", func(t *testing.T) {
+		if rr := serve(`{"csp-report":{"document-uri":"` + strings.Repeat("a", MaxReportSize) + `"}}`); rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+		}
+	})
+
+	t.Run("Invalid reports are rejected", func(t *testing.T) {
+		if rr := serve("not json"); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+/*
+Package server runs the HTTP server with production timeouts, and shuts it
+down gracefully once its context is cancelled
+*/
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Settings for every server created with New
+var (
+	ReadHeaderTimeout = 5 * time.Second
+	ReadTimeout       = 15 * time.Second
+	WriteTimeout      = 30 * time.Second
+	IdleTimeout       = 2 * time.Minute
+	MaxHeaderBytes    = 64 << 10
+)
+
+// New creates a server for the handler with the package's timeouts and header limit
+func New(addr string, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+		ReadTimeout:       ReadTimeout,
+		WriteTimeout:      WriteTimeout,
+		IdleTimeout:       IdleTimeout,
+		MaxHeaderBytes:    MaxHeaderBytes,
+	}
+}
+
+// Run serves until ctx is cancelled, then stops accepting connections and waits up to grace for in-flight requests
+// to finish. Functions registered with RegisterOnShutdown run as soon as the shutdown starts. The server speaks TLS
+// when its TLSConfig is set
+func Run(ctx context.Context, srv *http.Server, grace time.Duration) error {
+	l, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	if srv.TLSConfig != nil {
+		l = tls.NewListener(l, srv.TLSConfig)
+	}
+
+	return Serve(ctx, srv, l, grace)
+}
+
+// Serve is Run with a listener which is already open
+func Serve(ctx context.Context, srv *http.Server, l net.Listener, grace time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return err
+	}
+
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Drain returns a context cancelled delay after ctx. When ctx is cancelled, before is called at once, so the server
+// can report it is not ready and load balancers stop sending it requests before Run stops accepting them
+func Drain(ctx context.Context, delay time.Duration, before func()) context.Context {
+	drained, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+
+		<-ctx.Done()
+		before()
+
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		<-t.C
+	}()
+
+	return drained
+}
+
+// Every calls f every interval until ctx is cancelled. Workers are tracked by wg, so shutdown can wait for them
+func Every(ctx context.Context, wg *sync.WaitGroup, interval time.Duration, f func(now time.Time)) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				f(now)
+			}
+		}
+	}()
+}
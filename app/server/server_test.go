@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	srv := New("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	}))
+
+	shutdown := make(chan struct{})
+	srv.RegisterOnShutdown(func() { close(shutdown) })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- Serve(ctx, srv, l, time.Second) }()
+
+	resp := make(chan *http.Response, 1)
+	go func() {
+		res, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			t.Error(err)
+		}
+		resp <- res
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("Expected the server to wait for the in-flight request, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if res := <-resp; res == nil || res.StatusCode != http.StatusOK {
+		t.Errorf("Expected the in-flight request to complete, got %v", res)
+	}
+
+	if err := <-errs; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+
+	select {
+	case <-shutdown:
+	case <-time.After(time.Second):
+		t.Error("Expected the shutdown hooks to run")
+	}
+}
+
+func TestNew(t *testing.T) {
+	srv := New(":0", nil)
+	if srv.ReadTimeout == 0 || srv.WriteTimeout == 0 || srv.IdleTimeout == 0 || srv.MaxHeaderBytes == 0 {
+		t.Errorf("Expected production timeouts, got %+v", srv)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := make(chan struct{})
+	drainCtx := Drain(ctx, 50*time.Millisecond, func() { close(drained) })
+
+	cancel()
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("Expected before to be called once ctx is cancelled")
+	}
+
+	if drainCtx.Err() != nil {
+		t.Error("Expected the server to keep serving while it drains")
+	}
+
+	select {
+	case <-drainCtx.Done():
+	case <-time.After(time.Second):
+		t.Error("Expected the context to be cancelled after the delay")
+	}
+}
+
+func TestEvery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	calls := make(chan time.Time, 10)
+	Every(ctx, &wg, time.Millisecond, func(now time.Time) { calls <- now })
+
+	<-calls
+	cancel()
+	wg.Wait()
+}
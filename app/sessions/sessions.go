@@ -1,17 +1,25 @@
 package sessions
 
 import (
+	"context"
 	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/logging"
 	"github.com/alexandersmanning/simcha/app/models"
 	"github.com/gorilla/sessions"
 	"net/http"
+	"time"
 )
 
+// TwoFactorTimeout is how long a user has to enter their code after a successful password check
+var TwoFactorTimeout = 5 * time.Minute
+
 type SessionStore interface {
 	CurrentUser(db database.Datastore, r *http.Request) (*models.User, error)
 	Login(u *models.User, db database.Datastore, w http.ResponseWriter, r *http.Request) error
 	IsLoggedIn(db database.Datastore, r *http.Request) (bool, error)
 	Logout(db database.Datastore, w http.ResponseWriter, r *http.Request) error
+	BeginTwoFactor(u *models.User, w http.ResponseWriter, r *http.Request) error
+	PendingTwoFactor(r *http.Request) (int, error)
 }
 
 type Session struct {
@@ -36,6 +44,8 @@ func (s *Session) Login(u *models.User, db database.Datastore, w http.ResponseWr
 
 	session.Values["id"] = u.Id
 	session.Values["token"] = us.SessionToken
+	delete(session.Values, "pending_id")
+	delete(session.Values, "pending_expires")
 
 	if err := session.Save(r, w); err != nil {
 		return err
@@ -69,6 +79,36 @@ func (s *Session) Logout(db database.Datastore, w http.ResponseWriter, r *http.R
 	return db.RemoveSessionToken(currentId, currentToken)
 }
 
+// BeginTwoFactor records a user who has passed the password check but still needs to provide a code
+func (s *Session) BeginTwoFactor(u *models.User, w http.ResponseWriter, r *http.Request) error {
+	session, err := s.Get(r, "session")
+	if err != nil {
+		return err
+	}
+
+	session.Values["pending_id"] = u.Id
+	session.Values["pending_expires"] = time.Now().Add(TwoFactorTimeout).Unix()
+
+	return session.Save(r, w)
+}
+
+// PendingTwoFactor returns the id of the user waiting on a code, or 0 if there is none or it has expired
+func (s *Session) PendingTwoFactor(r *http.Request) (int, error) {
+	session, err := s.Get(r, "session")
+	if err != nil {
+		return 0, err
+	}
+
+	id, _ := session.Values["pending_id"].(int)
+	expires, _ := session.Values["pending_expires"].(int64)
+
+	if id == 0 || time.Now().Unix() > expires {
+		return 0, nil
+	}
+
+	return id, nil
+}
+
 func (s *Session) IsLoggedIn(db database.Datastore, r *http.Request) (bool, error) {
 	u, err := s.CurrentUser(db, r)
 
@@ -83,7 +123,14 @@ func (s *Session) IsLoggedIn(db database.Datastore, r *http.Request) (bool, erro
 	return true, nil
 }
 
+//CurrentUser returns the logged in user, or an empty user for anonymous requests. The user stored by WithUser is
+//returned without looking the session up again
 func (s *Session) CurrentUser(db database.Datastore, r *http.Request) (*models.User, error) {
+	if loaded, ok := UserFromContext(r.Context()); ok {
+		u := *loaded
+		return &u, nil
+	}
+
 	var u models.User
 
 	id, token, err := getSessionValues(s, r)
@@ -97,9 +144,27 @@ func (s *Session) CurrentUser(db database.Datastore, r *http.Request) (*models.U
 	}
 
 	u, err = db.GetUserBySessionToken(id, token)
+	if err == nil {
+		logging.SetUserID(r.Context(), u.Id)
+	}
+
 	return &u, err
 }
 
+type userKey struct{}
+
+//WithUser returns a copy of the request carrying the user loaded for it, so the middleware and handle it goes through
+//share a single session lookup
+func WithUser(r *http.Request, u *models.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, u))
+}
+
+//UserFromContext returns the user stored by WithUser, if any
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	u, ok := ctx.Value(userKey{}).(*models.User)
+	return u, ok
+}
+
 func getSessionValues(s *Session, r *http.Request) (int, string, error) {
 	session, err := s.Get(r, "session")
 
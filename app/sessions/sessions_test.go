@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestMain(m *testing.M) {
@@ -112,6 +113,38 @@ func TestLogin(t *testing.T) {
 
 }
 
+func TestCurrentUser(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+
+	req, _ := http.NewRequest("GET", "/posts", nil)
+	setLoginCredentials(t, req, 200, "fake_token")
+
+	t.Run("The session is looked up", func(t *testing.T) {
+		mockDatastore.EXPECT().GetUserBySessionToken(200, "fake_token").Return(models.User{Id: 200}, nil)
+
+		if u, err := session.CurrentUser(mockDatastore, req); err != nil || u.Id != 200 {
+			t.Errorf("Expected the logged in user, got %v, %v", u, err)
+		}
+	})
+
+	t.Run("A user already loaded for the request is reused", func(t *testing.T) {
+		mockDatastore.EXPECT().GetUserBySessionToken(gomock.Any(), gomock.Any()).Times(0)
+
+		loaded := WithUser(req, &models.User{Id: 200})
+		u, err := session.CurrentUser(mockDatastore, loaded)
+		if err != nil || u.Id != 200 {
+			t.Errorf("Expected the loaded user, got %v, %v", u, err)
+		}
+
+		if again, _ := session.CurrentUser(mockDatastore, loaded); again == u {
+			t.Error("Expected each caller to get its own copy")
+		}
+	})
+}
+
 func TestLogout(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/logout", nil)
 	rec := httptest.NewRecorder()
@@ -175,3 +208,67 @@ func TestLogout(t *testing.T) {
 		}
 	})
 }
+
+func TestTwoFactor(t *testing.T) {
+	u := models.User{Id: 300}
+
+	t.Run("Pending user is returned before it expires", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/login", nil)
+		rec := httptest.NewRecorder()
+
+		if err := session.BeginTwoFactor(&u, rec, req); err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := session.PendingTwoFactor(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if id != u.Id {
+			t.Errorf("Expected pending id %d, got %d", u.Id, id)
+		}
+	})
+
+	t.Run("Expired pending users are ignored", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/login", nil)
+		rec := httptest.NewRecorder()
+
+		if err := session.BeginTwoFactor(&u, rec, req); err != nil {
+			t.Fatal(err)
+		}
+
+		sessions, err := session.Get(req, "session")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions.Values["pending_expires"] = time.Now().Add(-time.Minute).Unix()
+
+		if id, _ := session.PendingTwoFactor(req); id != 0 {
+			t.Errorf("Expected no pending user, got %d", id)
+		}
+	})
+
+	t.Run("Logging in clears the pending user", func(t *testing.T) {
+		req, _ := http.NewRequest("POST", "/login", nil)
+		rec := httptest.NewRecorder()
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDatastore := mockdatabase.NewMockDatastore(mockCtrl)
+		mockDatastore.EXPECT().CreateUserSession(&u).Return(models.UserSession{SessionToken: "fake_token"}, nil)
+
+		if err := session.BeginTwoFactor(&u, rec, req); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := session.Login(&u, mockDatastore, rec, req); err != nil {
+			t.Fatal(err)
+		}
+
+		if id, _ := session.PendingTwoFactor(req); id != 0 {
+			t.Errorf("Expected no pending user after login, got %d", id)
+		}
+	})
+}
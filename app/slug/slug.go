@@ -0,0 +1,126 @@
+/*
+Package slug makes the URL safe names of posts from their titles, and of tags.
+
+Slugs are lowercase ASCII words joined by hyphens. Accented Latin, Cyrillic and
+Greek letters are transliterated, and other characters separate words. When a
+slug is taken, a numeric suffix is added: hello-world, hello-world-2, and so on.
+*/
+package slug
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxLength is the longest slug made from a title, before any suffix is added
+const MaxLength = 80
+
+// Fallback is the slug of posts whose titles make an empty slug
+const Fallback = "post"
+
+// Make transliterates the title and joins its words with hyphens, cutting it at a word boundary after MaxLength. The
+// slug is empty when the title has no letter or digit which can be transliterated
+func Make(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range title {
+		word, ok := transliterate(unicode.ToLower(r))
+		if !ok {
+			hyphen = true
+			continue
+		}
+		if word == "" {
+			continue
+		}
+
+		if hyphen && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		hyphen = false
+		b.WriteString(word)
+	}
+
+	s := b.String()
+	if len(s) > MaxLength {
+		s = s[:MaxLength+1]
+		if i := strings.LastIndexByte(s, '-'); i > 0 {
+			s = s[:i]
+		} else {
+			s = s[:MaxLength]
+		}
+	}
+
+	return s
+}
+
+// Unique returns base, or base with the lowest suffix from 2 up, which is not taken
+func Unique(base string, taken func(slug string) bool) string {
+	if !taken(base) {
+		return base
+	}
+
+	for n := 2; ; n++ {
+		if s := base + "-" + strconv.Itoa(n); !taken(s) {
+			return s
+		}
+	}
+}
+
+// HasBase reports whether s is base, or base with a suffix added by Unique
+func HasBase(s, base string) bool {
+	if s == base {
+		return true
+	}
+
+	suffix, ok := strings.CutPrefix(s, base+"-")
+	if !ok {
+		return false
+	}
+
+	n, err := strconv.Atoi(suffix)
+	return err == nil && n >= 2 && strconv.Itoa(n) == suffix
+}
+
+// transliterate returns the ASCII letters or digits standing for r, which may be none for silent letters, or false when
+// r separates words
+func transliterate(r rune) (string, bool) {
+	switch {
+	case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		return string(r), true
+	case r < 0x80:
+		return "", false
+	}
+
+	s, ok := letters[r]
+	return s, ok
+}
+
+// letters transliterates lowercase accented Latin, Cyrillic and Greek letters. The Cyrillic hard and soft signs are
+// silent
+var letters = map[rune]string{
+	// Latin-1 Supplement and Latin Extended-A
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g", 'ĥ': "h", 'ħ': "h",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'ĳ': "ij", 'ĵ': "j", 'ķ': "k", 'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n", 'ŋ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ŏ': "o", 'ő': "o",
+	'œ': "oe", 'ŕ': "r", 'ŗ': "r", 'ř': "r", 'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ß': "ss",
+	'ţ': "t", 'ť': "t", 'ŧ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ŵ': "w", 'ý': "y", 'ÿ': "y", 'ŷ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'ґ': "g", 'д': "d", 'е': "e", 'ё': "e", 'є': "ye",
+	'ж': "zh", 'з': "z", 'и': "i", 'і': "i", 'ї': "yi", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh",
+	'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+	// Greek
+	'α': "a", 'ά': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'έ': "e", 'ζ': "z", 'η': "i",
+	'ή': "i", 'θ': "th", 'ι': "i", 'ί': "i", 'ϊ': "i", 'ΐ': "i", 'κ': "k", 'λ': "l", 'μ': "m",
+	'ν': "n", 'ξ': "x", 'ο': "o", 'ό': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t",
+	'υ': "y", 'ύ': "y", 'ϋ': "y", 'ΰ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o", 'ώ': "o",
+}
@@ -0,0 +1,73 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		title string
+		slug  string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Go 1.23 -- what's new?  ", "go-1-23-what-s-new"},
+		{"Crème Brûlée à la Française", "creme-brulee-a-la-francaise"},
+		{"Straße über Ærø", "strasse-uber-aero"},
+		{"Объект в Москве", "obekt-v-moskve"},
+		{"Καλημέρα κόσμε", "kalimera-kosme"},
+		{"日本語", ""},
+		{"", ""},
+		{"日本語 and English", "and-english"},
+	}
+
+	for _, test := range tests {
+		if got := Make(test.title); got != test.slug {
+			t.Errorf("Make(%q) = %q, expected %q", test.title, got, test.slug)
+		}
+	}
+
+	t.Run("Long titles are cut between words", func(t *testing.T) {
+		got := Make(strings.Repeat("word ", 30))
+		if len(got) > MaxLength || strings.HasSuffix(got, "-") || !strings.HasSuffix(got, "word") {
+			t.Errorf("Expected whole words within %d characters, got %q", MaxLength, got)
+		}
+
+		if got := Make(strings.Repeat("a", 100)); len(got) != MaxLength {
+			t.Errorf("Expected a single long word to be cut at %d characters, got %d", MaxLength, len(got))
+		}
+	})
+}
+
+func TestUnique(t *testing.T) {
+	taken := map[string]bool{"hello": true, "hello-2": true, "hello-4": true}
+	isTaken := func(s string) bool { return taken[s] }
+
+	if got := Unique("world", isTaken); got != "world" {
+		t.Errorf("Expected a free slug to be kept, got %q", got)
+	}
+
+	if got := Unique("hello", isTaken); got != "hello-3" {
+		t.Errorf("Expected the lowest free suffix, got %q", got)
+	}
+}
+
+func TestHasBase(t *testing.T) {
+	tests := []struct {
+		s, base string
+		ok      bool
+	}{
+		{"hello", "hello", true},
+		{"hello-3", "hello", true},
+		{"hello-1", "hello", false},
+		{"hello-03", "hello", false},
+		{"hello-world", "hello", false},
+		{"hello", "hello-3", false},
+	}
+
+	for _, test := range tests {
+		if got := HasBase(test.s, test.base); got != test.ok {
+			t.Errorf("HasBase(%q, %q) = %v, expected %v", test.s, test.base, got, test.ok)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHOTP(t *testing.T) {
+	// Test vectors from RFC 6238 Appendix B, SHA1 variant
+	key := []byte("12345678901234567890")
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, v := range vectors {
+		if code := hotp(key, counter(time.Unix(v.unix, 0)), 8); code != v.code {
+			t.Errorf("Expected %s at %d, got %s", v.code, v.unix, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1500000000, 0)
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Current code is valid", func(t *testing.T) {
+		if !Validate(secret, code, now) {
+			t.Error("Expected the code to be valid")
+		}
+	})
+
+	t.Run("Code from the previous period is valid", func(t *testing.T) {
+		if !Validate(secret, code, now.Add(Period)) {
+			t.Error("Expected the code to be valid within the skew")
+		}
+	})
+
+	t.Run("Old codes are rejected", func(t *testing.T) {
+		if Validate(secret, code, now.Add(3*Period)) {
+			t.Error("Expected the code to be rejected")
+		}
+	})
+
+	t.Run("Step is the period the code was generated for", func(t *testing.T) {
+		step, ok := Step(secret, code, now.Add(Period))
+		if !ok || step != int64(counter(now)) {
+			t.Errorf("Expected step %d, got %d, %t", counter(now), step, ok)
+		}
+	})
+
+	t.Run("Malformed codes are rejected", func(t *testing.T) {
+		if Validate(secret, "12", now) || Validate("not base32!", code, now) {
+			t.Error("Expected malformed input to be rejected")
+		}
+	})
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("simcha", "email@fake.com", "JBSWY3DPEHPK3PXP")
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("Expected an otpauth totp uri, got %s", uri)
+	}
+
+	if u.Path != "/simcha:email@fake.com" {
+		t.Errorf("Expected the label to contain issuer and account, got %s", u.Path)
+	}
+
+	if s := u.Query().Get("secret"); s != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Expected the secret in the query, got %s", s)
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(codes) != 10 {
+		t.Fatalf("Expected 10 codes, got %d", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if len(c) != 11 || strings.Index(c, "-") != 5 {
+			t.Errorf("Expected a code formatted as xxxxx-xxxxx, got %s", c)
+		}
+
+		if seen[c] {
+			t.Errorf("Expected unique codes, got %s twice", c)
+		}
+		seen[c] = true
+	}
+}
@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+// statusRecorder captures the status of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Handler starts a span for every request, continuing the trace of a valid traceparent header. The span is named
+// after the method until the matched route renames it, see SetRoute
+func Handler(t *Tracer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, err := ParseTraceparent(r.Header.Get(TraceparentHeader)); err == nil {
+			ctx = WithRemoteParent(ctx, sc)
+		}
+
+		ctx, span := t.Start(ctx, "HTTP "+r.Method)
+		defer span.End()
+
+		span.SetAttr("http.method", r.Method)
+		span.SetAttr("http.target", r.URL.Path)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttr("http.status_code", rec.status)
+		if rec.status >= 500 {
+			span.RecordError(errServer(rec.status))
+		}
+	})
+}
+
+type errServer int
+
+func (e errServer) Error() string {
+	return http.StatusText(int(e))
+}
+
+// SetRoute names the request's span after the route pattern that matched it
+func SetRoute(r *http.Request, route string) {
+	span := SpanFromContext(r.Context())
+	span.SetName("HTTP " + r.Method + " " + route)
+	span.SetAttr("http.route", route)
+}
+
+// Inject sets the traceparent header of an outgoing request to continue the current trace
+func Inject(r *http.Request) {
+	if span := SpanFromContext(r.Context()); span != nil {
+		r.Header.Set(TraceparentHeader, span.Context().Traceparent())
+	}
+}
@@ -0,0 +1,306 @@
+/*
+Package tracing records spans for requests and database calls, propagates them
+with the W3C traceparent header, and hands finished spans to a pluggable Exporter
+*/
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader carries the trace between services, see https://www.w3.org/TR/trace-context/
+const TraceparentHeader = "traceparent"
+
+// TraceID identifies every span of a trace
+type TraceID [16]byte
+
+// SpanID identifies a single span
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether the ID is not all zeros
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether the ID is not all zeros
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span that is propagated to its children
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats the span context as a traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+var errInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent reads a traceparent header value. Versions other than 00 are read as 00, as the spec requires
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, errInvalidTraceparent
+	}
+
+	if _, err := hex.Decode(make([]byte, 1), []byte(parts[0])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errInvalidTraceparent
+	}
+
+	flags := make([]byte, 1)
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(flags, []byte(parts[3])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+
+	if !sc.IsValid() {
+		return sc, errInvalidTraceparent
+	}
+
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// Attr is a key value pair describing a span
+type Attr struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// SpanData is a finished span, as given to the Exporter
+type SpanData struct {
+	Name       string    `json:"name"`
+	TraceID    string    `json:"traceId"`
+	SpanID     string    `json:"spanId"`
+	ParentID   string    `json:"parentId,omitempty"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Duration   float64   `json:"durationMs"`
+	Attributes []Attr    `json:"attributes,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Span is an operation being timed. All methods are safe to call on a nil Span
+type Span struct {
+	tracer *Tracer
+
+	mu     sync.Mutex
+	ended  bool
+	ctx    SpanContext
+	parent SpanID
+	name   string
+	start  time.Time
+	attrs  []Attr
+	err    string
+}
+
+// Context returns the span context propagated to children of the span
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.ctx
+}
+
+// SetName replaces the name the span was started with
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttr adds an attribute to the span
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.attrs = append(s.attrs, Attr{Key: key, Value: value})
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span, and exports it if it is sampled. Only the first call has any effect
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+
+	end := s.tracer.now()
+	data := &SpanData{
+		Name:       s.name,
+		TraceID:    s.ctx.TraceID.String(),
+		SpanID:     s.ctx.SpanID.String(),
+		Start:      s.start,
+		End:        end,
+		Duration:   float64(end.Sub(s.start)) / float64(time.Millisecond),
+		Attributes: s.attrs,
+		Error:      s.err,
+	}
+	if s.parent.IsValid() {
+		data.ParentID = s.parent.String()
+	}
+	s.mu.Unlock()
+
+	if s.ctx.Sampled {
+		s.tracer.export(data)
+	}
+}
+
+// Exporter receives every finished, sampled span
+type Exporter interface {
+	ExportSpan(s *SpanData) error
+}
+
+// Tracer starts spans and sends them to its Exporter. Without an Exporter spans are still created, so trace IDs
+// are propagated and logged, but they are not recorded anywhere
+type Tracer struct {
+	mu       sync.RWMutex
+	exporter Exporter
+	Now      func() time.Time
+}
+
+// NewTracer creates a Tracer exporting to e, which may be nil
+func NewTracer(e Exporter) *Tracer {
+	return &Tracer{exporter: e, Now: time.Now}
+}
+
+// Default is the tracer used by the package level functions
+var Default = NewTracer(nil)
+
+// SetExporter replaces the exporter of the tracer
+func (t *Tracer) SetExporter(e Exporter) {
+	t.mu.Lock()
+	t.exporter = e
+	t.mu.Unlock()
+}
+
+func (t *Tracer) now() time.Time {
+	if t.Now == nil {
+		return time.Now()
+	}
+
+	return t.Now()
+}
+
+func (t *Tracer) export(s *SpanData) {
+	t.mu.RLock()
+	e := t.exporter
+	t.mu.RUnlock()
+
+	if e != nil {
+		e.ExportSpan(s)
+	}
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// Start starts a span as a child of the span in ctx, or of a remote parent set with WithRemoteParent, or as the
+// root of a new trace. The returned context carries the new span
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s := &Span{tracer: t, name: name, start: t.now()}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.ctx, s.parent = parent.ctx, parent.ctx.SpanID
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok && remote.IsValid() {
+		s.ctx, s.parent = remote, remote.SpanID
+	} else {
+		rand.Read(s.ctx.TraceID[:])
+		s.ctx.Sampled = true
+	}
+	rand.Read(s.ctx.SpanID[:])
+
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// Start starts a span with the Default tracer
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return Default.Start(ctx, name)
+}
+
+// SpanFromContext returns the current span, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// TraceIDFromContext returns the ID of the current trace, or an empty string
+func TraceIDFromContext(ctx context.Context) string {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.ctx.TraceID.String()
+	}
+
+	return ""
+}
+
+// WithRemoteParent returns a context whose next span continues the trace of sc
+func WithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
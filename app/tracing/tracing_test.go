@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type recordingExporter struct {
+	spans []*SpanData
+}
+
+func (e *recordingExporter) ExportSpan(s *SpanData) error {
+	e.spans = append(e.spans, s)
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	valid := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceparent(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("Unexpected span context %+v", sc)
+	}
+
+	if sc.Traceparent() != valid {
+		t.Errorf("Expected %s to round trip, got %s", valid, sc.Traceparent())
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+
+	for _, s := range invalid {
+		if _, err := ParseTraceparent(s); err == nil {
+			t.Errorf("Expected %q to be invalid", s)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	e := &recordingExporter{}
+	tracer := NewTracer(e)
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttr("db.statement", "SELECT 1")
+	child.RecordError(errors.New("failed"))
+	child.End()
+	root.End()
+	root.End()
+
+	if len(e.spans) != 2 {
+		t.Fatalf("Expected each span to be exported once, got %d", len(e.spans))
+	}
+
+	c, r := e.spans[0], e.spans[1]
+	if c.TraceID != r.TraceID || c.ParentID != r.SpanID || r.ParentID != "" {
+		t.Errorf("Expected child to belong to the root, got %+v and %+v", c, r)
+	}
+
+	if c.Error != "failed" || len(c.Attributes) != 1 {
+		t.Errorf("Expected the error and attribute to be recorded, got %+v", c)
+	}
+
+	t.Run("Unsampled remote parents are not exported", func(t *testing.T) {
+		e.spans = nil
+		sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		_, span := tracer.Start(WithRemoteParent(context.Background(), sc), "remote")
+		span.End()
+
+		if span.Context().TraceID != sc.TraceID || len(e.spans) != 0 {
+			t.Errorf("Expected the trace to continue without being exported, got %+v", e.spans)
+		}
+	})
+
+	t.Run("Nil spans are safe", func(t *testing.T) {
+		var s *Span
+		s.SetName("name")
+		s.SetAttr("key", "value")
+		s.RecordError(errors.New("error"))
+		s.End()
+	})
+}
+
+func TestHandler(t *testing.T) {
+	e := &recordingExporter{}
+	tracer := NewTracer(e)
+
+	h := Handler(tracer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r, "/posts/:postId")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest("GET", "/posts/2", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(e.spans) != 1 {
+		t.Fatalf("Expected one span, got %d", len(e.spans))
+	}
+
+	s := e.spans[0]
+	if s.Name != "HTTP GET /posts/:postId" {
+		t.Errorf("Expected the span to be named after the route, got %s", s.Name)
+	}
+
+	if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("Expected the incoming trace to continue, got %+v", s)
+	}
+
+	if s.Error != "Internal Server Error" {
+		t.Errorf("Expected a 500 to mark the span as failed, got %q", s.Error)
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(NewWriterExporter(&buf))
+
+	_, span := tracer.Start(context.Background(), "DB.AllPosts")
+	span.End()
+
+	var data SpanData
+	if err := json.Unmarshal([]byte(strings.TrimSpace(buf.String())), &data); err != nil {
+		t.Fatalf("Expected a line of JSON, got %s", buf.String())
+	}
+
+	if data.Name != "DB.AllPosts" || data.TraceID != span.Context().TraceID.String() {
+		t.Errorf("Unexpected span %+v", data)
+	}
+}
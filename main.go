@@ -1,66 +1,377 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/gorilla/csrf"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/alexandersmanning/simcha/app/certs"
+	"github.com/alexandersmanning/simcha/app/cli"
+	"github.com/alexandersmanning/simcha/app/clock"
+	"github.com/alexandersmanning/simcha/app/compress"
 	"github.com/alexandersmanning/simcha/app/config"
+	"github.com/alexandersmanning/simcha/app/cors"
 	"github.com/alexandersmanning/simcha/app/database"
+	"github.com/alexandersmanning/simcha/app/health"
+	"github.com/alexandersmanning/simcha/app/lockout"
+	"github.com/alexandersmanning/simcha/app/logging"
+	"github.com/alexandersmanning/simcha/app/mailer"
+	"github.com/alexandersmanning/simcha/app/metrics"
+	"github.com/alexandersmanning/simcha/app/ratelimit"
 	"github.com/alexandersmanning/simcha/app/routes"
+	"github.com/alexandersmanning/simcha/app/scheduler"
+	"github.com/alexandersmanning/simcha/app/secure"
+	"github.com/alexandersmanning/simcha/app/server"
 	"github.com/alexandersmanning/simcha/app/sessions"
+	"github.com/alexandersmanning/simcha/app/tracing"
 
 	"github.com/joho/godotenv"
 	"github.com/julienschmidt/httprouter"
 )
 
 func main() {
-	if err := godotenv.Load(); err != nil {
-		panic(err)
+	// .env is optional, the settings may come from the environment, a config file or flags instead
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(cli.ExitError)
 	}
 
-	db, err := database.InitDB(os.Getenv("DB_CONNECTION"))
+	// without a command, or with only flags, the binary serves as it always has
+	args := os.Args[1:]
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" && args[0] != "--help") {
+		args = append([]string{"serve"}, args...)
+	}
 
-	defer db.Close()
+	tool := &cli.Tool{Open: openStore}
+	root := &cli.Command{
+		Name: "simcha",
+		Help: "simcha serves the API, and manages its database.\n" +
+			"The database commands read DB_CONNECTION from the environment, .env or CONFIG_FILE.",
+		Subcommands: append([]*cli.Command{{
+			Name:    "serve",
+			Summary: "Run the HTTP server",
+			Help:    "Runs the HTTP server, applying pending migrations first. Flags override the environment and CONFIG_FILE.",
+			Run:     serve,
+		}}, tool.Commands()...),
+	}
+
+	os.Exit(cli.Execute(root, args, os.Stdout, os.Stderr))
+}
+
+// openStore connects to the database for the commands other than serve, which only need DB_CONNECTION
+func openStore() (cli.Store, error) {
+	cfg, err := config.Read(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.DBConnection == "" {
+		return nil, errors.New("DB_CONNECTION is required")
+	}
+
+	return database.InitDB(cfg.DBConnection)
+}
+
+func serve(c *cli.Command, args []string) error {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	level, _ := cfg.Level()
+	logger, err := logging.New(os.Stdout, cfg.LogFormat, level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		var dump strings.Builder
+		cfg.Dump(&dump)
+		logger.Debug("configuration", "config", dump.String())
+	}
+
+	// TRACE_EXPORT is either stdout, or the path of a file spans are appended to
+	switch export := cfg.TraceExport; export {
+	case "":
+	case "stdout":
+		tracing.Default.SetExporter(tracing.NewWriterExporter(os.Stdout))
+	default:
+		exporter, err := tracing.NewFileExporter(export)
+		if err != nil {
+			return err
+		}
+		defer exporter.Close()
+		tracing.Default.SetExporter(exporter)
+	}
 
+	grace := cfg.ShutdownGrace
+
+	db, err := database.InitDB(cfg.DBConnection)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer db.Close()
+
+	if err := db.Migrate(); err != nil {
+		return err
 	}
 
-	store := sessions.InitStore(os.Getenv("APPLICATION_SECRET"))
+	store := sessions.InitStore(cfg.ApplicationSecret)
+	// cookies are only sent back over TLS when the server speaks it
+	store.Options.Secure = cfg.TLS()
+
+	// ctx is cancelled on SIGINT or SIGTERM, which stops the server and every background worker
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	var workers sync.WaitGroup
+
+	// deferred calls run in reverse, so the workers are stopped and waited for before the database is closed
+	defer workers.Wait()
+	defer stop()
+
+	lockoutStore := lockout.NewMemoryStore(time.Hour)
+	server.Every(ctx, &workers, 10*time.Minute, lockoutStore.Sweep)
 
-	env := &config.Env{DB: db, Store: store}
+	rateLimits := ratelimit.NewMemoryStore()
+	server.Every(ctx, &workers, 10*time.Minute, func(now time.Time) {
+		rateLimits.Sweep(now, time.Hour)
+	})
+
+	// the revision of the current version of each post is always kept, however old
+	retention := database.RetentionPolicy{Keep: cfg.RevisionsKeep, MaxAge: cfg.RevisionsMaxAge}
+	if retention.Enabled() {
+		server.Every(ctx, &workers, time.Hour, func(now time.Time) {
+			if n, err := db.PruneRevisions(retention, now); err != nil {
+				logger.Error("pruning revisions failed", "error", err)
+			} else if n > 0 {
+				logger.Info("pruned revisions", "count", n)
+			}
+		})
+	}
+
+	if cfg.TrashRetention > 0 {
+		server.Every(ctx, &workers, time.Hour, func(now time.Time) {
+			if posts, users, err := db.PurgeTrash(now.Add(-cfg.TrashRetention)); err != nil {
+				logger.Error("purging the trash failed", "error", err)
+			} else if posts > 0 || users > 0 {
+				logger.Info("purged the trash", "posts", posts, "users", users)
+			}
+		})
+	}
+
+	publisher := scheduler.NewPublisher(db, clock.Real, cfg.PublishInterval, logger)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		publisher.Run(ctx)
+	}()
+
+	env := &config.Env{
+		Config:     cfg,
+		DB:         db,
+		Store:      store,
+		Lockout:    lockout.NewGuard(lockoutStore),
+		Mailer:     mailer.NewLogMailer(os.Stdout),
+		RateLimits: rateLimits,
+		Clock:      clock.Real,
+	}
 	r := routes.Router(env)
 
-	//// this is a generic serve for things like CSS
-	r.ServeFiles("/public/*filepath", http.Dir("public"))
+	//// this is a generic serve for things like CSS, with their precompressed .br and .gz files when present
+	files := compress.FileServer(http.Dir("public"))
+	r.GET("/public/*filepath", func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		r.URL.Path = ps.ByName("filepath")
+		files.ServeHTTP(w, r)
+	})
 
 	r.GET("/", Index)
 	r.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "public/404.html")
 	})
 
-	port := os.Getenv("PORT")
-	fmt.Println("Listening on ", port)
-	err = http.ListenAndServe(":"+port, CorsHandler(csrf.Protect([]byte(os.Getenv("APPLICATION_SECRET")), csrf.Secure(false))(r)))
+	metrics.DBStats(metrics.Default, db.Stats)
+	metrics.Default.GaugeFunc("simcha_active_sessions", "Number of logged in sessions.", func() (float64, error) {
+		n, err := db.CountUserSessions()
+		return float64(n), err
+	})
+
+	// metrics are served on their own listener when METRICS_ADDR is set, otherwise on /metrics behind METRICS_TOKEN
+	metricsHandler := metrics.Handler(metrics.Default, cfg.MetricsToken)
+	if addr := cfg.MetricsAddr; addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metricsHandler)
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			logger.Info("serving metrics", "addr", addr)
+			if err := server.Run(ctx, server.New(addr, mux), grace); err != nil {
+				logger.Error("metrics listener stopped", "error", err)
+			}
+		}()
+	} else {
+		handle(r, "/metrics", metricsHandler)
+	}
 
+	checker := health.NewChecker()
+	checker.Register("database", db.PingContext)
+	checker.Register("migrations", db.CheckMigrations)
+	handle(r, "/healthz", checker.LiveHandler())
+	handle(r, "/readyz", checker.ReadyHandler())
+
+	logger.Info("listening", "port", cfg.Port, "tls", cfg.TLS())
+	// CORS runs before CSRF, so preflight requests are answered without a token. Browsers send violation reports
+	// without a token either, so the report endpoint skips the check
+	handler := corsPolicy(cfg).Handler(skipCSRF(secure.ReportPath, csrf.Protect([]byte(cfg.ApplicationSecret), csrf.Secure(cfg.TLS()))(r)))
+	handler = compress.New(cfg.CompressMinSize).Handler(handler)
+	handler = secure.Headers(secureOptions(cfg), handler)
+	handler = logging.Handler(logger, metrics.Instrument(metrics.Default, handler))
+	srv := server.New(cfg.Addr(), tracing.Handler(tracing.Default, handler))
+	if cfg.TLS() {
+		if srv.TLSConfig, err = serveTLS(ctx, cfg, &workers, logger); err != nil {
+			return err
+		}
+	}
+	// readiness fails first, and requests are still served until the load balancer has noticed
+	serveCtx := server.Drain(ctx, cfg.ShutdownDrain, func() {
+		logger.Info("shutting down", "drain", cfg.ShutdownDrain, "grace", grace)
+		checker.SetReady(false)
+	})
+
+	checker.SetReady(true)
+	if err := server.Run(serveCtx, srv, grace); err != nil {
+		logger.Error("server stopped", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// serveTLS loads the certificate, generating one in development, and reloads it on SIGHUP or when its files change.
+// With TLS_REDIRECT_ADDR, plain HTTP requests are redirected to HTTPS
+func serveTLS(ctx context.Context, cfg *config.Config, workers *sync.WaitGroup, logger *slog.Logger) (*tls.Config, error) {
+	certFile, keyFile := cfg.TLSCert, cfg.TLSKey
+	if cfg.TLSDev {
+		var err error
+		if certFile, keyFile, err = certs.Dev(cfg.TLSDevDir); err != nil {
+			return nil, err
+		}
+		logger.Info("serving a development certificate, trust its CA to avoid browser warnings",
+			"ca", filepath.Join(cfg.TLSDevDir, certs.CAFile))
+	}
+
+	reloader, err := certs.NewReloader(certFile, keyFile)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	server.Every(ctx, workers, 10*time.Second, func(time.Time) {
+		if changed, err := reloader.ReloadIfChanged(); err != nil {
+			logger.Error("reloading certificate", "error", err)
+		} else if changed {
+			logger.Info("reloaded certificate", "cert", certFile)
+		}
+	})
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		defer signal.Stop(hup)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := reloader.Reload(); err != nil {
+					logger.Error("reloading certificate", "error", err)
+				} else {
+					logger.Info("reloaded certificate", "cert", certFile)
+				}
+			}
+		}
+	}()
+
+	if addr := cfg.TLSRedirectAddr; addr != "" {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			logger.Info("redirecting to HTTPS", "addr", addr)
+			if err := server.Run(ctx, server.New(addr, certs.RedirectHandler(cfg.Port)), cfg.ShutdownGrace); err != nil {
+				logger.Error("redirect listener stopped", "error", err)
+			}
+		}()
 	}
+
+	return reloader.Config(), nil
 }
 
-func CorsHandler(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin",  os.Getenv("DOMAIN"))
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		w.Header().Set("Access-Control-Expose-Headers", "Content-Type, Content-Length, X-CSRF-Token")
+// handle serves the handler for GET requests on the router, recording the path as its route
+func handle(r *httprouter.Router, path string, h http.Handler) {
+	r.GET(path, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		logging.SetRoute(r.Context(), path)
+		tracing.SetRoute(r, path)
 		h.ServeHTTP(w, r)
 	})
 }
 
+// corsPolicy allows the configured origins to use the API with credentials, and any origin to load static files
+func corsPolicy(cfg *config.Config) *cors.CORS {
+	c := cors.New(&cors.Policy{
+		AllowedOrigins:   cfg.Origins(),
+		AllowedMethods:   cfg.CORSMethods,
+		AllowedHeaders:   cfg.CORSHeaders,
+		ExposedHeaders:   []string{"Content-Type", "Content-Length", "X-CSRF-Token", logging.RequestIDHeader},
+		AllowCredentials: true,
+		MaxAge:           cfg.CORSMaxAge,
+	})
+
+	c.Route("/public/", &cors.Policy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET"},
+		MaxAge:         cfg.CORSMaxAge,
+	})
+
+	return c
+}
+
+// secureOptions applies the CSP and HSTS settings over the default security headers
+func secureOptions(cfg *config.Config) secure.Options {
+	o := secure.Defaults()
+	if cfg.CSP != "" {
+		o.CSP = cfg.CSP
+	}
+	o.ReportOnly = cfg.CSPReportOnly
+	o.HSTSMaxAge = cfg.HSTSMaxAge
+
+	return o
+}
+
+// skipCSRF lets requests to path through csrf.Protect without a token
+func skipCSRF(path string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == path {
+			r = csrf.UnsafeSkipCheck(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func Index(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	http.ServeFile(w, r, r.URL.Path[1:]+"public")
 }